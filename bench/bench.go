@@ -4,21 +4,38 @@ Package bench provides a generic framework for performing latency benchmarks.
 package bench
 
 import (
+	"context"
+	stderrors "errors"
+	"math/rand"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"fmt"
-	"log"
+	"log/slog"
 
 	"github.com/codahale/hdrhistogram"
 )
 
 const (
+	// defaults of SetHistogramRange
 	minRecordableLatencyNS = 1000000
 	maxRecordableLatencyNS = 100000000000
 	sigFigs                = 5
+
+	// connection phases are often well below a millisecond
+	minRecordablePhaseNS = 1000
+
+	// response sizes are tracked in bytes up to 1TiB
+	maxRecordableSize = 1 << 40
+	sizeSigFigs       = 3
+
+	// minScheduledRate keeps a ramp-up or schedule at zero from waiting forever for the next request
+	minScheduledRate = 1
 )
 
 // RequesterFactory creates new Requesters.
@@ -34,12 +51,156 @@ type Requester interface {
 	Setup() error
 
 	// Request performs a synchronous request to the system under test.
-	Request() error
+	Request() (Result, error)
 
 	// Teardown is called upon benchmark completion.
 	Teardown() error
 }
 
+// ContextRequester is implemented by Requesters which can abort a request in
+// flight. The context passed to RequestContext is done once the benchmark is
+// stopped early, e.g. by cancelling the context of RunContext, and requests
+// failing after that are not measured as they didn't complete.
+type ContextRequester interface {
+	RequestContext(ctx context.Context) (Result, error)
+}
+
+// ConnectionWarmer is implemented by Requesters which can open their
+// connection to the system under test ahead of their first request, see
+// SetConnectionWarmUp.
+type ConnectionWarmer interface {
+	// WarmUpConnection opens the connection, it is called after Setup.
+	WarmUpConnection() error
+}
+
+// ConnectionCounter is implemented by RequesterFactories which count the
+// connections their Requesters open to the system under test, which can be
+// fewer than the Benchmark connections when they share connections, or more
+// when they reconnect.
+type ConnectionCounter interface {
+	// ConnectionsOpened returns how many connections were opened so far.
+	ConnectionsOpened() uint64
+}
+
+// CategorizedError is implemented by errors returned from Request which
+// belong to a category of failures. Failed requests are counted per category
+// in the Summary, errors not implementing it are counted as OtherErrors.
+type CategorizedError interface {
+	error
+
+	// Category returns the name of the category the error belongs to.
+	Category() string
+}
+
+// OtherErrors is the category of errors which don't have one.
+const OtherErrors = "Other"
+
+// Result describes a request performed by a Requester.
+type Result struct {
+	// Label identifies the kind of request made when a Requester issues
+	// several kinds, latencies are additionally broken down by it. Empty
+	// if not applicable.
+	Label string
+
+	// RequestID is the unique ID the request was sent with, for looking it up
+	// in the traces of the system under test. Empty if it had none.
+	RequestID string
+
+	// Method and URL are what a failed request was sent to, for the abort
+	// reason of SetStopOnFirstError. Empty if not applicable, or if the
+	// request succeeded.
+	Method string
+	URL    string
+
+	// StatusCode is the status returned by the system under test, for both
+	// successful and failed requests. Requests are counted per status code
+	// in the Summary. Zero if no status was received.
+	StatusCode int
+
+	// StatusReceived is set by Requesters whose protocol has a zero status,
+	// like the OK of gRPC, so that it is counted as well.
+	StatusReceived bool
+
+	// BytesSent and BytesReceived are the sizes of the request and response
+	// bodies, or messages, for reporting bandwidth in the Summary.
+	BytesSent     int64
+	BytesReceived int64
+
+	// BytesDecompressed is the size of a compressed response body once
+	// decompressed, BytesReceived being its size on the wire. Zero if the
+	// response was not compressed, in which case both sizes are the same.
+	BytesDecompressed int64
+
+	// Retries is the number of times the request was retried before it
+	// succeeded or failed for good, zero if it wasn't.
+	Retries int
+
+	// RateLimited is set if the system under test rejected the request for
+	// exceeding its rate limit, such requests are counted in the Summary.
+	// RetryAfter is how long the server asked to wait before the next request,
+	// the connection waits that long, or until the run ends, before it sends
+	// its next request. The wait is not part of any latency.
+	RateLimited bool
+	RetryAfter  time.Duration
+
+	// TimeToFirstByte is the time until the first byte of the response was
+	// received, for successful requests it gets its own latency histogram.
+	// Zero if not measured.
+	TimeToFirstByte time.Duration
+
+	// Connection is the time spent opening a connection for a successful
+	// request, phases are reported in the Summary if measured.
+	Connection ConnectionTiming
+}
+
+// ConnectionTiming breaks down the time spent opening the connection of a
+// request. All phases are zero when an open connection was reused.
+type ConnectionTiming struct {
+	// Measured is false if the Requester doesn't measure the phases.
+	Measured     bool
+	DNSLookup    time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+
+	// GotConn is set if the Requester knows whether the connection was
+	// reused: Reused if it was opened for an earlier request, and WasIdle if
+	// it was idle in the pool of the client meanwhile. Reuse is reported in
+	// the Summary of requests for which GotConn is set.
+	GotConn bool
+	Reused  bool
+	WasIdle bool
+}
+
+// Observer is notified of every measured request while the benchmark runs,
+// e.g. to export live metrics. Observe is called from a single goroutine
+// collecting the results, so it must return quickly not to hold them up.
+type Observer interface {
+	// Observe is called with the time the request started at, its latency
+	// and outcome.
+	Observe(start time.Time, latency time.Duration, result Result, err error)
+}
+
+// sample is the latency of a request along with its outcome.
+type sample struct {
+	start   time.Time
+	latency int64
+	result  Result
+	err     error
+	step    int
+}
+
+// LoadStep is a part of the benchmark issuing requests at a fixed rate.
+type LoadStep struct {
+	Rate     uint64
+	Duration time.Duration
+}
+
+// RatePoint is the request rate at a time of a rate schedule.
+type RatePoint struct {
+	Time time.Duration
+	Rate float64
+}
+
 // Benchmark performs a system benchmark by attempting to issue requests at a
 // specified rate and capturing the latency distribution. The request rate is
 // divided across the number of configured connections.
@@ -48,11 +209,58 @@ type Benchmark struct {
 	requestRate      float64
 	duration         time.Duration
 	warmUpDuration   time.Duration
+	rampUpDuration   time.Duration
+	rampUpStartRate  float64
+	maxRequests      uint64
+	continuous       bool
+	excludePaused    bool
+	pause            pauseState
+	arrivals         *rand.Rand
+	randomSeed       int64
+	thinkTime        *ThinkTime
+	warmUpConns      uint64
+	warmedUpConns    uint64
+	warmUpTime       time.Duration
+	stopThinking     chan struct{}
+	percentiles      []float64
+	loadSteps        []LoadStep
+	stepHistograms   []*hdrhistogram.Histogram
+	rateSchedule     []RatePoint
+	logInterval      time.Duration
+	logHistogram     *hdrhistogram.Histogram
+	logIntervalStart time.Duration
+	histogramLog     []HistogramLogInterval
+	steadyStart      time.Time
+	measureFrom      time.Time
 	baseLatency      time.Duration
 	expectedInterval time.Duration
+	histogramMin     int64
+	histogramMax     int64
+	histogramDigits  int
+	outOfRangeTotal  uint64
+	correctLatency   bool
 	successHistogram *hdrhistogram.Histogram
+	uncorrected      *hdrhistogram.Histogram
+	failureHistogram *hdrhistogram.Histogram
+	ttfbHistogram    *hdrhistogram.Histogram
+	dnsHistogram     *hdrhistogram.Histogram
+	connectHistogram *hdrhistogram.Histogram
+	tlsHistogram     *hdrhistogram.Histogram
+	sizeHistogram    *hdrhistogram.Histogram
+	labelHistograms  map[string]*hdrhistogram.Histogram
+	connReuse        ConnectionReuse
+	openedBefore     uint64
 	successTotal     uint64
 	errorTotal       uint64
+	bytesSent        uint64
+	bytesReceived    uint64
+	bytesDecoded     uint64
+	retriedTotal     uint64
+	rateLimitedTotal uint64
+	canceledTotal    uint64
+	drainTimeout     time.Duration
+	drainAborted     uint64
+	retriesTotal     uint64
 	avgRequestTime   float64
 	elapsed          time.Duration
 	factory          RequesterFactory
@@ -61,6 +269,16 @@ type Benchmark struct {
 	timelySends      uint64
 	lateSends        uint64
 	errors           map[string]int
+	errorCategories  map[string]int
+	statusCodes      map[int]int
+	observers        []Observer
+	maxErrorRate     float64
+	errorWindow      *errorRateWindow
+	stopOnError      bool
+	forceTightTicker bool
+	abortCh          chan struct{}
+	abortReason      string
+	inFlight         int64
 }
 
 // NewBenchmark creates a Benchmark which runs a system benchmark using the
@@ -77,55 +295,411 @@ func NewBenchmark(factory RequesterFactory, requestRate, connections uint64, dur
 	}
 
 	if requestRate <= 0 {
-		log.Panicln("RequestRate must be positive")
+		panic("RequestRate must be positive")
 	}
 
-	return &Benchmark{
+	b := &Benchmark{
 		connections:      connections,
 		requestRate:      float64(requestRate),
 		duration:         duration,
 		warmUpDuration:   warmUpDuration,
 		baseLatency:      baseLatency,
 		expectedInterval: time.Duration(float64(time.Second) / float64(requestRate)),
-		successHistogram: hdrhistogram.New(minRecordableLatencyNS, maxRecordableLatencyNS, sigFigs),
+		histogramMin:     minRecordableLatencyNS,
+		histogramMax:     maxRecordableLatencyNS,
+		histogramDigits:  sigFigs,
+		sizeHistogram:    hdrhistogram.New(1, maxRecordableSize, sizeSigFigs),
+		labelHistograms:  make(map[string]*hdrhistogram.Histogram),
 		factory:          factory,
-		errors:           make(map[string]int)}
+		errors:           make(map[string]int),
+		errorCategories:  make(map[string]int),
+		statusCodes:      make(map[int]int),
+		randomSeed:       time.Now().UnixNano(),
+		percentiles:      DefaultPercentiles}
+	b.pause.notify = make(chan struct{}, 1)
+	b.newHistograms()
+	return b
+}
+
+// SetHistogramRange sets the range of latencies tracked by the histograms and
+// their precision in significant digits, from 1 to 5, zero values keep the
+// defaults of 1ms, 100s and 5. Latencies below lowest are tracked at its
+// resolution, latencies beyond highest are recorded as highest and counted in
+// OutOfRangeTotal of the Summary. Highest must be at least twice lowest. It
+// must be called before Run.
+func (b *Benchmark) SetHistogramRange(lowest, highest time.Duration, significantDigits int) {
+	maybePanic(b.setHistogramRange(lowest, highest, significantDigits))
+}
+
+func (b *Benchmark) setHistogramRange(lowest, highest time.Duration, significantDigits int) error {
+	if lowest > 0 {
+		b.histogramMin = lowest.Nanoseconds()
+	}
+	if highest > 0 {
+		b.histogramMax = highest.Nanoseconds()
+	}
+	if significantDigits != 0 {
+		b.histogramDigits = significantDigits
+	}
+
+	if b.histogramDigits < 1 || b.histogramDigits > 5 {
+		return fmt.Errorf("Histogram significant digits must be from 1 to 5, got %d", b.histogramDigits)
+	}
+	if b.histogramMax < 2*b.histogramMin {
+		return fmt.Errorf("Histogram max value %s must be at least twice the min value %s", time.Duration(b.histogramMax), time.Duration(b.histogramMin))
+	}
+
+	b.newHistograms()
+	for i := range b.stepHistograms {
+		b.stepHistograms[i] = b.newLatencyHistogram()
+	}
+	if b.logHistogram != nil {
+		b.logHistogram = b.newLatencyHistogram()
+	}
+	if b.uncorrected != nil {
+		b.uncorrected = b.newLatencyHistogram()
+	}
+	return nil
+}
+
+// SetCoordinatedOmissionCorrection corrects the latency of successful requests
+// for coordinated omission the way HdrHistogram does: a request slower than
+// the interval at which each client is expected to send is recorded along with
+// the requests its client would have sent meanwhile, at the latencies they
+// would have seen. If keepUncorrected is true, the Summary additionally holds
+// the uncorrected latency. It must be called before Run.
+func (b *Benchmark) SetCoordinatedOmissionCorrection(keepUncorrected bool) {
+	b.correctLatency = true
+	b.uncorrected = nil
+	if keepUncorrected {
+		b.uncorrected = b.newLatencyHistogram()
+	}
+}
+
+func (b *Benchmark) newHistograms() {
+	b.successHistogram = b.newLatencyHistogram()
+	b.failureHistogram = b.newLatencyHistogram()
+	b.ttfbHistogram = b.newLatencyHistogram()
+	b.dnsHistogram = b.newPhaseHistogram()
+	b.connectHistogram = b.newPhaseHistogram()
+	b.tlsHistogram = b.newPhaseHistogram()
+}
+
+func (b *Benchmark) newLatencyHistogram() *hdrhistogram.Histogram {
+	return hdrhistogram.New(b.histogramMin, b.histogramMax, b.histogramDigits)
+}
+
+func (b *Benchmark) newPhaseHistogram() *hdrhistogram.Histogram {
+	lowest := b.histogramMin
+	if lowest > minRecordablePhaseNS {
+		lowest = minRecordablePhaseNS
+	}
+	return hdrhistogram.New(lowest, b.histogramMax, b.histogramDigits)
+}
+
+// SetRampUp makes the benchmark climb linearly from startRate to the request
+// rate over the given duration before the benchmark duration begins. Requests
+// made while ramping up are not measured, it must be called before Run.
+func (b *Benchmark) SetRampUp(duration time.Duration, startRate uint64) {
+	b.rampUpDuration = duration
+	b.rampUpStartRate = float64(startRate)
+}
+
+// SetLoadSteps makes the benchmark play the steps in order instead of issuing
+// requests at the request rate for the benchmark duration. If perStepLatency
+// is true, latencies of successful requests are additionally broken down by
+// step. It must be called before Run.
+func (b *Benchmark) SetLoadSteps(steps []LoadStep, perStepLatency bool) {
+	b.loadSteps = steps
+	b.duration = 0
+	for _, step := range steps {
+		b.duration += step.Duration
+	}
+
+	b.stepHistograms = nil
+	if perStepLatency {
+		b.stepHistograms = make([]*hdrhistogram.Histogram, len(steps))
+		for i := range steps {
+			b.stepHistograms[i] = b.newLatencyHistogram()
+		}
+	}
+}
+
+// SetRateSchedule makes the request rate follow the points, interpolating
+// linearly between them, instead of issuing requests at the request rate. The
+// points must be sorted by time, the benchmark lasts until the last one. It
+// must be called before Run.
+func (b *Benchmark) SetRateSchedule(points []RatePoint) {
+	b.rateSchedule = points
+	b.duration = points[len(points)-1].Time
+}
+
+// scheduledRateAt returns the rate of the schedule at the given time since the end of ramp-up.
+func (b *Benchmark) scheduledRateAt(elapsed time.Duration) float64 {
+	points := b.rateSchedule
+	next := sort.Search(len(points), func(i int) bool { return points[i].Time > elapsed })
+	if next == 0 {
+		return points[0].Rate
+	}
+	if next == len(points) {
+		return points[len(points)-1].Rate
+	}
+
+	from, to := points[next-1], points[next]
+	return from.Rate + (to.Rate-from.Rate)*float64(elapsed-from.Time)/float64(to.Time-from.Time)
+}
+
+// stepAt returns the index of the load step at the given time since the end
+// of ramp-up, the last step is returned once all steps are over.
+func (b *Benchmark) stepAt(elapsed time.Duration) int {
+	for i, step := range b.loadSteps {
+		if elapsed < step.Duration {
+			return i
+		}
+		elapsed -= step.Duration
+	}
+	return len(b.loadSteps) - 1
+}
+
+// steadyRateAt returns the request rate at the given time since the end of ramp-up.
+func (b *Benchmark) steadyRateAt(elapsed time.Duration) float64 {
+	switch {
+	case len(b.rateSchedule) > 0:
+		return b.scheduledRateAt(elapsed)
+	case len(b.loadSteps) > 0:
+		return float64(b.loadSteps[b.stepAt(elapsed)].Rate)
+	default:
+		return b.requestRate
+	}
+}
+
+// intervalAt returns the time between requests at the given time since the
+// start of the run.
+func (b *Benchmark) intervalAt(elapsed time.Duration) time.Duration {
+	var rate float64
+	if elapsed >= b.rampUpDuration {
+		if len(b.loadSteps) == 0 && len(b.rateSchedule) == 0 {
+			return b.expectedInterval
+		}
+		rate = b.steadyRateAt(elapsed - b.rampUpDuration)
+	} else {
+		targetRate := b.steadyRateAt(0)
+		rate = b.rampUpStartRate + (targetRate-b.rampUpStartRate)*float64(elapsed)/float64(b.rampUpDuration)
+	}
+
+	if rate < minScheduledRate {
+		rate = minScheduledRate
+	}
+	return time.Duration(float64(time.Second) / rate)
+}
+
+// SetMaxRequests makes the benchmark stop once the given number of requests
+// were sent, even if the duration hasn't elapsed. Requests made while ramping
+// up and warming up are counted too. It must be called before Run.
+func (b *Benchmark) SetMaxRequests(maxRequests uint64) {
+	b.maxRequests = maxRequests
+}
+
+// SetContinuous makes the benchmark run until it's stopped, by the done
+// channel of Run, the context of RunContext or SetMaxRequests, instead of for
+// its duration. It must be called before Run.
+func (b *Benchmark) SetContinuous() {
+	b.continuous = true
+}
+
+// reachedMaxRequests reports whether sent requests reached the maximum, if there is one.
+func (b *Benchmark) reachedMaxRequests(sent uint64) bool {
+	return b.maxRequests > 0 && sent >= b.maxRequests
+}
+
+// SetPoissonArrivals makes requests arrive as a Poisson process at the request
+// rate, so the time between them is exponentially distributed instead of
+// fixed. It must be called before Run.
+func (b *Benchmark) SetPoissonArrivals(seed int64) {
+	b.arrivals = rand.New(rand.NewSource(seed))
+}
+
+// SetRandomSeed seeds the think time of the clients, which otherwise is seeded
+// from the clock, so that runs with the same seed wait the same. Each client
+// derives its own source from the seed and its number. It must be called
+// before Run.
+func (b *Benchmark) SetRandomSeed(seed int64) {
+	b.randomSeed = seed
+}
+
+// nextInterval returns the time until the next request at the given time since
+// the start of the run, only the ticker calls it.
+func (b *Benchmark) nextInterval(elapsed time.Duration) time.Duration {
+	interval := b.intervalAt(elapsed)
+	if b.arrivals != nil {
+		interval = time.Duration(b.arrivals.ExpFloat64() * float64(interval))
+	}
+	return interval
+}
+
+// SetThinkTime makes every connection wait a think time after each of its
+// requests before it takes the next one. It models the pacing of user
+// sessions, while the requests are still sent at the request rate by the
+// connections that are not thinking, so there must be enough of them. It must
+// be called before Run.
+func (b *Benchmark) SetThinkTime(thinkTime ThinkTime) {
+	if err := thinkTime.validate(); err != nil {
+		panic(err)
+	}
+	b.thinkTime = &thinkTime
+}
+
+// SetConnectionWarmUp makes the first connections Requesters warm up their
+// connections before any request is sent, so that the first requests measured
+// don't pay for connection setup such as TLS handshakes. A zero value warms up
+// all connections, Requesters not implementing ConnectionWarmer are skipped.
+// It must be called before Run.
+func (b *Benchmark) SetConnectionWarmUp(connections uint64) {
+	if connections == 0 || connections > b.connections {
+		connections = b.connections
+	}
+	b.warmUpConns = connections
+}
+
+// SetPercentiles sets the latency percentiles reported in the Summary, they
+// must be valid as checked by ValidatePercentiles. It must be called before
+// Run.
+func (b *Benchmark) SetPercentiles(percentiles []float64) {
+	b.percentiles = percentiles
+}
+
+// SetHistogramLogInterval makes the Summary carry a histogram log, the
+// latency of successful requests in intervals of the given length, by the
+// time they completed. It must be called before Run.
+func (b *Benchmark) SetHistogramLogInterval(interval time.Duration) {
+	b.logInterval = interval
+	b.logHistogram = b.newLatencyHistogram()
+}
+
+// SetMaxErrorRate makes the benchmark stop early if the error rate of the
+// requests completed over the last window exceeds maxErrorRate percent, the
+// Summary tells why in AbortReason. It must be called before Run.
+func (b *Benchmark) SetMaxErrorRate(maxErrorRate float64, window time.Duration) {
+	b.maxErrorRate = maxErrorRate
+	b.errorWindow = newErrorRateWindow(window)
+}
+
+// SetStopOnFirstError makes the benchmark stop at the first failed request,
+// for a quick sanity check of a config before a long run. The Summary tells
+// the method, URL, error and status of the request in AbortReason. It must be
+// called before Run.
+func (b *Benchmark) SetStopOnFirstError() {
+	b.stopOnError = true
+}
+
+// SetDrainTimeout bounds how long the requests still in flight once the
+// benchmark stops sending are waited for, they are measured if they complete
+// in time. Those still in flight then are aborted if the Requester is a
+// ContextRequester and counted in DrainAbortedTotal of the Summary. Without
+// it they are waited for however long they take. It must be called before Run.
+func (b *Benchmark) SetDrainTimeout(timeout time.Duration) {
+	b.drainTimeout = timeout
+}
+
+// AddObserver registers an Observer notified of every measured request, it
+// must be called before Run.
+func (b *Benchmark) AddObserver(observer Observer) {
+	b.observers = append(b.observers, observer)
+}
+
+// InFlight returns the number of requests currently being performed.
+func (b *Benchmark) InFlight() int64 {
+	return atomic.LoadInt64(&b.inFlight)
 }
 
 // Run the benchmark and return a summary of the results. An error is returned
-// if something went wrong along the way.
+// if something went wrong along the way. Receiving from done stops the
+// benchmark early, like cancelling the context of RunContext.
 func (b *Benchmark) Run(done <-chan struct{}, outputJson bool, forceTightTicker bool) (*Summary, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	b.forceTightTicker = b.forceTightTicker || forceTightTicker
+	return b.run(ctx, outputJson)
+}
+
+// run runs the benchmark until its duration is over or ctx is done, requests
+// in flight are given ctx to abort them.
+func (b *Benchmark) run(ctx context.Context, outputJson bool) (*Summary, error) {
 	var (
 		ticker        = make(chan time.Time)
-		results       = make(chan int64, 100)
-		errors        = make(chan error, 100)
+		results       = make(chan sample, 100)
 		stopCollector = make(chan struct{})
+		workersDone   = make(chan struct{})
 		wg            sync.WaitGroup
 	)
 
-	// Prepare connection benchmarks
+	// Requests are also aborted once the drain after the ticker stopped times out
+	requestCtx, abortRequests := context.WithCancel(ctx)
+	defer abortRequests()
+
+	// the counter of the factory may be shared with earlier runs, only the
+	// connections of this one are reported
+	if counter, ok := b.factory.(ConnectionCounter); ok {
+		b.openedBefore = counter.ConnectionsOpened()
+	}
+
+	// Prepare connection benchmarks, with connection warm-up the ticker only
+	// starts once all of them are ready
+	var ready sync.WaitGroup
+	warmUpStart := time.Now()
+	ready.Add(int(b.connections))
 	wg.Add(int(b.connections))
 	for i := uint64(0); i < b.connections; i++ {
 		i := i
 		go func() {
-			b.worker(b.factory.GetRequester(i), ticker, results, errors)
+			requester := b.factory.GetRequester(i)
+			maybePanic(requester.Setup())
+			b.warmUpConnection(i, requester)
+			ready.Done()
+
+			b.worker(requestCtx, i, requester, ticker, results)
 			// log.Printf("Worker %d done\n", i)
 			wg.Done()
 		}()
 	}
+	if b.warmUpConns > 0 {
+		ready.Wait()
+		b.warmUpTime = time.Since(warmUpStart)
+		slog.Info("Connections warmed up", "connections", b.warmedUpConns, "of", b.warmUpConns, "took", b.warmUpTime)
+	}
 
-	// Prepare ticker
-	go b.tickerFunc(done, ticker, forceTightTicker)
+	if b.errorWindow != nil || b.stopOnError {
+		b.abortCh = make(chan struct{})
+	}
+
+	// Prepare ticker, thinking connections stop once it does
+	b.stopThinking = make(chan struct{})
+	go func() {
+		b.tickerFunc(ctx.Done(), ticker, b.forceTightTicker)
+		close(b.stopThinking)
+		if b.drainTimeout > 0 {
+			b.drain(abortRequests, workersDone)
+		}
+	}()
 
 	// Prepare results collector
 	go func() {
-		b.collectorFunc(stopCollector, results, errors)
+		b.collectorFunc(stopCollector, results)
 		// log.Println("Collector done")
 		wg.Done()
 	}()
 
 	// Wait for completion of workers
 	wg.Wait()
+	close(workersDone)
 	// log.Println("Workers have finished")
 
 	wg.Add(1)
@@ -134,23 +708,41 @@ func (b *Benchmark) Run(done <-chan struct{}, outputJson bool, forceTightTicker
 
 	// log.Println("Collector has finished")
 
-	fmt.Printf("Ticks=%d, TimelyTicks = %d, MissedTicks = %d, %.2f%% good\n", b.timelyTicks+b.missedTicks, b.timelyTicks, b.missedTicks, float64(b.timelyTicks)*100/float64(b.timelyTicks+b.missedTicks))
-	fmt.Printf("Sends=%d, TimelySends = %d, LateSends   = %d, %.2f%% good\n", b.timelySends+b.lateSends, b.timelySends, b.lateSends, float64(b.timelySends)*100/float64(b.timelySends+b.lateSends))
+	slog.Info("Ticks", "ticks", b.timelyTicks+b.missedTicks, "timelyTicks", b.timelyTicks, "missedTicks", b.missedTicks,
+		"goodPercent", fmt.Sprintf("%.2f", float64(b.timelyTicks)*100/float64(b.timelyTicks+b.missedTicks)))
+	slog.Info("Sends", "sends", b.timelySends+b.lateSends, "timelySends", b.timelySends, "lateSends", b.lateSends,
+		"goodPercent", fmt.Sprintf("%.2f", float64(b.timelySends)*100/float64(b.timelySends+b.lateSends)))
 
-	if len(b.errors) > 0 {
-		fmt.Println()
-		fmt.Println("Errors:")
-		for etext, count := range b.errors {
-			fmt.Println(count, "=", etext)
-		}
-		fmt.Println()
+	for etext, count := range b.errors {
+		slog.Warn("Requests failed", "count", count, "error", etext)
+	}
+	if b.canceledTotal > 0 {
+		slog.Info("Requests in flight were aborted as the benchmark was stopped or DrainTimeout passed, they are not measured", "count", b.canceledTotal)
 	}
 
 	summary := b.summarize(outputJson)
 	return summary, nil
 }
 
-func (b *Benchmark) collectorFunc(doneCh <-chan struct{}, results <-chan int64, errors <-chan error) {
+// drain waits up to drainTimeout for the workers to complete the requests in
+// flight after the ticker stopped, then aborts those still in flight.
+func (b *Benchmark) drain(abortRequests context.CancelFunc, workersDone <-chan struct{}) {
+	timer := time.NewTimer(b.drainTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-workersDone:
+	case <-timer.C:
+		inFlight := atomic.LoadInt64(&b.inFlight)
+		atomic.StoreUint64(&b.drainAborted, uint64(inFlight))
+		if inFlight > 0 {
+			slog.Warn("Requests were still in flight when DrainTimeout passed, aborting them", "count", inFlight, "drainTimeout", b.drainTimeout)
+		}
+		abortRequests()
+	}
+}
+
+func (b *Benchmark) collectorFunc(doneCh <-chan struct{}, results <-chan sample) {
 	var (
 		baseLatency    = b.baseLatency.Nanoseconds()
 		successTotal   int64
@@ -158,19 +750,208 @@ func (b *Benchmark) collectorFunc(doneCh <-chan struct{}, results <-chan int64,
 	)
 	for {
 		select {
-		case sample := <-results:
+		case s := <-results:
+			for _, observer := range b.observers {
+				observer.Observe(s.start, time.Duration(s.latency), s.result, s.err)
+			}
+			if b.stopOnError && s.err != nil {
+				b.stopOnFailure(s)
+			}
+			if b.errorWindow != nil {
+				b.checkErrorRate(s)
+			}
+			if b.logHistogram != nil {
+				b.rotateHistogramLog(s.start.Add(time.Duration(s.latency)).Sub(b.measureFrom))
+			}
+
+			if s.result.StatusCode != 0 || s.result.StatusReceived {
+				b.statusCodes[s.result.StatusCode]++
+			}
+			b.bytesSent += uint64(s.result.BytesSent)
+			b.bytesReceived += uint64(s.result.BytesReceived)
+			if s.result.BytesDecompressed > 0 {
+				b.bytesDecoded += uint64(s.result.BytesDecompressed)
+			} else {
+				b.bytesDecoded += uint64(s.result.BytesReceived)
+			}
+			if s.result.RateLimited {
+				b.rateLimitedTotal++
+			}
+			if s.result.Retries > 0 {
+				b.retriedTotal++
+				b.retriesTotal += uint64(s.result.Retries)
+			}
+
+			if s.err != nil {
+				b.recordError(s, baseLatency)
+				continue
+			}
+
 			successTotal++
-			maybePanic(b.successHistogram.RecordValue(sample - baseLatency))
-			avgRequestTime = (avgRequestTime*float64(successTotal-1) + float64(sample/1e6)) / float64(successTotal)
-		case err := <-errors:
-			b.errors[err.Error()]++
+			if !b.recordSuccessLatency(b.successHistogram, s.latency-baseLatency) {
+				b.outOfRangeTotal++
+			}
+			if b.uncorrected != nil {
+				recordLatency(b.uncorrected, s.latency-baseLatency)
+			}
+			if b.logHistogram != nil {
+				b.recordSuccessLatency(b.logHistogram, s.latency-baseLatency)
+			}
+			avgRequestTime = (avgRequestTime*float64(successTotal-1) + float64(s.latency/1e6)) / float64(successTotal)
+
+			if s.result.Label != "" {
+				histogram, ok := b.labelHistograms[s.result.Label]
+				if !ok {
+					histogram = b.newLatencyHistogram()
+					b.labelHistograms[s.result.Label] = histogram
+				}
+				recordLatency(histogram, s.latency-baseLatency)
+			}
+
+			recordLatency(b.sizeHistogram, s.result.BytesReceived)
+
+			if s.result.TimeToFirstByte > 0 {
+				recordLatency(b.ttfbHistogram, int64(s.result.TimeToFirstByte)-baseLatency)
+			}
+
+			if s.result.Connection.Measured {
+				recordLatency(b.dnsHistogram, int64(s.result.Connection.DNSLookup))
+				recordLatency(b.connectHistogram, int64(s.result.Connection.Connect))
+				recordLatency(b.tlsHistogram, int64(s.result.Connection.TLSHandshake))
+			}
+			if connection := s.result.Connection; connection.GotConn {
+				b.connReuse.Requests++
+				if connection.Reused {
+					b.connReuse.Reused++
+				}
+				if connection.WasIdle {
+					b.connReuse.WasIdle++
+				}
+			}
+
+			if s.step >= 0 {
+				recordLatency(b.stepHistograms[s.step], s.latency-baseLatency)
+			}
 		case <-doneCh:
+			if b.logHistogram != nil {
+				b.closeLogInterval(time.Since(b.measureFrom) - b.logIntervalStart)
+			}
 			b.avgRequestTime = avgRequestTime
 			return
 		}
 	}
 }
 
+// checkErrorRate stops the benchmark once the error rate over the window
+// exceeds MaxErrorRate.
+func (b *Benchmark) checkErrorRate(s sample) {
+	if b.abortReason != "" {
+		return
+	}
+
+	b.errorWindow.add(s.start.Add(time.Duration(s.latency)).Sub(b.measureFrom), s.err != nil)
+	if rate, ok := b.errorWindow.rate(); ok && rate > b.maxErrorRate {
+		b.abortReason = fmt.Sprintf("error rate of %.2f%% over the last %s exceeded %.4g%%",
+			rate, b.errorWindow.bucketLength*errorRateBuckets, b.maxErrorRate)
+		close(b.abortCh)
+	}
+}
+
+// stopOnFailure stops the benchmark at a failed request, unless it's already
+// stopping.
+func (b *Benchmark) stopOnFailure(s sample) {
+	if b.abortReason != "" {
+		return
+	}
+
+	var details []string
+	if s.result.URL != "" {
+		details = append(details, strings.TrimSpace(s.result.Method+" "+s.result.URL))
+	}
+	details = append(details, "latency "+time.Duration(s.latency).String())
+	if s.result.StatusCode != 0 || s.result.StatusReceived {
+		details = append(details, "status "+strconv.Itoa(s.result.StatusCode))
+	}
+	if s.result.Label != "" {
+		details = append(details, "label "+s.result.Label)
+	}
+	if s.result.RequestID != "" {
+		details = append(details, "request ID "+s.result.RequestID)
+	}
+	b.abortReason = fmt.Sprintf("first failed request, %s: %v", strings.Join(details, ", "), s.err)
+	close(b.abortCh)
+}
+
+// rotateHistogramLog closes the intervals of the histogram log which ended
+// before a request completed at the given time since the start of measurement.
+func (b *Benchmark) rotateHistogramLog(completed time.Duration) {
+	for completed >= b.logIntervalStart+b.logInterval {
+		b.closeLogInterval(b.logInterval)
+	}
+}
+
+func (b *Benchmark) closeLogInterval(length time.Duration) {
+	if length <= 0 {
+		return
+	}
+	interval, err := newHistogramLogInterval(b.logHistogram, b.logIntervalStart, length)
+	maybePanic(err)
+	b.histogramLog = append(b.histogramLog, interval)
+	b.logHistogram.Reset()
+	b.logIntervalStart += length
+}
+
+func (b *Benchmark) recordError(s sample, baseLatency int64) {
+	b.errors[s.err.Error()]++
+
+	var categorized CategorizedError
+	if stderrors.As(s.err, &categorized) {
+		b.errorCategories[categorized.Category()]++
+	} else {
+		b.errorCategories[OtherErrors]++
+	}
+
+	// failed requests often return faster than BaseLatency
+	if !recordLatency(b.failureHistogram, s.latency-baseLatency) {
+		b.outOfRangeTotal++
+	}
+}
+
+// recordLatency records a latency in a histogram, latencies made negative by
+// subtracting BaseLatency as zero and ones beyond the range of the histogram
+// as its highest trackable value, for which it returns false.
+func recordLatency(histogram *hdrhistogram.Histogram, latency int64) bool {
+	inRange := true
+	if latency < 0 {
+		latency = 0
+	} else if latency > histogram.HighestTrackableValue() {
+		latency = histogram.HighestTrackableValue()
+		inRange = false
+	}
+	maybePanic(histogram.RecordValue(latency))
+	return inRange
+}
+
+// recordSuccessLatency records the latency of a successful request like
+// recordLatency does, corrected for coordinated omission if it is enabled.
+func (b *Benchmark) recordSuccessLatency(histogram *hdrhistogram.Histogram, latency int64) bool {
+	if !b.correctLatency {
+		return recordLatency(histogram, latency)
+	}
+
+	inRange := true
+	if latency < 0 {
+		latency = 0
+	} else if latency > histogram.HighestTrackableValue() {
+		latency = histogram.HighestTrackableValue()
+		inRange = false
+	}
+	// clients share the ticker, so each one is expected to send at a fraction of the request rate
+	clientInterval := b.expectedInterval.Nanoseconds() * int64(b.connections)
+	maybePanic(histogram.RecordCorrectedValue(latency, clientInterval))
+	return inRange
+}
+
 func detectOsTimerResolution() time.Duration {
 	bestTimerRes := time.Hour
 
@@ -193,19 +974,19 @@ func detectOsTimerResolution() time.Duration {
 
 func (b *Benchmark) tickerFunc(doneCh <-chan struct{}, outCh chan<- time.Time, forceTightTicker bool) {
 	timerRes := detectOsTimerResolution()
-	fmt.Printf("ExpectedInterval = %v, Detected OS timer resolution = %v\n", b.expectedInterval, timerRes)
+	slog.Info("Ticker", "expectedInterval", b.expectedInterval, "timerResolution", timerRes)
 	if timerRes*3 > b.expectedInterval {
-		fmt.Println("WARNING! Detected OS timer resolution may not be sufficient for desired request rate")
+		slog.Warn("Detected OS timer resolution may not be sufficient for desired request rate")
 	}
 
 	// let other go routines to start running
 	time.Sleep(200 * time.Millisecond)
 
 	if !forceTightTicker && b.expectedInterval >= 7*timerRes {
-		fmt.Println("Using sleeping ticker")
+		slog.Debug("Using sleeping ticker")
 		b.sleepingTicker(doneCh, outCh)
 	} else {
-		fmt.Println("Using tight ticker")
+		slog.Debug("Using tight ticker")
 		b.tightTicker(doneCh, outCh)
 	}
 }
@@ -213,18 +994,20 @@ func (b *Benchmark) tickerFunc(doneCh <-chan struct{}, outCh chan<- time.Time, f
 func (b *Benchmark) tightTicker(doneCh <-chan struct{}, outCh chan<- time.Time) {
 	start := time.Now()
 	lastTick := start
+	b.steadyStart = start.Add(b.rampUpDuration)
+	b.measureFrom = b.steadyStart.Add(b.warmUpDuration)
 
 	var (
 		timelyTicks uint64
 		missedTicks uint64
 	)
 
-	expectedInterval := b.expectedInterval
-	duration := b.duration
+	duration := b.rampUpDuration + b.duration
 
 _loop:
 	for {
 		var thisTick time.Time
+		expectedInterval := b.nextInterval(lastTick.Sub(start))
 
 	_wait:
 		for {
@@ -233,6 +1016,25 @@ _loop:
 				close(outCh)
 				break _loop
 
+			case <-b.abortCh:
+				close(outCh)
+				break _loop
+
+			case <-b.pause.notify:
+				var deadline <-chan time.Time
+				if !b.continuous && !b.excludePaused {
+					deadline = time.After(time.Until(start.Add(duration)))
+				}
+				paused, ok := b.waitPaused(doneCh, deadline)
+				if !ok {
+					close(outCh)
+					break _loop
+				}
+				lastTick = lastTick.Add(paused)
+				if b.excludePaused {
+					start = start.Add(paused)
+				}
+
 			default:
 				thisTick = time.Now()
 				if thisTick.Sub(lastTick) >= expectedInterval {
@@ -249,25 +1051,38 @@ _loop:
 			missedTicks++
 		}
 
-		if thisTick.Sub(start) > duration {
+		if !b.continuous && thisTick.Sub(start) > duration || b.reachedMaxRequests(timelyTicks) {
 			// log.Println("Signaling DONE")
 			close(outCh)
 			break
 		}
 	}
 
-	b.elapsed = time.Since(start)
+	b.elapsed = b.steadyElapsed(start)
 
 	b.timelyTicks = timelyTicks
 	b.missedTicks = missedTicks
 }
 
 func (b *Benchmark) sleepingTicker(doneCh <-chan struct{}, outCh chan<- time.Time) {
-	completion := time.After(b.duration)
+	start := time.Now()
 
-	inCh := time.Tick(b.expectedInterval)
+	// a nil channel never completes a continuous run
+	var (
+		completion *time.Timer
+		completed  <-chan time.Time
+	)
+	if !b.continuous {
+		completion = time.NewTimer(b.rampUpDuration + b.duration)
+		defer completion.Stop()
+		completed = completion.C
+	}
 
-	start := time.Now()
+	b.steadyStart = start.Add(b.rampUpDuration)
+	b.measureFrom = b.steadyStart.Add(b.warmUpDuration)
+	nextTick := start.Add(b.nextInterval(0))
+	inCh := time.NewTimer(time.Until(nextTick))
+	defer inCh.Stop()
 
 	var (
 		timelyTicks uint64
@@ -279,9 +1094,9 @@ func (b *Benchmark) sleepingTicker(doneCh <-chan struct{}, outCh chan<- time.Tim
 	timelyTicks++
 
 loop:
-	for {
+	for !b.reachedMaxRequests(timelyTicks) {
 		select {
-		case t := <-inCh:
+		case t := <-inCh.C:
 			select {
 			case outCh <- t:
 				timelyTicks++
@@ -289,31 +1104,82 @@ loop:
 				missedTicks++
 			}
 
-		case <-completion:
+			nextTick = nextTick.Add(b.nextInterval(nextTick.Sub(start)))
+			inCh.Reset(time.Until(nextTick))
+
+		case <-completed:
 			// log.Println("Signaling DONE")
-			close(outCh)
 			break loop
 
+		case <-b.pause.notify:
+			var deadline <-chan time.Time
+			if !b.excludePaused {
+				deadline = completed
+			}
+			paused, ok := b.waitPaused(doneCh, deadline)
+			if !ok {
+				break loop
+			}
+			// the schedule carries on where it was paused
+			nextTick = nextTick.Add(paused)
+			if !inCh.Stop() {
+				select {
+				case <-inCh.C:
+				default:
+				}
+			}
+			inCh.Reset(time.Until(nextTick))
+			if b.excludePaused {
+				start = start.Add(paused)
+				if completion != nil {
+					if !completion.Stop() {
+						select {
+						case <-completion.C:
+						default:
+						}
+					}
+					completion.Reset(time.Until(start.Add(b.rampUpDuration + b.duration)))
+				}
+			}
+
 		case <-doneCh:
-			close(outCh)
+			break loop
+
+		case <-b.abortCh:
 			break loop
 		}
 	}
+	close(outCh)
 
-	b.elapsed = time.Since(start)
+	b.elapsed = b.steadyElapsed(start)
 
 	b.timelyTicks = timelyTicks
 	b.missedTicks = missedTicks
 }
 
+// steadyElapsed returns the time the ticker has run since start, not counting
+// ramp-up unless the run was stopped before it finished.
+func (b *Benchmark) steadyElapsed(start time.Time) time.Duration {
+	elapsed := time.Since(start)
+	if elapsed > b.rampUpDuration {
+		elapsed -= b.rampUpDuration
+	}
+	return elapsed
+}
+
 func maybePanic(err error) {
 	if err != nil {
-		log.Panic(err)
+		panic(err)
 	}
 }
 
-func (b *Benchmark) worker(requester Requester, ticker <-chan time.Time, results chan<- int64, errors chan<- error) {
-	maybePanic(requester.Setup())
+func (b *Benchmark) worker(ctx context.Context, number uint64, requester Requester, ticker <-chan time.Time, results chan<- sample) {
+	contextRequester, _ := requester.(ContextRequester)
+
+	var rnd *rand.Rand
+	if b.thinkTime != nil {
+		rnd = rand.New(rand.NewSource(b.randomSeed + int64(number)))
+	}
 
 	// initialized to 0 by default
 	var (
@@ -321,16 +1187,32 @@ func (b *Benchmark) worker(requester Requester, ticker <-chan time.Time, results
 		timelySends  uint64
 		errorTotal   uint64
 		successTotal uint64
+		canceled     uint64
 	)
 
-	startTime := time.Now()
-
 	for tick := range ticker {
+		atomic.AddInt64(&b.inFlight, 1)
 		before := time.Now()
-		err := requester.Request()
+		var (
+			result Result
+			err    error
+		)
+		if contextRequester != nil {
+			result, err = contextRequester.RequestContext(ctx)
+		} else {
+			result, err = requester.Request()
+		}
 		latency := time.Since(before).Nanoseconds()
+		atomic.AddInt64(&b.inFlight, -1)
+
+		if err != nil && ctx.Err() != nil {
+			canceled++
+			continue
+		}
 
-		if before.Sub(startTime) < b.warmUpDuration {
+		// measureFrom is set by the ticker before the first tick
+		if before.Before(b.measureFrom) {
+			b.think(rnd)
 			continue
 		}
 
@@ -339,27 +1221,91 @@ func (b *Benchmark) worker(requester Requester, ticker <-chan time.Time, results
 		} else {
 			timelySends++
 		}
+
+		// On Linux, sometimes time interval measurement comes back negative, report it as 0
+		if latency < 0 {
+			latency = 0
+		}
+		step := -1
+		if b.stepHistograms != nil {
+			step = b.stepAt(before.Sub(b.steadyStart))
+		}
+		results <- sample{before, latency, result, err, step}
+
 		if err != nil {
 			errorTotal++
-			errors <- err
 		} else {
-			// On Linux, sometimes time interval measurement comes back negative, report it as 0
-			if latency < 0 {
-				latency = 0
-			}
-			results <- latency
 			successTotal++
 		}
+
+		b.backOff(result.RetryAfter)
+		b.think(rnd)
 	}
 
 	atomic.AddUint64(&b.lateSends, lateSends)
 	atomic.AddUint64(&b.timelySends, timelySends)
 	atomic.AddUint64(&b.errorTotal, errorTotal)
 	atomic.AddUint64(&b.successTotal, successTotal)
+	atomic.AddUint64(&b.canceledTotal, canceled)
 
 	err := requester.Teardown()
 	if err != nil {
-		log.Println("Failure in Teardown:", err)
+		slog.Warn("Failure in Teardown", "error", err)
+	}
+}
+
+// warmUpConnection opens the connection of a requester if it is among those
+// to warm up, failures are only logged as the requests may still succeed.
+func (b *Benchmark) warmUpConnection(number uint64, requester Requester) {
+	if number >= b.warmUpConns {
+		return
+	}
+	warmer, ok := requester.(ConnectionWarmer)
+	if !ok {
+		return
+	}
+
+	if err := warmer.WarmUpConnection(); err != nil {
+		slog.Debug("Connection warm-up failed", "connection", number, "error", err)
+		return
+	}
+	atomic.AddUint64(&b.warmedUpConns, 1)
+}
+
+// rateOver returns the rate of n events over the elapsed time in 1/s, zero if
+// no time elapsed.
+func rateOver(n uint64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(n) / elapsed.Seconds()
+}
+
+// think waits the think time of a connection, if any, or until the ticker stops.
+func (b *Benchmark) think(rnd *rand.Rand) {
+	if b.thinkTime == nil {
+		return
+	}
+
+	timer := time.NewTimer(b.thinkTime.next(rnd))
+	select {
+	case <-timer.C:
+	case <-b.stopThinking:
+		timer.Stop()
+	}
+}
+
+// backOff waits the RetryAfter of a result, or until the ticker stops.
+func (b *Benchmark) backOff(retryAfter time.Duration) {
+	if retryAfter <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(retryAfter)
+	select {
+	case <-timer.C:
+	case <-b.stopThinking:
+		timer.Stop()
 	}
 }
 
@@ -389,20 +1335,81 @@ func (b *Benchmark) summarize(outputJson bool) *Summary {
 		}
 	}
 
+	labelHistograms := make(map[string]*hdrhistogram.Histogram, len(b.labelHistograms))
+	for label, histogram := range b.labelHistograms {
+		labelHistograms[label] = hdrhistogram.Import(histogram.Export())
+	}
+
+	var (
+		uncorrected        *hdrhistogram.Histogram
+		uncorrectedLatency LatencyPercentiles
+	)
+	if b.uncorrected != nil {
+		uncorrected = hdrhistogram.Import(b.uncorrected.Export())
+		uncorrectedLatency = newLatencyPercentiles(b.uncorrected, b.percentiles)
+	}
+
+	stepHistograms := make([]*hdrhistogram.Histogram, len(b.stepHistograms))
+	for i, histogram := range b.stepHistograms {
+		stepHistograms[i] = hdrhistogram.Import(histogram.Export())
+	}
+
+	var connectionsOpened uint64
+	if counter, ok := b.factory.(ConnectionCounter); ok {
+		connectionsOpened = counter.ConnectionsOpened() - b.openedBefore
+	}
+
 	return &Summary{
-		SuccessTotal:     b.successTotal,
-		ErrorTotal:       b.errorTotal,
-		TimeElapsed:      b.elapsed,
-		SuccessHistogram: hdrhistogram.Import(b.successHistogram.Export()),
-		Throughput:       float64(b.successTotal+b.errorTotal) / b.elapsed.Seconds(),
-		AvgRequestTime:   b.avgRequestTime,
-		RequestRate:      b.requestRate,
-		Connections:      b.connections,
-		Errors:           formattedErrors,
-		TicksTimely:      b.timelyTicks,
-		TicksTimelyRatio: float64(b.timelyTicks) * 100 / float64(b.timelyTicks+b.missedTicks),
-		SendsTimely:      b.timelySends,
-		SendsTimelyRatio: float64(b.timelySends) * 100 / float64(b.timelySends+b.lateSends),
-		OutputJson:       outputJson,
+		SuccessTotal:         b.successTotal,
+		ErrorTotal:           b.errorTotal,
+		BytesSent:            b.bytesSent,
+		BytesReceived:        b.bytesReceived,
+		BytesDecompressed:    b.bytesDecoded,
+		RetriedTotal:         b.retriedTotal,
+		RateLimitedTotal:     b.rateLimitedTotal,
+		RetriesTotal:         b.retriesTotal,
+		OutOfRangeTotal:      b.outOfRangeTotal,
+		DroppedTotal:         b.missedTicks,
+		DrainAbortedTotal:    atomic.LoadUint64(&b.drainAborted),
+		TargetRate:           rateOver(b.timelyTicks+b.missedTicks, b.elapsed),
+		AchievedRate:         rateOver(b.timelyTicks, b.elapsed),
+		WarmedUpConnections:  b.warmedUpConns,
+		ConnectionWarmUpTime: b.warmUpTime,
+		AbortReason:          b.abortReason,
+		TimeElapsed:          b.elapsed,
+		SuccessHistogram:     hdrhistogram.Import(b.successHistogram.Export()),
+		Corrected:            b.correctLatency,
+		Uncorrected:          uncorrected,
+		FailureHistogram:     hdrhistogram.Import(b.failureHistogram.Export()),
+		TTFBHistogram:        hdrhistogram.Import(b.ttfbHistogram.Export()),
+		SizeHistogram:        hdrhistogram.Import(b.sizeHistogram.Export()),
+		LabelHistograms:      labelHistograms,
+		LoadSteps:            b.loadSteps,
+		StepHistograms:       stepHistograms,
+		StartTime:            b.measureFrom,
+		HistogramLog:         b.histogramLog,
+		Throughput:           float64(b.successTotal+b.errorTotal) / b.elapsed.Seconds(),
+		AvgRequestTime:       b.avgRequestTime,
+		RequestRate:          b.requestRate,
+		Connections:          b.connections,
+		ConnectionsOpened:    connectionsOpened,
+		ConnectionReuse:      b.connReuse.withRate(),
+		Errors:               formattedErrors,
+		ErrorCategories:      b.errorCategories,
+		StatusCodes:          b.statusCodes,
+		SuccessLatency:       newLatencyPercentiles(b.successHistogram, b.percentiles),
+		UncorrectedLatency:   uncorrectedLatency,
+		FailureLatency:       newLatencyPercentiles(b.failureHistogram, b.percentiles),
+		TTFBLatency:          newLatencyPercentiles(b.ttfbHistogram, b.percentiles),
+		DNSLatency:           newLatencyPercentiles(b.dnsHistogram, b.percentiles),
+		ConnectLatency:       newLatencyPercentiles(b.connectHistogram, b.percentiles),
+		TLSLatency:           newLatencyPercentiles(b.tlsHistogram, b.percentiles),
+		ResponseSize:         newPercentiles(b.sizeHistogram, b.percentiles, byteSize),
+		Percentiles:          b.percentiles,
+		TicksTimely:          b.timelyTicks,
+		TicksTimelyRatio:     float64(b.timelyTicks) * 100 / float64(b.timelyTicks+b.missedTicks),
+		SendsTimely:          b.timelySends,
+		SendsTimelyRatio:     float64(b.timelySends) * 100 / float64(b.timelySends+b.lateSends),
+		OutputJson:           outputJson,
 	}
 }
@@ -0,0 +1,314 @@
+package bench
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/codahale/hdrhistogram"
+)
+
+// ChartOptions are the axis ranges of PNG distributions. Zero values scale to
+// the data: the percentile axis goes up to the highest percentile the number
+// of values covers, between 99% and 99.9999%, and the value axis from zero to
+// the maximum. The latency range doesn't apply to size distributions.
+type ChartOptions struct {
+	MaxPercentile float64
+	MinLatency    time.Duration
+	MaxLatency    time.Duration
+}
+
+const (
+	chartWidth  = 1000
+	chartHeight = 600
+	// margins of the plot area, for the labels
+	chartLeft   = 90
+	chartRight  = 60
+	chartTop    = 50
+	chartBottom = 60
+	// fontScale enlarges the 5x7 glyphs of chartFont
+	fontScale = 2
+)
+
+var (
+	chartBackground = color.RGBA{255, 255, 255, 255}
+	chartAxis       = color.RGBA{60, 60, 60, 255}
+	chartGrid       = color.RGBA{225, 225, 225, 255}
+	chartCurve      = color.RGBA{31, 119, 180, 255}
+)
+
+// writePNGDistribution plots the value of the histogram by percentile like the
+// HdrHistogram plotter does, with the percentiles on a logarithmic scale of
+// 1/(1-percentile). The curve is sampled per pixel, so the percentiles of the
+// other formats don't apply.
+func writePNGDistribution(w io.Writer, histogram *hdrhistogram.Histogram, chart ChartOptions, unit valueUnit) error {
+	// decades of the percentile axis, 2 is up to 99%
+	decades := 2.0
+	if chart.MaxPercentile > 0 && chart.MaxPercentile < 100 {
+		decades = -math.Log10(1 - chart.MaxPercentile/100)
+	} else if count := histogram.TotalCount(); count > 0 {
+		decades = math.Max(2, math.Min(6, math.Ceil(math.Log10(float64(count)))))
+	}
+
+	plotWidth := chartWidth - chartLeft - chartRight
+	plotHeight := chartHeight - chartTop - chartBottom
+	values := make([]float64, plotWidth+1)
+	maxValue := 0.0
+	for x := range values {
+		percentile := 100 * (1 - math.Pow(10, -decades*float64(x)/float64(plotWidth)))
+		values[x] = float64(histogram.ValueAtQuantile(percentile)) / unit.scale
+		maxValue = math.Max(maxValue, values[x])
+	}
+
+	minValue := 0.0
+	if unit == milliseconds {
+		if chart.MinLatency > 0 {
+			minValue = float64(chart.MinLatency) / unit.scale
+		}
+		if chart.MaxLatency > 0 {
+			maxValue = float64(chart.MaxLatency) / unit.scale
+		}
+	}
+	step := niceStep((maxValue - minValue) / 5)
+	if maxValue <= minValue {
+		maxValue = minValue + step
+	}
+	if unit != milliseconds || chart.MaxLatency == 0 {
+		maxValue = minValue + math.Ceil((maxValue-minValue)/step)*step
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	fillRect(img, 0, 0, chartWidth, chartHeight, chartBackground)
+	toY := func(value float64) int {
+		return chartTop + plotHeight - int(math.Round((value-minValue)/(maxValue-minValue)*float64(plotHeight)))
+	}
+
+	// value grid and labels, with as many decimals as the step has
+	decimals := int(math.Max(0, -math.Floor(math.Log10(step))))
+	for i := 0; minValue+float64(i)*step <= maxValue+step/2; i++ {
+		value := minValue + float64(i)*step
+		y := toY(value)
+		drawLine(img, chartLeft, y, chartLeft+plotWidth, y, chartGrid)
+		label := strconv.FormatFloat(value, 'f', decimals, 64)
+		drawText(img, chartLeft-10-textWidth(label), y-3*fontScale, label, chartAxis)
+	}
+
+	// percentile grid and labels, a line per decade
+	for decade := 0; float64(decade) <= decades+1e-9; decade++ {
+		x := chartLeft + int(math.Round(float64(decade)/decades*float64(plotWidth)))
+		drawLine(img, x, chartTop, x, chartTop+plotHeight, chartGrid)
+		label := strconv.FormatFloat(100*(1-math.Pow(10, -float64(decade))), 'f', -1, 64) + "%"
+		drawText(img, x-textWidth(label)/2, chartTop+plotHeight+12, label, chartAxis)
+	}
+
+	drawLine(img, chartLeft, chartTop, chartLeft, chartTop+plotHeight, chartAxis)
+	drawLine(img, chartLeft, chartTop+plotHeight, chartLeft+plotWidth, chartTop+plotHeight, chartAxis)
+
+	// the curve is clipped to the value range, two pixels thick
+	clip := func(y int) int {
+		if y < chartTop {
+			return chartTop
+		}
+		if y > chartTop+plotHeight {
+			return chartTop + plotHeight
+		}
+		return y
+	}
+	for x := 1; x < len(values); x++ {
+		y0, y1 := clip(toY(values[x-1])), clip(toY(values[x]))
+		drawLine(img, chartLeft+x-1, y0, chartLeft+x, y1, chartCurve)
+		drawLine(img, chartLeft+x-1, y0-1, chartLeft+x, y1-1, chartCurve)
+	}
+
+	title := "Percentile Distribution (" + unit.name + ")"
+	drawText(img, (chartWidth-textWidth(title))/2, 15, title, chartAxis)
+	drawText(img, (chartWidth-textWidth("Percentile"))/2, chartHeight-22, "Percentile", chartAxis)
+
+	return png.Encode(w, img)
+}
+
+// niceStep rounds a step of the value axis to 1, 2 or 5 times a power of ten.
+func niceStep(step float64) float64 {
+	if step <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(step)))
+	switch fraction := step / magnitude; {
+	case fraction <= 1:
+		return magnitude
+	case fraction <= 2:
+		return 2 * magnitude
+	case fraction <= 5:
+		return 5 * magnitude
+	}
+	return 10 * magnitude
+}
+
+func fillRect(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
+
+// drawLine draws a line with Bresenham's algorithm.
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		img.SetRGBA(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func textWidth(text string) int {
+	return len(text) * 6 * fontScale
+}
+
+// drawText draws text with chartFont.
+func drawText(img *image.RGBA, x, y int, text string, c color.RGBA) {
+	for _, r := range text {
+		glyph, ok := chartFont[r]
+		if !ok {
+			glyph = chartFont['?']
+		}
+		for row, line := range glyph {
+			for col, pixel := range line {
+				if pixel == '#' {
+					fillRect(img, x+col*fontScale, y+row*fontScale, x+(col+1)*fontScale, y+(row+1)*fontScale, c)
+				}
+			}
+		}
+		x += 6 * fontScale
+	}
+}
+
+// chartFont has 5x7 glyphs of the printable ASCII characters, so that charts
+// need no font files. Other characters are drawn as ?.
+var chartFont = map[rune][7]string{
+	' ':  {"     ", "     ", "     ", "     ", "     ", "     ", "     "},
+	'!':  {"  #  ", "  #  ", "  #  ", "  #  ", "  #  ", "     ", "  #  "},
+	'"':  {" # # ", " # # ", "     ", "     ", "     ", "     ", "     "},
+	'#':  {" # # ", " # # ", "#####", " # # ", "#####", " # # ", " # # "},
+	'$':  {"  #  ", " ####", "# #  ", " ### ", "  # #", "#### ", "  #  "},
+	'%':  {"##   ", "##  #", "   # ", "  #  ", " #   ", "#  ##", "   ##"},
+	'&':  {" ##  ", "#  # ", "# #  ", " #   ", "# # #", "#  # ", " ## #"},
+	'\'': {"  #  ", "  #  ", "     ", "     ", "     ", "     ", "     "},
+	'(':  {"   # ", "  #  ", " #   ", " #   ", " #   ", "  #  ", "   # "},
+	')':  {" #   ", "  #  ", "   # ", "   # ", "   # ", "  #  ", " #   "},
+	'*':  {"     ", "  #  ", "# # #", " ### ", "# # #", "  #  ", "     "},
+	'+':  {"     ", "  #  ", "  #  ", "#####", "  #  ", "  #  ", "     "},
+	',':  {"     ", "     ", "     ", "     ", " ##  ", "  #  ", " #   "},
+	'-':  {"     ", "     ", "     ", "#####", "     ", "     ", "     "},
+	'.':  {"     ", "     ", "     ", "     ", "     ", " ##  ", " ##  "},
+	'/':  {"     ", "    #", "   # ", "  #  ", " #   ", "#    ", "     "},
+	'0':  {" ### ", "#   #", "#  ##", "# # #", "##  #", "#   #", " ### "},
+	'1':  {"  #  ", " ##  ", "  #  ", "  #  ", "  #  ", "  #  ", " ### "},
+	'2':  {" ### ", "#   #", "    #", "   # ", "  #  ", " #   ", "#####"},
+	'3':  {"#####", "   # ", "  #  ", "   # ", "    #", "#   #", " ### "},
+	'4':  {"   # ", "  ## ", " # # ", "#  # ", "#####", "   # ", "   # "},
+	'5':  {"#####", "#    ", "#### ", "    #", "    #", "#   #", " ### "},
+	'6':  {"  ## ", " #   ", "#    ", "#### ", "#   #", "#   #", " ### "},
+	'7':  {"#####", "    #", "   # ", "  #  ", " #   ", " #   ", " #   "},
+	'8':  {" ### ", "#   #", "#   #", " ### ", "#   #", "#   #", " ### "},
+	'9':  {" ### ", "#   #", "#   #", " ####", "    #", "   # ", " ##  "},
+	':':  {"     ", " ##  ", " ##  ", "     ", " ##  ", " ##  ", "     "},
+	';':  {"     ", " ##  ", " ##  ", "     ", " ##  ", "  #  ", " #   "},
+	'<':  {"   # ", "  #  ", " #   ", "#    ", " #   ", "  #  ", "   # "},
+	'=':  {"     ", "     ", "#####", "     ", "#####", "     ", "     "},
+	'>':  {" #   ", "  #  ", "   # ", "    #", "   # ", "  #  ", " #   "},
+	'?':  {" ### ", "#   #", "    #", "   # ", "  #  ", "     ", "  #  "},
+	'@':  {" ### ", "#   #", "    #", " ## #", "# # #", "# # #", " ### "},
+	'A':  {" ### ", "#   #", "#   #", "#####", "#   #", "#   #", "#   #"},
+	'B':  {"#### ", "#   #", "#   #", "#### ", "#   #", "#   #", "#### "},
+	'C':  {" ### ", "#   #", "#    ", "#    ", "#    ", "#   #", " ### "},
+	'D':  {"#### ", "#   #", "#   #", "#   #", "#   #", "#   #", "#### "},
+	'E':  {"#####", "#    ", "#    ", "#### ", "#    ", "#    ", "#####"},
+	'F':  {"#####", "#    ", "#    ", "#### ", "#    ", "#    ", "#    "},
+	'G':  {" ### ", "#   #", "#    ", "# ###", "#   #", "#   #", " ####"},
+	'H':  {"#   #", "#   #", "#   #", "#####", "#   #", "#   #", "#   #"},
+	'I':  {" ### ", "  #  ", "  #  ", "  #  ", "  #  ", "  #  ", " ### "},
+	'J':  {"  ###", "   # ", "   # ", "   # ", "   # ", "#  # ", " ##  "},
+	'K':  {"#   #", "#  # ", "# #  ", "##   ", "# #  ", "#  # ", "#   #"},
+	'L':  {"#    ", "#    ", "#    ", "#    ", "#    ", "#    ", "#####"},
+	'M':  {"#   #", "## ##", "# # #", "# # #", "#   #", "#   #", "#   #"},
+	'N':  {"#   #", "#   #", "##  #", "# # #", "#  ##", "#   #", "#   #"},
+	'O':  {" ### ", "#   #", "#   #", "#   #", "#   #", "#   #", " ### "},
+	'P':  {"#### ", "#   #", "#   #", "#### ", "#    ", "#    ", "#    "},
+	'Q':  {" ### ", "#   #", "#   #", "#   #", "# # #", "#  # ", " ## #"},
+	'R':  {"#### ", "#   #", "#   #", "#### ", "# #  ", "#  # ", "#   #"},
+	'S':  {" ####", "#    ", "#    ", " ### ", "    #", "    #", "#### "},
+	'T':  {"#####", "  #  ", "  #  ", "  #  ", "  #  ", "  #  ", "  #  "},
+	'U':  {"#   #", "#   #", "#   #", "#   #", "#   #", "#   #", " ### "},
+	'V':  {"#   #", "#   #", "#   #", "#   #", "#   #", " # # ", "  #  "},
+	'W':  {"#   #", "#   #", "#   #", "# # #", "# # #", "# # #", " # # "},
+	'X':  {"#   #", "#   #", " # # ", "  #  ", " # # ", "#   #", "#   #"},
+	'Y':  {"#   #", "#   #", "#   #", " # # ", "  #  ", "  #  ", "  #  "},
+	'Z':  {"#####", "    #", "   # ", "  #  ", " #   ", "#    ", "#####"},
+	'[':  {" ### ", " #   ", " #   ", " #   ", " #   ", " #   ", " ### "},
+	'\\': {"     ", "#    ", " #   ", "  #  ", "   # ", "    #", "     "},
+	']':  {" ### ", "   # ", "   # ", "   # ", "   # ", "   # ", " ### "},
+	'^':  {"  #  ", " # # ", "#   #", "     ", "     ", "     ", "     "},
+	'_':  {"     ", "     ", "     ", "     ", "     ", "     ", "#####"},
+	'`':  {" #   ", "  #  ", "     ", "     ", "     ", "     ", "     "},
+	'a':  {"     ", "     ", " ### ", "    #", " ####", "#   #", " ####"},
+	'b':  {"#    ", "#    ", "# ## ", "##  #", "#   #", "#   #", "#### "},
+	'c':  {"     ", "     ", " ### ", "#    ", "#    ", "#   #", " ### "},
+	'd':  {"    #", "    #", " ## #", "#  ##", "#   #", "#   #", " ####"},
+	'e':  {"     ", "     ", " ### ", "#   #", "#####", "#    ", " ### "},
+	'f':  {"  ## ", " #  #", " #   ", "###  ", " #   ", " #   ", " #   "},
+	'g':  {"     ", " ####", "#   #", "#   #", " ####", "    #", " ### "},
+	'h':  {"#    ", "#    ", "# ## ", "##  #", "#   #", "#   #", "#   #"},
+	'i':  {"  #  ", "     ", " ##  ", "  #  ", "  #  ", "  #  ", " ### "},
+	'j':  {"   # ", "     ", "  ## ", "   # ", "   # ", "#  # ", " ##  "},
+	'k':  {"#    ", "#    ", "#  # ", "# #  ", "##   ", "# #  ", "#  # "},
+	'l':  {" ##  ", "  #  ", "  #  ", "  #  ", "  #  ", "  #  ", " ### "},
+	'm':  {"     ", "     ", "## # ", "# # #", "# # #", "#   #", "#   #"},
+	'n':  {"     ", "     ", "# ## ", "##  #", "#   #", "#   #", "#   #"},
+	'o':  {"     ", "     ", " ### ", "#   #", "#   #", "#   #", " ### "},
+	'p':  {"     ", "     ", "#### ", "#   #", "#### ", "#    ", "#    "},
+	'q':  {"     ", "     ", " ## #", "#  ##", " ####", "    #", "    #"},
+	'r':  {"     ", "     ", "# ## ", "##  #", "#    ", "#    ", "#    "},
+	's':  {"     ", "     ", " ####", "#    ", " ### ", "    #", "#### "},
+	't':  {" #   ", " #   ", "###  ", " #   ", " #   ", " #  #", "  ## "},
+	'u':  {"     ", "     ", "#   #", "#   #", "#   #", "#  ##", " ## #"},
+	'v':  {"     ", "     ", "#   #", "#   #", "#   #", " # # ", "  #  "},
+	'w':  {"     ", "     ", "#   #", "#   #", "# # #", "# # #", " # # "},
+	'x':  {"     ", "     ", "#   #", " # # ", "  #  ", " # # ", "#   #"},
+	'y':  {"     ", "     ", "#   #", "#   #", " ####", "    #", " ### "},
+	'z':  {"     ", "     ", "#####", "   # ", "  #  ", " #   ", "#####"},
+	'{':  {"   # ", "  #  ", "  #  ", " #   ", "  #  ", "  #  ", "   # "},
+	'|':  {"  #  ", "  #  ", "  #  ", "  #  ", "  #  ", "  #  ", "  #  "},
+	'}':  {" #   ", "  #  ", "  #  ", "   # ", "  #  ", "  #  ", " #   "},
+	'~':  {"     ", "     ", " #   ", "# # #", "   # ", "     ", "     "},
+}
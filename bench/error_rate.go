@@ -0,0 +1,74 @@
+package bench
+
+import "time"
+
+// errorRateBuckets is the number of buckets a window of errorRateWindow is
+// split into, it rolls forward a bucket at a time.
+const errorRateBuckets = 10
+
+// errorRateWindow tracks the error rate of the requests completed over a
+// rolling window of time.
+type errorRateWindow struct {
+	bucketLength time.Duration
+	// bucket ids are the number of bucket lengths since the start of measurement
+	ids     [errorRateBuckets]int64
+	totals  [errorRateBuckets]uint64
+	errors  [errorRateBuckets]uint64
+	current int64
+}
+
+func newErrorRateWindow(window time.Duration) *errorRateWindow {
+	w := &errorRateWindow{bucketLength: window / errorRateBuckets}
+	if w.bucketLength <= 0 {
+		w.bucketLength = 1
+	}
+	for i := range w.ids {
+		w.ids[i] = -1
+	}
+	return w
+}
+
+// add counts a request completed at the given time since the start of
+// measurement.
+func (w *errorRateWindow) add(completed time.Duration, failed bool) {
+	id := int64(completed / w.bucketLength)
+	if id < 0 {
+		id = 0
+	}
+	if id > w.current {
+		w.current = id
+	}
+
+	i := id % errorRateBuckets
+	if w.ids[i] != id {
+		if w.ids[i] > id {
+			// too late for the window
+			return
+		}
+		w.ids[i], w.totals[i], w.errors[i] = id, 0, 0
+	}
+	w.totals[i]++
+	if failed {
+		w.errors[i]++
+	}
+}
+
+// rate returns the error rate over the window ending with the latest bucket
+// in percent, and false until the first window is complete.
+func (w *errorRateWindow) rate() (float64, bool) {
+	if w.current < errorRateBuckets {
+		return 0, false
+	}
+
+	var total, errors uint64
+	for i, id := range w.ids {
+		if id > w.current-errorRateBuckets {
+			total += w.totals[i]
+			errors += w.errors[i]
+		}
+	}
+	if total == 0 {
+		return 0, false
+	}
+	return float64(errors) / float64(total) * 100, true
+}
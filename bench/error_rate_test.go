@@ -0,0 +1,92 @@
+package bench
+
+import (
+	"testing"
+	"time"
+)
+
+func TestErrorRateWindow(t *testing.T) {
+	type sample struct {
+		at     time.Duration
+		failed bool
+	}
+	// everySecond is a request completed each second from..to, failed or not.
+	everySecond := func(from, to int, failed bool) []sample {
+		var samples []sample
+		for second := from; second <= to; second++ {
+			samples = append(samples, sample{time.Duration(second) * time.Second, failed})
+		}
+		return samples
+	}
+	join := func(parts ...[]sample) []sample {
+		var samples []sample
+		for _, part := range parts {
+			samples = append(samples, part...)
+		}
+		return samples
+	}
+
+	tests := []struct {
+		name    string
+		samples []sample
+		rate    float64
+		ok      bool
+	}{
+		{
+			name: "no requests",
+		},
+		{
+			name:    "window not complete",
+			samples: everySecond(0, 9, true),
+		},
+		{
+			name:    "window complete",
+			samples: join(everySecond(0, 5, false), everySecond(6, 7, true), everySecond(8, 10, false)),
+			rate:    20,
+			ok:      true,
+		},
+		{
+			name:    "oldest bucket left out",
+			samples: join(everySecond(0, 0, true), everySecond(1, 10, false)),
+			rate:    0,
+			ok:      true,
+		},
+		{
+			name:    "rolled forward",
+			samples: join(everySecond(0, 10, true), everySecond(11, 20, false)),
+			rate:    0,
+			ok:      true,
+		},
+		{
+			name:    "late within the window",
+			samples: join(everySecond(0, 13, false), everySecond(4, 13, true)),
+			rate:    50,
+			ok:      true,
+		},
+		{
+			name:    "too late for the window",
+			samples: join(everySecond(0, 20, false), []sample{{3 * time.Second, true}}),
+			rate:    0,
+			ok:      true,
+		},
+		{
+			name:    "gap in the requests",
+			samples: join(everySecond(0, 3, true), []sample{{30 * time.Second, false}, {30 * time.Second, true}}),
+			rate:    50,
+			ok:      true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := newErrorRateWindow(10 * time.Second)
+			for _, sample := range test.samples {
+				w.add(sample.at, sample.failed)
+			}
+			rate, ok := w.rate()
+			if rate != test.rate || ok != test.ok {
+				t.Errorf("got %v, %v, want %v, %v", rate, ok, test.rate, test.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package bench
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/codahale/hdrhistogram"
+)
+
+// DistributionFormat is a file format of latency distributions generated by
+// GenerateLatencyDistribution.
+type DistributionFormat string
+
+const (
+	// HGRM is the percentile distribution format of HdrHistogram, plottable by
+	// http://hdrhistogram.github.io/HdrHistogram/plotFiles.html.
+	HGRM DistributionFormat = "HGRM"
+
+	// CSV has a header line and Percentile, Value (ms) and Count columns,
+	// where Count is the number of requests at or below the value.
+	CSV DistributionFormat = "CSV"
+
+	// HLOG is the interval log format of HdrHistogram, as written by wrk2 and
+	// read by HistogramLogProcessor and other HdrHistogram tooling.
+	HLOG DistributionFormat = "HLOG"
+
+	// PNG is a chart of the distribution for people, like the HdrHistogram
+	// plotter draws it, scaled by the Chart of the Summary.
+	PNG DistributionFormat = "PNG"
+)
+
+// DistributionFormats lists all supported distribution formats.
+var DistributionFormats = []DistributionFormat{HGRM, CSV, HLOG, PNG}
+
+// ParseDistributionFormat returns the distribution format by its case
+// insensitive name. An empty name is HGRM.
+func ParseDistributionFormat(name string) (DistributionFormat, error) {
+	if name == "" {
+		return HGRM, nil
+	}
+
+	for _, format := range DistributionFormats {
+		if strings.EqualFold(name, string(format)) {
+			return format, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown distribution format %q, supported formats are %v", name, DistributionFormats)
+}
+
+// Extension returns the usual file name extension of the format.
+func (f DistributionFormat) Extension() string {
+	return "." + strings.ToLower(string(f))
+}
+
+// valueUnit is the unit values of histograms are written in, they are divided
+// by scale, latencies are recorded in nanoseconds.
+type valueUnit struct {
+	name  string
+	scale float64
+}
+
+var (
+	milliseconds = valueUnit{"ms", 1000000}
+	byteSize     = valueUnit{"bytes", 1}
+)
+
+func writeDistribution(w io.Writer, histogram *hdrhistogram.Histogram, percentiles Percentiles, format DistributionFormat, chart ChartOptions, unit valueUnit) error {
+	switch format {
+	case CSV:
+		return writeCSVDistribution(w, histogram, percentiles, unit)
+	case PNG:
+		return writePNGDistribution(w, histogram, chart, unit)
+	default:
+		return writeHGRMDistribution(w, histogram, percentiles, unit)
+	}
+}
+
+// hgrmHistogramPrefix starts the footer line of HGRM files holding the
+// histogram itself, in the compressed encoding of HdrHistogram, so that files
+// can be merged exactly. Plotters skip it like the other # lines.
+const hgrmHistogramPrefix = "#[Histogram: "
+
+// ReadHistogram reads a histogram back from a distribution file in the HGRM
+// or HLOG format. The intervals of HLOG are summed.
+func ReadHistogram(file string, format DistributionFormat) (*hdrhistogram.Histogram, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var histograms []*hdrhistogram.Histogram
+	switch format {
+	case HGRM:
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 16*1024*1024)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, hgrmHistogramPrefix) {
+				histogram, err := decodeCompressedHistogram(strings.TrimSuffix(strings.TrimPrefix(line, hgrmHistogramPrefix), "]"))
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", file, err)
+				}
+				histograms = append(histograms, histogram)
+			}
+		}
+		if err = scanner.Err(); err != nil {
+			return nil, err
+		}
+	case HLOG:
+		histograms, err = readHistogramLog(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: %s files do not hold histograms", file, format)
+	}
+
+	if len(histograms) == 0 {
+		return nil, fmt.Errorf("%s holds no histogram, it may have been written by an older version", file)
+	}
+
+	merged := histograms[0]
+	for _, histogram := range histograms[1:] {
+		if dropped := merged.Merge(histogram); dropped > 0 {
+			return nil, fmt.Errorf("%s: %d values are out of the range of the histogram", file, dropped)
+		}
+	}
+	return merged, nil
+}
+
+// WriteDistribution writes a histogram to a file in the HGRM, CSV or PNG
+// format, as GenerateLatencyDistribution does. PNG charts are auto-scaled.
+func WriteDistribution(histogram *hdrhistogram.Histogram, format DistributionFormat, percentiles Percentiles, file string) error {
+	if format == HLOG {
+		return fmt.Errorf("a single histogram cannot be written as %s", format)
+	}
+	if percentiles == nil {
+		percentiles = Logarithmic
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return writeDistribution(f, histogram, percentiles, format, ChartOptions{}, milliseconds)
+}
+
+func writeHGRMDistribution(w io.Writer, histogram *hdrhistogram.Histogram, percentiles Percentiles, unit valueUnit) error {
+	_, err := io.WriteString(w, "Value    Percentile    TotalCount    1/(1-Percentile)\n\n")
+	if err != nil {
+		return err
+	}
+
+	for _, percentile := range percentiles {
+		value := float64(histogram.ValueAtQuantile(percentile)) / unit.scale
+		_, err := fmt.Fprintf(w, "%f    %f        %d            %f\n",
+			value, percentile/100, 0, 1/(1-(percentile/100)))
+		if err != nil {
+			return err
+		}
+	}
+
+	encoded, err := encodeCompressedHistogram(histogram)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s]\n", hgrmHistogramPrefix, encoded)
+	return err
+}
+
+func writeCSVDistribution(w io.Writer, histogram *hdrhistogram.Histogram, percentiles Percentiles, unit valueUnit) error {
+	_, err := fmt.Fprintf(w, "Percentile,Value (%s),Count\n", unit.name)
+	if err != nil {
+		return err
+	}
+
+	total := float64(histogram.TotalCount())
+	for _, percentile := range percentiles {
+		value := float64(histogram.ValueAtQuantile(percentile)) / unit.scale
+		count := int64(math.Round(total * percentile / 100))
+		_, err := fmt.Fprintf(w, "%g,%f,%d\n", percentile, value, count)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
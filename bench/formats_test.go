@@ -0,0 +1,135 @@
+package bench
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codahale/hdrhistogram"
+)
+
+func newTestHistogram(t *testing.T, latencies ...time.Duration) *hdrhistogram.Histogram {
+	histogram := hdrhistogram.New(1, int64(time.Minute), 3)
+	for _, latency := range latencies {
+		if err := histogram.RecordValue(int64(latency)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return histogram
+}
+
+func TestReadHistogramHGRM(t *testing.T) {
+	tests := []struct {
+		name string
+		// files holds the histograms of each HGRM file, several in a file as
+		// files appended to each other
+		files [][][]time.Duration
+	}{
+		{
+			name:  "single file",
+			files: [][][]time.Duration{{{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond}}},
+		},
+		{
+			name: "merged files",
+			files: [][][]time.Duration{
+				{{time.Millisecond, 5 * time.Millisecond}},
+				{{2 * time.Millisecond, time.Second}},
+				{{7 * time.Millisecond}},
+			},
+		},
+		{
+			name:  "histograms in one file",
+			files: [][][]time.Duration{{{time.Millisecond}, {3 * time.Millisecond, 40 * time.Second}}},
+		},
+		{
+			name:  "empty histogram",
+			files: [][][]time.Duration{{{}}, {{10 * time.Millisecond}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			expected := newTestHistogram(t)
+			var merged *hdrhistogram.Histogram
+			for i, histograms := range test.files {
+				var content []string
+				for j, latencies := range histograms {
+					file := filepath.Join(dir, "part.hgrm")
+					err := WriteDistribution(newTestHistogram(t, latencies...), HGRM, nil, file)
+					if err != nil {
+						t.Fatalf("file %d, histogram %d: %v", i, j, err)
+					}
+					part, err := ioutil.ReadFile(file)
+					if err != nil {
+						t.Fatal(err)
+					}
+					content = append(content, string(part))
+					expected.Merge(newTestHistogram(t, latencies...))
+				}
+
+				file := filepath.Join(dir, "result.hgrm")
+				if err := ioutil.WriteFile(file, []byte(strings.Join(content, "")), 0644); err != nil {
+					t.Fatal(err)
+				}
+				histogram, err := ReadHistogram(file, HGRM)
+				if err != nil {
+					t.Fatalf("file %d: %v", i, err)
+				}
+				if merged == nil {
+					merged = histogram
+				} else if dropped := merged.Merge(histogram); dropped != 0 {
+					t.Fatalf("file %d: %d values dropped", i, dropped)
+				}
+			}
+
+			if !merged.Equals(expected) {
+				t.Errorf("got %d requests up to %d ns, want %d up to %d ns",
+					merged.TotalCount(), merged.Max(), expected.TotalCount(), expected.Max())
+			}
+		})
+	}
+}
+
+func TestReadHistogramErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		format  DistributionFormat
+		err     string
+	}{
+		{
+			name:    "no histogram",
+			content: "Value    Percentile    TotalCount    1/(1-Percentile)\n\n1.000000    0.500000        0            2.000000\n",
+			format:  HGRM,
+			err:     "holds no histogram",
+		},
+		{
+			name:    "corrupt histogram",
+			content: hgrmHistogramPrefix + "not base64]\n",
+			format:  HGRM,
+			err:     "result",
+		},
+		{
+			name:    "CSV",
+			content: "Percentile,Value (ms),Count\n50,1.000000,1\n",
+			format:  CSV,
+			err:     "do not hold histograms",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "result")
+			if err := ioutil.WriteFile(file, []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ReadHistogram(file, test.format)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got %v, want an error of %q", err, test.err)
+			}
+		})
+	}
+}
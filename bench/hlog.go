@@ -0,0 +1,228 @@
+package bench
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/codahale/hdrhistogram"
+)
+
+const (
+	// cookies of the V2 encoding of HdrHistogram, as read by its Java, C and
+	// Go implementations and so by wrk2 tooling.
+	encodingCookieV2           = 0x1c849303 | 0x10
+	compressedEncodingCookieV2 = 0x1c849304 | 0x10
+	encodingHeaderSize         = 40
+)
+
+// HistogramLogInterval is an interval record of an HdrHistogram log, holding
+// the latency of the successful requests completed in the interval.
+type HistogramLogInterval struct {
+	// Start is the start of the interval since the start of measurement.
+	Start  time.Duration
+	Length time.Duration
+	Max    time.Duration
+	// Histogram is the latency histogram in the compressed V2 encoding of
+	// HdrHistogram, in base64.
+	Histogram string
+}
+
+// newHistogramLogInterval encodes a histogram as the record of an interval.
+func newHistogramLogInterval(histogram *hdrhistogram.Histogram, start, length time.Duration) (HistogramLogInterval, error) {
+	encoded, err := encodeCompressedHistogram(histogram)
+	if err != nil {
+		return HistogramLogInterval{}, err
+	}
+
+	var max time.Duration
+	if histogram.TotalCount() > 0 {
+		max = time.Duration(histogram.Max())
+	}
+
+	return HistogramLogInterval{Start: start, Length: length, Max: max, Histogram: encoded}, nil
+}
+
+// encodeCompressedHistogram returns the histogram in the compressed V2
+// encoding of HdrHistogram, in base64 as it appears in .hlog files.
+func encodeCompressedHistogram(histogram *hdrhistogram.Histogram) (string, error) {
+	snapshot := histogram.Export()
+
+	// counts are written up to the last non-zero one, runs of zeros as their negated length
+	last := len(snapshot.Counts) - 1
+	for last >= 0 && snapshot.Counts[last] == 0 {
+		last--
+	}
+
+	var payload []byte
+	varint := make([]byte, binary.MaxVarintLen64)
+	for i := 0; i <= last; {
+		count := snapshot.Counts[i]
+		i++
+		if count == 0 {
+			zeros := int64(1)
+			for i <= last && snapshot.Counts[i] == 0 {
+				zeros++
+				i++
+			}
+			if zeros > 1 {
+				count = -zeros
+			}
+		}
+		// zig-zag LEB128, as PutVarint writes it
+		payload = append(payload, varint[:binary.PutVarint(varint, count)]...)
+	}
+
+	encoded := make([]byte, encodingHeaderSize, encodingHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(encoded[0:], encodingCookieV2)
+	binary.BigEndian.PutUint32(encoded[4:], uint32(len(payload)))
+	// normalizing index offset is always 0
+	binary.BigEndian.PutUint32(encoded[12:], uint32(snapshot.SignificantFigures))
+	binary.BigEndian.PutUint64(encoded[16:], uint64(snapshot.LowestTrackableValue))
+	binary.BigEndian.PutUint64(encoded[24:], uint64(snapshot.HighestTrackableValue))
+	// integer to double value conversion ratio
+	binary.BigEndian.PutUint64(encoded[32:], math.Float64bits(1))
+	encoded = append(encoded, payload...)
+
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	if _, err := writer.Write(encoded); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	record := make([]byte, 8, 8+compressed.Len())
+	binary.BigEndian.PutUint32(record[0:], compressedEncodingCookieV2)
+	binary.BigEndian.PutUint32(record[4:], uint32(compressed.Len()))
+	record = append(record, compressed.Bytes()...)
+
+	return base64.StdEncoding.EncodeToString(record), nil
+}
+
+// decodeCompressedHistogram decodes a histogram in the compressed V2 encoding
+// of HdrHistogram, in base64.
+func decodeCompressedHistogram(encoded string) (*hdrhistogram.Histogram, error) {
+	record, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(record) < 8 || binary.BigEndian.Uint32(record) != compressedEncodingCookieV2 {
+		return nil, errors.New("histogram is not in the compressed V2 encoding")
+	}
+	length := binary.BigEndian.Uint32(record[4:])
+	if int64(length) > int64(len(record)-8) {
+		return nil, errors.New("histogram is truncated")
+	}
+
+	reader, err := zlib.NewReader(bytes.NewReader(record[8 : 8+length]))
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(decoded) < encodingHeaderSize || binary.BigEndian.Uint32(decoded) != encodingCookieV2 {
+		return nil, errors.New("histogram is not in the V2 encoding")
+	}
+	payloadLength := binary.BigEndian.Uint32(decoded[4:])
+	if binary.BigEndian.Uint32(decoded[8:]) != 0 {
+		return nil, errors.New("histograms with a normalizing index offset are not supported")
+	}
+	snapshot := &hdrhistogram.Snapshot{
+		SignificantFigures:    int64(binary.BigEndian.Uint32(decoded[12:])),
+		LowestTrackableValue:  int64(binary.BigEndian.Uint64(decoded[16:])),
+		HighestTrackableValue: int64(binary.BigEndian.Uint64(decoded[24:])),
+	}
+	if int64(payloadLength) > int64(len(decoded)-encodingHeaderSize) {
+		return nil, errors.New("histogram is truncated")
+	}
+	payload := decoded[encodingHeaderSize : encodingHeaderSize+payloadLength]
+
+	// Import takes counts of the full length for the range and precision
+	snapshot.Counts = hdrhistogram.New(snapshot.LowestTrackableValue, snapshot.HighestTrackableValue, int(snapshot.SignificantFigures)).Export().Counts
+	for i := 0; len(payload) > 0; {
+		count, n := binary.Varint(payload)
+		if n <= 0 {
+			return nil, errors.New("histogram has an invalid count")
+		}
+		payload = payload[n:]
+
+		if count < 0 {
+			i += int(-count)
+			continue
+		}
+		if i >= len(snapshot.Counts) {
+			return nil, errors.New("histogram has counts beyond its range")
+		}
+		snapshot.Counts[i] = count
+		i++
+	}
+
+	return hdrhistogram.Import(snapshot), nil
+}
+
+// readHistogramLog returns the histograms of the intervals of an HdrHistogram log.
+func readHistogramLog(r io.Reader) ([]*hdrhistogram.Histogram, error) {
+	var histograms []*hdrhistogram.Histogram
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "\"") {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		if strings.HasPrefix(fields[0], "Tag=") {
+			fields = fields[1:]
+		}
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("invalid interval record %q", line)
+		}
+
+		histogram, err := decodeCompressedHistogram(fields[3])
+		if err != nil {
+			return nil, err
+		}
+		histograms = append(histograms, histogram)
+	}
+
+	return histograms, scanner.Err()
+}
+
+// writeHistogramLog writes interval records in the log format 1.3 of
+// HdrHistogram, with interval max in the unit.
+func writeHistogramLog(w io.Writer, startTime time.Time, intervals []HistogramLogInterval, unit valueUnit) error {
+	startSec := float64(startTime.UnixNano()) / 1e9
+	_, err := fmt.Fprintf(w, "#[Histogram log format version 1.3]\n"+
+		"#[StartTime: %.3f (seconds since epoch), %s]\n"+
+		"#[BaseTime: %.3f (seconds since epoch)]\n"+
+		"\"StartTimestamp\",\"Interval_Length\",\"Interval_Max\",\"Interval_Compressed_Histogram\"\n",
+		startSec, startTime.Format(time.UnixDate), startSec)
+	if err != nil {
+		return err
+	}
+
+	for _, interval := range intervals {
+		_, err := fmt.Fprintf(w, "%.3f,%.3f,%.3f,%s\n",
+			interval.Start.Seconds(), interval.Length.Seconds(), float64(interval.Max)/unit.scale, interval.Histogram)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,249 @@
+package bench
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// htmlRow is a row of a table of the HTML report.
+type htmlRow struct {
+	Name    string
+	Value   string
+	Percent string
+}
+
+// htmlData is what the report template renders.
+type htmlData struct {
+	Started      string
+	Elapsed      string
+	Labels       string
+	AbortReason  string
+	Metrics      []htmlRow
+	Latency      []htmlRow
+	StatusCodes  []htmlRow
+	Errors       []htmlRow
+	SLA          []SLACheck
+	LatencyChart template.URL
+	Throughput   template.HTML
+}
+
+// WriteHTML writes a standalone HTML report of the Summary to a file, for
+// sharing the results of a run: the metrics, latency percentiles, status
+// codes and errors as tables, the latency chart of the PNG format inlined
+// and the throughput over time, if the Summary has a HistogramLog.
+func (s *Summary) WriteHTML(file string) error {
+	report := s.Report()
+	data := htmlData{
+		Started:     s.StartTime.UTC().Format(time.RFC1123),
+		Elapsed:     s.TimeElapsed.Round(time.Millisecond).String(),
+		Labels:      formatLabels(s.Labels),
+		AbortReason: s.AbortReason,
+		SLA:         s.SLA,
+	}
+
+	data.Metrics = []htmlRow{
+		{"Total Requests", strconv.FormatUint(report.RequestTotal, 10), ""},
+		{"Successful Requests", strconv.FormatUint(report.SuccessTotal, 10), formatPercent(report.SuccessRate)},
+		{"Failed Requests", strconv.FormatUint(report.ErrorTotal, 10), formatPercent(100 - report.SuccessRate)},
+		{"Target Rate (req/sec)", formatFloat(report.TargetRate), ""},
+		{"Achieved Rate (req/sec)", formatFloat(report.AchievedRate), ""},
+		{"Throughput (req/sec)", formatFloat(report.Throughput), ""},
+		{"Dropped Requests", strconv.FormatUint(report.DroppedTotal, 10), ""},
+		{"Connections", strconv.FormatUint(s.Connections, 10), ""},
+	}
+	if report.BytesSent > 0 || report.BytesReceived > 0 {
+		data.Metrics = append(data.Metrics,
+			htmlRow{"Upload (MB/sec)", formatFloat(report.UploadMBps), ""},
+			htmlRow{"Download (MB/sec)", formatFloat(report.DownloadMBps), ""})
+	}
+
+	for _, percentile := range s.Percentiles {
+		name := PercentileName(percentile)
+		data.Latency = append(data.Latency, htmlRow{Name: name, Value: formatFloat(report.Latency[name])})
+	}
+	data.Latency = append(data.Latency, htmlRow{Name: "max", Value: formatFloat(report.Latency["max"])})
+
+	codes := make([]int, 0, len(s.StatusCodes))
+	for code := range s.StatusCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		count := s.StatusCodes[code]
+		data.StatusCodes = append(data.StatusCodes, htmlRow{strconv.Itoa(code), strconv.Itoa(count), formatPercent(share(count, report.RequestTotal))})
+	}
+
+	for _, e := range sortedErrors(s.Errors) {
+		data.Errors = append(data.Errors, htmlRow{e.ErrorCode, strconv.Itoa(e.Count), formatPercent(share(e.Count, report.RequestTotal))})
+	}
+
+	if s.SuccessHistogram.TotalCount() > 0 {
+		var chart bytes.Buffer
+		if err := writePNGDistribution(&chart, s.SuccessHistogram, s.Chart, milliseconds); err != nil {
+			return err
+		}
+		// the chart is encoded here, so the data URL is safe
+		data.LatencyChart = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(chart.Bytes()))
+	}
+
+	if len(s.HistogramLog) > 0 {
+		timeline, err := s.Timeline()
+		if err != nil {
+			return err
+		}
+		data.Throughput = throughputSVG(timeline)
+	}
+
+	var out bytes.Buffer
+	if err := htmlReportTemplate.Execute(&out, data); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, out.Bytes(), 0644)
+}
+
+// formatLabels returns the labels as name=value pairs, sorted by name.
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
+
+func formatPercent(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64) + "%"
+}
+
+func share(count int, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(count) / float64(total) * 100
+}
+
+// throughputSVG draws the throughput of the intervals of the timeline as an
+// SVG line chart. It only holds numbers, so it's safe to inline.
+func throughputSVG(timeline []TimelineInterval) template.HTML {
+	const (
+		width, height = 1000, 300
+		left, bottom  = 70, 40
+		top, right    = 20, 20
+	)
+	plotWidth, plotHeight := float64(width-left-right), float64(height-top-bottom)
+
+	last := timeline[len(timeline)-1]
+	endSec := last.StartSec + last.LengthSec
+	if endSec <= 0 {
+		endSec = 1
+	}
+	maxRate := 0.0
+	for _, interval := range timeline {
+		if interval.Throughput > maxRate {
+			maxRate = interval.Throughput
+		}
+	}
+	step := niceStep(maxRate / 4)
+	maxRate = step * float64(int(maxRate/step)+1)
+
+	var svg bytes.Buffer
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d">`, width, height, width, height)
+	for i := 0; float64(i)*step <= maxRate; i++ {
+		y := float64(top) + plotHeight - float64(i)*step/maxRate*plotHeight
+		fmt.Fprintf(&svg, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" class="grid"/>`, left, y, width-right, y)
+		fmt.Fprintf(&svg, `<text x="%d" y="%.1f" text-anchor="end">%g</text>`, left-8, y+4, float64(i)*step)
+	}
+	for i := 0; i <= 5; i++ {
+		sec := endSec * float64(i) / 5
+		x := float64(left) + plotWidth*float64(i)/5
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%d" text-anchor="middle">%.0fs</text>`, x, height-bottom+20, sec)
+	}
+	svg.WriteString(`<polyline class="curve" points="`)
+	for _, interval := range timeline {
+		x := float64(left) + (interval.StartSec+interval.LengthSec/2)/endSec*plotWidth
+		y := float64(top) + plotHeight - interval.Throughput/maxRate*plotHeight
+		fmt.Fprintf(&svg, "%.1f,%.1f ", x, y)
+	}
+	svg.WriteString(`"/>`)
+	fmt.Fprintf(&svg, `<line x1="%d" y1="%d" x2="%d" y2="%d" class="axis"/>`, left, top, left, height-bottom)
+	fmt.Fprintf(&svg, `<line x1="%d" y1="%d" x2="%d" y2="%d" class="axis"/>`, left, height-bottom, width-right, height-bottom)
+	svg.WriteString(`</svg>`)
+	return template.HTML(svg.String())
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>LaBench report, {{.Started}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 1040px; color: #222; }
+h1 { font-size: 1.6em; margin-bottom: 0.2em; }
+h2 { font-size: 1.2em; margin-top: 2em; border-bottom: 1px solid #ddd; padding-bottom: 0.2em; }
+table { border-collapse: collapse; min-width: 24em; }
+th, td { padding: 0.3em 1em; border-bottom: 1px solid #eee; text-align: left; }
+td.number { text-align: right; font-variant-numeric: tabular-nums; }
+.meta { color: #666; }
+.aborted { background: #fff3cd; padding: 0.6em 1em; border-left: 4px solid #e0a800; }
+.passed { color: #1a7f37; font-weight: bold; }
+.failed { color: #cf222e; font-weight: bold; }
+svg text { font-size: 12px; fill: #444; }
+svg .grid { stroke: #e6e6e6; }
+svg .axis { stroke: #444; }
+svg .curve { fill: none; stroke: #1f77b4; stroke-width: 2; }
+</style>
+</head>
+<body>
+<h1>LaBench report</h1>
+<p class="meta">Started {{.Started}}, ran for {{.Elapsed}}</p>
+{{if .Labels}}<p class="meta">Labels: {{.Labels}}</p>{{end}}
+{{if .AbortReason}}<p class="aborted">Stopped early: {{.AbortReason}}</p>{{end}}
+
+<h2>Summary</h2>
+<table>
+<tr><th>Metric</th><th>Value</th><th>Percentage</th></tr>
+{{range .Metrics}}<tr><td>{{.Name}}</td><td class="number">{{.Value}}</td><td class="number">{{.Percent}}</td></tr>
+{{end}}</table>
+{{if .SLA}}
+<h2>SLA</h2>
+<table>
+<tr><th>Criterion</th><th>Limit</th><th>Actual</th><th>Result</th></tr>
+{{range .SLA}}<tr><td>{{.Criterion}}</td><td class="number">{{.Limit}}</td><td class="number">{{printf "%.2f" .Actual}}</td><td>{{if .Passed}}<span class="passed">PASS</span>{{else}}<span class="failed">FAIL</span>{{end}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Latency of successful requests (ms)</h2>
+<table>
+<tr><th>Percentile</th><th>Latency (ms)</th></tr>
+{{range .Latency}}<tr><td>{{.Name}}</td><td class="number">{{.Value}}</td></tr>
+{{end}}</table>
+{{if .LatencyChart}}<p><img src="{{.LatencyChart}}" alt="Latency by percentile" width="1000" height="600"></p>{{end}}
+{{if .Throughput}}
+<h2>Throughput of successful requests over time (req/sec)</h2>
+{{.Throughput}}
+{{end}}
+<h2>Status codes</h2>
+<table>
+<tr><th>Status</th><th>Count</th><th>Percentage</th></tr>
+{{range .StatusCodes}}<tr><td>{{.Name}}</td><td class="number">{{.Value}}</td><td class="number">{{.Percent}}</td></tr>
+{{end}}</table>
+{{if .Errors}}
+<h2>Errors</h2>
+<table>
+<tr><th>Error</th><th>Count</th><th>Percentage</th></tr>
+{{range .Errors}}<tr><td>{{.Name}}</td><td class="number">{{.Value}}</td><td class="number">{{.Percent}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
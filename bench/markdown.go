@@ -0,0 +1,83 @@
+package bench
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// markdownMaxErrors is how many of the most frequent errors the Markdown
+// summary lists, to keep it short.
+const markdownMaxErrors = 5
+
+// WriteMarkdown writes a compact summary of the run to a file as Markdown,
+// for posting as a comment on a pull request: the request totals, rates and
+// error rate, the latency percentiles as a single row, the SLA if it was
+// checked and the most frequent errors.
+func (s *Summary) WriteMarkdown(file string) error {
+	report := s.Report()
+	var out bytes.Buffer
+
+	out.WriteString("### LaBench results\n\n")
+	if len(s.Labels) > 0 {
+		fmt.Fprintf(&out, "Labels: %s\n\n", escapeMarkdown(formatLabels(s.Labels)))
+	}
+	if report.AbortReason != "" {
+		fmt.Fprintf(&out, "> **Stopped early:** %s\n\n", escapeMarkdown(report.AbortReason))
+	}
+
+	out.WriteString("| Requests | Success Rate | Error Rate | Target Rate | Achieved Rate | Throughput | Duration |\n")
+	out.WriteString("|---:|---:|---:|---:|---:|---:|---:|\n")
+	fmt.Fprintf(&out, "| %d | %s | %s | %s/s | %s/s | %s/s | %s |\n\n",
+		report.RequestTotal, formatPercent(report.SuccessRate), formatPercent(100-report.SuccessRate),
+		formatFloat(report.TargetRate), formatFloat(report.AchievedRate), formatFloat(report.Throughput),
+		s.TimeElapsed.Round(time.Millisecond).String())
+
+	names := make([]string, 0, len(s.Percentiles)+1)
+	for _, percentile := range s.Percentiles {
+		names = append(names, PercentileName(percentile))
+	}
+	names = append(names, "max")
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = formatFloat(report.Latency[name])
+	}
+	fmt.Fprintf(&out, "| Latency (ms) | %s |\n", strings.Join(names, " | "))
+	fmt.Fprintf(&out, "|---|%s\n", strings.Repeat("---:|", len(names)))
+	fmt.Fprintf(&out, "| | %s |\n", strings.Join(values, " | "))
+
+	if len(s.SLA) > 0 {
+		checks := make([]string, len(s.SLA))
+		for i, check := range s.SLA {
+			result := "PASS"
+			if !check.Passed {
+				result = "**FAIL**"
+			}
+			checks[i] = fmt.Sprintf("%s %s %s (limit %g)", check.Criterion, result, formatFloat(check.Actual), check.Limit)
+		}
+		fmt.Fprintf(&out, "\nSLA: %s\n", strings.Join(checks, ", "))
+	}
+
+	if len(s.Errors) > 0 {
+		el := sortedErrors(s.Errors)
+
+		out.WriteString("\n| Error | Count |\n|---|---:|\n")
+		for i, e := range el {
+			if i == markdownMaxErrors {
+				fmt.Fprintf(&out, "| _%d more_ | |\n", len(el)-i)
+				break
+			}
+			fmt.Fprintf(&out, "| %s | %d |\n", escapeMarkdown(e.ErrorCode), e.Count)
+		}
+	}
+
+	return ioutil.WriteFile(file, out.Bytes(), 0644)
+}
+
+// escapeMarkdown keeps error texts from breaking the table they are in.
+func escapeMarkdown(text string) string {
+	text = strings.ReplaceAll(text, "|", "\\|")
+	return strings.ReplaceAll(text, "\n", " ")
+}
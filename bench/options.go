@@ -0,0 +1,235 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Option configures a Benchmark created by New, each one is the counterpart
+// of a Set method of Benchmark and returns an error where that would panic.
+type Option func(*Benchmark) error
+
+// New creates a Benchmark issuing requestRate requests per second over the
+// given number of connections for duration, configured by the options. It's
+// the entry point of using the package as a library, for scripting tests in
+// Go: RunContext then returns the Summary, the package writes no files and
+// prints nothing, it only logs through log/slog.
+func New(factory RequesterFactory, requestRate, connections uint64, duration time.Duration, options ...Option) (*Benchmark, error) {
+	if factory == nil {
+		return nil, errors.New("a RequesterFactory is required")
+	}
+	if requestRate == 0 {
+		return nil, errors.New("the request rate must be positive")
+	}
+
+	b := NewBenchmark(factory, requestRate, connections, duration, 0, 0)
+	for _, option := range options {
+		if err := option(b); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// RunContext runs the benchmark until its duration is over or ctx is done,
+// whichever comes first, and returns the Summary of what was measured. The
+// requests in flight of ContextRequesters are aborted once ctx is done. A
+// Benchmark can only be run once.
+func (b *Benchmark) RunContext(ctx context.Context) (*Summary, error) {
+	return b.run(ctx, false)
+}
+
+// WithWarmUp sends requests for the given duration before the measurement
+// starts, they are not part of the Summary.
+func WithWarmUp(duration time.Duration) Option {
+	return func(b *Benchmark) error {
+		b.warmUpDuration = duration
+		return nil
+	}
+}
+
+// WithBaseLatency subtracts a latency from all measured latencies, e.g. the
+// round trip of the network, to report the latency of the system under test.
+func WithBaseLatency(latency time.Duration) Option {
+	return func(b *Benchmark) error {
+		b.baseLatency = latency
+		return nil
+	}
+}
+
+// WithHistogramRange is SetHistogramRange.
+func WithHistogramRange(lowest, highest time.Duration, significantDigits int) Option {
+	return func(b *Benchmark) error {
+		return b.setHistogramRange(lowest, highest, significantDigits)
+	}
+}
+
+// WithCoordinatedOmissionCorrection is SetCoordinatedOmissionCorrection.
+func WithCoordinatedOmissionCorrection(keepUncorrected bool) Option {
+	return func(b *Benchmark) error {
+		b.SetCoordinatedOmissionCorrection(keepUncorrected)
+		return nil
+	}
+}
+
+// WithRampUp is SetRampUp.
+func WithRampUp(duration time.Duration, startRate uint64) Option {
+	return func(b *Benchmark) error {
+		b.SetRampUp(duration, startRate)
+		return nil
+	}
+}
+
+// WithLoadSteps is SetLoadSteps.
+func WithLoadSteps(steps []LoadStep, perStepLatency bool) Option {
+	return func(b *Benchmark) error {
+		if len(steps) == 0 {
+			return errors.New("at least one load step is required")
+		}
+		b.SetLoadSteps(steps, perStepLatency)
+		return nil
+	}
+}
+
+// WithRateSchedule is SetRateSchedule.
+func WithRateSchedule(points []RatePoint) Option {
+	return func(b *Benchmark) error {
+		if len(points) == 0 {
+			return errors.New("at least one rate point is required")
+		}
+		b.SetRateSchedule(points)
+		return nil
+	}
+}
+
+// WithMaxRequests is SetMaxRequests.
+func WithMaxRequests(maxRequests uint64) Option {
+	return func(b *Benchmark) error {
+		b.SetMaxRequests(maxRequests)
+		return nil
+	}
+}
+
+// WithContinuous is SetContinuous, the duration of New is ignored.
+func WithContinuous() Option {
+	return func(b *Benchmark) error {
+		b.SetContinuous()
+		return nil
+	}
+}
+
+// WithExcludePausedTime is SetExcludePausedTime.
+func WithExcludePausedTime() Option {
+	return func(b *Benchmark) error {
+		b.SetExcludePausedTime()
+		return nil
+	}
+}
+
+// WithPoissonArrivals is SetPoissonArrivals.
+func WithPoissonArrivals(seed int64) Option {
+	return func(b *Benchmark) error {
+		b.SetPoissonArrivals(seed)
+		return nil
+	}
+}
+
+// WithRandomSeed is SetRandomSeed.
+func WithRandomSeed(seed int64) Option {
+	return func(b *Benchmark) error {
+		b.SetRandomSeed(seed)
+		return nil
+	}
+}
+
+// WithThinkTime is SetThinkTime.
+func WithThinkTime(thinkTime ThinkTime) Option {
+	return func(b *Benchmark) error {
+		if err := thinkTime.validate(); err != nil {
+			return err
+		}
+		b.thinkTime = &thinkTime
+		return nil
+	}
+}
+
+// WithConnectionWarmUp is SetConnectionWarmUp.
+func WithConnectionWarmUp(connections uint64) Option {
+	return func(b *Benchmark) error {
+		b.SetConnectionWarmUp(connections)
+		return nil
+	}
+}
+
+// WithPercentiles is SetPercentiles.
+func WithPercentiles(percentiles []float64) Option {
+	return func(b *Benchmark) error {
+		for _, percentile := range percentiles {
+			if percentile <= 0 || percentile >= 100 {
+				return errors.New("percentiles must be between 0 and 100")
+			}
+		}
+		b.SetPercentiles(percentiles)
+		return nil
+	}
+}
+
+// WithHistogramLogInterval is SetHistogramLogInterval.
+func WithHistogramLogInterval(interval time.Duration) Option {
+	return func(b *Benchmark) error {
+		if interval <= 0 {
+			return errors.New("the histogram log interval must be positive")
+		}
+		b.SetHistogramLogInterval(interval)
+		return nil
+	}
+}
+
+// WithMaxErrorRate is SetMaxErrorRate.
+func WithMaxErrorRate(maxErrorRate float64, window time.Duration) Option {
+	return func(b *Benchmark) error {
+		if maxErrorRate < 0 || maxErrorRate > 100 {
+			return errors.New("the max error rate is in percent and must be from 0 to 100")
+		}
+		b.SetMaxErrorRate(maxErrorRate, window)
+		return nil
+	}
+}
+
+// WithStopOnFirstError is SetStopOnFirstError.
+func WithStopOnFirstError() Option {
+	return func(b *Benchmark) error {
+		b.SetStopOnFirstError()
+		return nil
+	}
+}
+
+// WithDrainTimeout is SetDrainTimeout.
+func WithDrainTimeout(timeout time.Duration) Option {
+	return func(b *Benchmark) error {
+		if timeout < 0 {
+			return errors.New("the drain timeout must not be negative")
+		}
+		b.SetDrainTimeout(timeout)
+		return nil
+	}
+}
+
+// WithObserver is AddObserver.
+func WithObserver(observer Observer) Option {
+	return func(b *Benchmark) error {
+		b.AddObserver(observer)
+		return nil
+	}
+}
+
+// WithTightTicker makes RunContext spin instead of sleeping between requests
+// even if the timers of the system are precise enough for the request rate,
+// at the cost of a core. It's the forceTightTicker of Run.
+func WithTightTicker() Option {
+	return func(b *Benchmark) error {
+		b.forceTightTicker = true
+		return nil
+	}
+}
@@ -0,0 +1,84 @@
+package bench
+
+import (
+	"sync"
+	"time"
+)
+
+// pauseState is whether the ticker is paused, resumed is closed on Resume.
+type pauseState struct {
+	mu       sync.Mutex
+	resumed  chan struct{}
+	pausedAt time.Time
+	// notify wakes up the ticker to hold it while paused
+	notify chan struct{}
+}
+
+// SetExcludePausedTime extends the duration of the benchmark by the time it
+// was paused, so that it sends for its full duration. The time elapsed of the
+// Summary doesn't include the pauses either. It must be called before Run.
+func (b *Benchmark) SetExcludePausedTime() {
+	b.excludePaused = true
+}
+
+// Pause stops sending requests until Resume is called, the requests in flight
+// complete and connections are kept open. It returns false if the benchmark
+// was already paused. It may be called while the benchmark runs, from any
+// goroutine.
+func (b *Benchmark) Pause() bool {
+	b.pause.mu.Lock()
+	defer b.pause.mu.Unlock()
+
+	if b.pause.resumed != nil {
+		return false
+	}
+	b.pause.resumed = make(chan struct{})
+	b.pause.pausedAt = time.Now()
+	select {
+	case b.pause.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Resume sends requests again after Pause and returns for how long the
+// benchmark was paused, false if it wasn't.
+func (b *Benchmark) Resume() (time.Duration, bool) {
+	b.pause.mu.Lock()
+	defer b.pause.mu.Unlock()
+
+	if b.pause.resumed == nil {
+		return 0, false
+	}
+	close(b.pause.resumed)
+	b.pause.resumed = nil
+	return time.Since(b.pause.pausedAt), true
+}
+
+// Paused reports whether the benchmark is paused.
+func (b *Benchmark) Paused() bool {
+	b.pause.mu.Lock()
+	defer b.pause.mu.Unlock()
+	return b.pause.resumed != nil
+}
+
+// waitPaused holds the ticker while the benchmark is paused and returns for
+// how long, false if the benchmark was stopped or deadline passed meanwhile.
+func (b *Benchmark) waitPaused(doneCh <-chan struct{}, deadline <-chan time.Time) (time.Duration, bool) {
+	b.pause.mu.Lock()
+	resumed := b.pause.resumed
+	b.pause.mu.Unlock()
+	if resumed == nil {
+		return 0, true
+	}
+
+	paused := time.Now()
+	select {
+	case <-resumed:
+		return time.Since(paused), true
+	case <-doneCh:
+	case <-b.abortCh:
+	case <-deadline:
+	}
+	return time.Since(paused), false
+}
@@ -0,0 +1,193 @@
+package bench
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/codahale/hdrhistogram"
+)
+
+// Report is the machine readable form of a Summary, meant to be consumed
+// by scripts and CI rather than people.
+type Report struct {
+	RequestTotal       uint64
+	SuccessTotal       uint64
+	ErrorTotal         uint64
+	RetriedTotal       uint64
+	RetriesTotal       uint64
+	RateLimitedTotal   uint64 `json:",omitempty"`
+	OutOfRangeTotal    uint64
+	DroppedTotal       uint64
+	DrainAbortedTotal  uint64 `json:",omitempty"`
+	ConnectionsOpened  uint64 `json:",omitempty"`
+	AbortReason        string `json:",omitempty"`
+	BytesSent          uint64
+	BytesReceived      uint64
+	BytesDecompressed  uint64 `json:",omitempty"`
+	UploadMBps         float64
+	DownloadMBps       float64
+	SuccessRate        float64
+	RequestRate        float64
+	TargetRate         float64
+	AchievedRate       float64
+	Throughput         float64
+	StartTime          time.Time
+	TimeElapsedSec     float64
+	AvgRequestTime     float64
+	Latency            map[string]float64
+	LatencyCorrected   bool
+	UncorrectedLatency map[string]float64  `json:",omitempty"`
+	TimeToFirstByte    map[string]float64  `json:",omitempty"`
+	DNSLookup          *LatencyPercentiles `json:",omitempty"`
+	Connect            *LatencyPercentiles `json:",omitempty"`
+	TLSHandshake       *LatencyPercentiles `json:",omitempty"`
+	ResponseSize       *LatencyPercentiles `json:",omitempty"`
+	ConnectionReuse    *ConnectionReuse    `json:",omitempty"`
+	StatusCodes        map[int]int
+	ErrorCategories    map[string]int
+	Errors             map[string]int
+	SLA                []SLACheck        `json:",omitempty"`
+	Labels             map[string]string `json:",omitempty"`
+}
+
+// SLACheck is a criterion of a service level agreement checked against the
+// results of a run. Latency criteria are in milliseconds and ErrorRate in
+// percent.
+type SLACheck struct {
+	Criterion string
+	Limit     float64
+	Actual    float64
+	Passed    bool
+}
+
+// Report returns the Report of the Summary. Latency holds percentiles of
+// successful requests in milliseconds, named p50, p99.9 etc. and max, and so
+// does TimeToFirstByte if it was measured. If LatencyCorrected, Latency is
+// corrected for coordinated omission and UncorrectedLatency is included if it
+// was kept. The phases of opening connections are included as
+// LatencyPercentiles if they were measured, and so is ResponseSize, in bytes,
+// if responses were read. StartTime is when the measurement started, in UTC.
+// DroppedTotal, TargetRate and AchievedRate tell if the request rate was
+// achieved. ConnectionsOpened is included if it was counted, ConnectionReuse
+// if it was reported, SLA if it was checked and Labels if the run has any.
+func (s *Summary) Report() *Report {
+	requestTotal := s.SuccessTotal + s.ErrorTotal
+	successRate := 0.
+	if requestTotal > 0 {
+		successRate = float64(s.SuccessTotal) / float64(requestTotal) * 100
+	}
+
+	var ttfb map[string]float64
+	if s.TTFBHistogram.TotalCount() > 0 {
+		ttfb = reportLatency(s.TTFBHistogram, s.Percentiles)
+	}
+
+	var uncorrected map[string]float64
+	if s.Uncorrected != nil {
+		uncorrected = reportLatency(s.Uncorrected, s.Percentiles)
+	}
+
+	var responseSize *LatencyPercentiles
+	if s.BytesReceived > 0 {
+		responseSize = &s.ResponseSize
+	}
+
+	// only reported when responses were compressed
+	var bytesDecompressed uint64
+	if s.BytesDecompressed != s.BytesReceived {
+		bytesDecompressed = s.BytesDecompressed
+	}
+
+	var connectionReuse *ConnectionReuse
+	if s.ConnectionReuse.Requests > 0 {
+		connectionReuse = &s.ConnectionReuse
+	}
+
+	var dns, connect, tlsHandshake *LatencyPercentiles
+	if s.ConnectLatency.Count > 0 {
+		dns, connect, tlsHandshake = &s.DNSLatency, &s.ConnectLatency, &s.TLSLatency
+	}
+
+	return &Report{
+		RequestTotal:       requestTotal,
+		SuccessTotal:       s.SuccessTotal,
+		ErrorTotal:         s.ErrorTotal,
+		RetriedTotal:       s.RetriedTotal,
+		RateLimitedTotal:   s.RateLimitedTotal,
+		RetriesTotal:       s.RetriesTotal,
+		OutOfRangeTotal:    s.OutOfRangeTotal,
+		DroppedTotal:       s.DroppedTotal,
+		DrainAbortedTotal:  s.DrainAbortedTotal,
+		ConnectionsOpened:  s.ConnectionsOpened,
+		ConnectionReuse:    connectionReuse,
+		AbortReason:        s.AbortReason,
+		BytesSent:          s.BytesSent,
+		BytesReceived:      s.BytesReceived,
+		BytesDecompressed:  bytesDecompressed,
+		UploadMBps:         s.UploadMBps(),
+		DownloadMBps:       s.DownloadMBps(),
+		SuccessRate:        successRate,
+		RequestRate:        s.RequestRate,
+		TargetRate:         s.TargetRate,
+		AchievedRate:       s.AchievedRate,
+		Throughput:         s.Throughput,
+		StartTime:          s.StartTime.UTC(),
+		TimeElapsedSec:     s.TimeElapsed.Seconds(),
+		AvgRequestTime:     s.AvgRequestTime,
+		Latency:            reportLatency(s.SuccessHistogram, s.Percentiles),
+		LatencyCorrected:   s.Corrected,
+		UncorrectedLatency: uncorrected,
+		TimeToFirstByte:    ttfb,
+		DNSLookup:          dns,
+		Connect:            connect,
+		TLSHandshake:       tlsHandshake,
+		ResponseSize:       responseSize,
+		StatusCodes:        s.StatusCodes,
+		ErrorCategories:    s.ErrorCategories,
+		Errors:             s.Errors,
+		SLA:                s.SLA,
+		Labels:             s.Labels,
+	}
+}
+
+// reportLatency returns the percentiles and the max of a histogram in milliseconds.
+func reportLatency(histogram *hdrhistogram.Histogram, percentiles []float64) map[string]float64 {
+	latency := make(map[string]float64, len(percentiles)+1)
+	for _, percentile := range percentiles {
+		latency[PercentileName(percentile)] = float64(histogram.ValueAtQuantile(percentile)) / 1000000
+	}
+	latency["max"] = float64(histogram.Max()) / 1000000
+	return latency
+}
+
+// WriteJSON writes the Report of the Summary to a file as JSON.
+func (s *Summary) WriteJSON(file string) error {
+	content, err := json.MarshalIndent(s.Report(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, append(content, '\n'), 0644)
+}
+
+// AppendJSONLine appends the Report of the Summary to a file as a line of
+// JSON, creating the file if needed, so that the runs of e.g. a nightly job
+// accumulate into a time series of their StartTime and Labels.
+func (s *Summary) AppendJSONLine(file string) error {
+	content, err := json.Marshal(s.Report())
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(content, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
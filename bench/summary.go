@@ -13,22 +13,168 @@ import (
 	"github.com/olekukonko/tablewriter"
 )
 
-// Summary contains the results of a Benchmark run.
+// Summary contains the results of a Benchmark run. If Corrected,
+// SuccessHistogram is corrected for coordinated omission and Uncorrected holds
+// the uncorrected latency if it was kept. WarmedUpConnections were opened in
+// ConnectionWarmUpTime before the first request, if SetConnectionWarmUp was
+// called. DroppedTotal requests were scheduled but never sent because all
+// connections were busy, TargetRate is the rate requests were scheduled at, of
+// which AchievedRate were sent. ConnectionsOpened is how many connections the
+// Requesters opened during the run, if the RequesterFactory is a
+// ConnectionCounter. DrainAbortedTotal requests were still in flight when the
+// drain timeout passed after the benchmark stopped sending. Chart scales the
+// PNG distributions, if set before they are generated. Labels are key/value
+// pairs the caller attached to the run, for telling runs apart. SLA holds the
+// checks of a service level agreement against the Summary, if the caller made
+// them.
 type Summary struct {
-	Connections      uint64
-	RequestRate      float64
-	SuccessTotal     uint64
-	ErrorTotal       uint64
-	TimeElapsed      time.Duration
-	SuccessHistogram *hdrhistogram.Histogram
-	Throughput       float64
-	AvgRequestTime   float64
-	Errors           map[string]int
-	TicksTimely      uint64
-	TicksTimelyRatio float64
-	SendsTimely      uint64
-	SendsTimelyRatio float64
-	OutputJson       bool
+	Connections          uint64
+	ConnectionsOpened    uint64
+	ConnectionReuse      ConnectionReuse
+	WarmedUpConnections  uint64
+	ConnectionWarmUpTime time.Duration
+	RequestRate          float64
+	SuccessTotal         uint64
+	ErrorTotal           uint64
+	BytesSent            uint64
+	BytesReceived        uint64
+	BytesDecompressed    uint64
+	RetriedTotal         uint64
+	RateLimitedTotal     uint64
+	RetriesTotal         uint64
+	OutOfRangeTotal      uint64
+	DroppedTotal         uint64
+	DrainAbortedTotal    uint64
+	TargetRate           float64
+	AchievedRate         float64
+	AbortReason          string
+	TimeElapsed          time.Duration
+	SuccessHistogram     *hdrhistogram.Histogram
+	Corrected            bool
+	Uncorrected          *hdrhistogram.Histogram
+	FailureHistogram     *hdrhistogram.Histogram
+	TTFBHistogram        *hdrhistogram.Histogram
+	SizeHistogram        *hdrhistogram.Histogram
+	LabelHistograms      map[string]*hdrhistogram.Histogram
+	LoadSteps            []LoadStep
+	StepHistograms       []*hdrhistogram.Histogram
+	StartTime            time.Time
+	HistogramLog         []HistogramLogInterval
+	Throughput           float64
+	AvgRequestTime       float64
+	Errors               map[string]int
+	ErrorCategories      map[string]int
+	StatusCodes          map[int]int
+	SuccessLatency       LatencyPercentiles
+	UncorrectedLatency   LatencyPercentiles
+	FailureLatency       LatencyPercentiles
+	TTFBLatency          LatencyPercentiles
+	DNSLatency           LatencyPercentiles
+	ConnectLatency       LatencyPercentiles
+	TLSLatency           LatencyPercentiles
+	ResponseSize         LatencyPercentiles
+	Percentiles          []float64
+	TicksTimely          uint64
+	TicksTimelyRatio     float64
+	SendsTimely          uint64
+	SendsTimelyRatio     float64
+	OutputJson           bool
+	SLA                  []SLACheck
+	Chart                ChartOptions
+	Labels               map[string]string
+}
+
+// ConnectionReuse counts the successful Requests which reported whether their
+// connection was reused, of which Reused were sent on a connection opened for
+// an earlier request and WasIdle on one taken idle from the pool. ReuseRate is
+// the percentage of Reused, low rates point at connection churn.
+type ConnectionReuse struct {
+	Requests  uint64
+	Reused    uint64
+	WasIdle   uint64
+	ReuseRate float64
+}
+
+func (c ConnectionReuse) withRate() ConnectionReuse {
+	if c.Requests > 0 {
+		c.ReuseRate = float64(c.Reused) / float64(c.Requests) * 100
+	}
+	return c
+}
+
+// DefaultPercentiles are the latency percentiles reported unless others are set.
+var DefaultPercentiles = []float64{50, 90, 99, 99.9}
+
+// LatencyPercentiles summarizes a latency distribution, in milliseconds.
+// Values holds the latency at each of the percentiles of the Summary.
+type LatencyPercentiles struct {
+	Count  int64
+	Mean   float64
+	Values []float64
+	Max    float64
+}
+
+func newLatencyPercentiles(h *hdrhistogram.Histogram, percentiles []float64) LatencyPercentiles {
+	return newPercentiles(h, percentiles, milliseconds)
+}
+
+// newPercentiles summarizes a distribution of other values than latencies
+// the same way, in the unit.
+func newPercentiles(h *hdrhistogram.Histogram, percentiles []float64, unit valueUnit) LatencyPercentiles {
+	values := make([]float64, len(percentiles))
+	for i, percentile := range percentiles {
+		values[i] = float64(h.ValueAtQuantile(percentile)) / unit.scale
+	}
+
+	return LatencyPercentiles{
+		Count:  h.TotalCount(),
+		Mean:   h.Mean() / unit.scale,
+		Values: values,
+		Max:    float64(h.Max()) / unit.scale,
+	}
+}
+
+// row formats the percentiles as a table row after the given name.
+func (p LatencyPercentiles) row(name string) []string {
+	row := []string{name, strconv.FormatInt(p.Count, 10), strconv.FormatFloat(p.Mean, 'f', 2, 64)}
+	for _, value := range p.Values {
+		row = append(row, strconv.FormatFloat(value, 'f', 2, 64))
+	}
+	return append(row, strconv.FormatFloat(p.Max, 'f', 2, 64))
+}
+
+// latencyPercentilesHeader returns the table header of rows of the given percentiles.
+func latencyPercentilesHeader(percentiles []float64) []string {
+	return percentilesHeader(percentiles, milliseconds)
+}
+
+func percentilesHeader(percentiles []float64, unit valueUnit) []string {
+	suffix := " (" + unit.name + ")"
+	header := []string{"Count", "Mean" + suffix}
+	for _, percentile := range percentiles {
+		header = append(header, "P"+strconv.FormatFloat(percentile, 'f', -1, 64)+suffix)
+	}
+	return append(header, "Max"+suffix)
+}
+
+// ValidatePercentiles returns an error if a percentile is not between 0 and 100.
+func ValidatePercentiles(percentiles []float64) error {
+	for _, percentile := range percentiles {
+		if percentile <= 0 || percentile > 100 {
+			return fmt.Errorf("percentile %v must be greater than 0 and at most 100", percentile)
+		}
+	}
+	return nil
+}
+
+// UploadMBps returns the average bandwidth of request bodies, in megabytes per second.
+func (s *Summary) UploadMBps() float64 {
+	return float64(s.BytesSent) / 1000000 / s.TimeElapsed.Seconds()
+}
+
+// DownloadMBps returns the average bandwidth of response bodies, in megabytes per second.
+func (s *Summary) DownloadMBps() float64 {
+	return float64(s.BytesReceived) / 1000000 / s.TimeElapsed.Seconds()
 }
 
 // Struct and functions for sorting errors
@@ -42,6 +188,27 @@ func (p ErrorList) Len() int           { return len(p) }
 func (p ErrorList) Less(i, j int) bool { return p[i].Count < p[j].Count }
 func (p ErrorList) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 
+// sortedErrors returns the counts by highest count, and by text when counts
+// are equal so that the order is the same from run to run.
+func sortedErrors(counts map[string]int) ErrorList {
+	el := make(ErrorList, 0, len(counts))
+	for text, count := range counts {
+		el = append(el, Error{text, count})
+	}
+	sort.Slice(el, func(i, j int) bool {
+		if el[i].Count != el[j].Count {
+			return el[i].Count > el[j].Count
+		}
+		return el[i].ErrorCode < el[j].ErrorCode
+	})
+	return el
+}
+
+// PercentileName returns the name of a percentile in reports, e.g. p99.9.
+func PercentileName(percentile float64) string {
+	return "p" + strconv.FormatFloat(percentile, 'f', -1, 64)
+}
+
 // String returns a stringified version of the Summary.
 func (s *Summary) String() string {
 	requestTotal := s.SuccessTotal + s.ErrorTotal
@@ -56,6 +223,15 @@ func (s *Summary) String() string {
 		"\n{SuccessRate: %.2f%%, Throughput: %.2f req/s, AvgRequestTime: %.2f ms, Connections: %d, RequestRate: %.0f, RequestTotal: %d, SuccessTotal: %d, ErrorTotal: %d, TimeElapsed: %s}\n",
 		successRate, s.Throughput, s.AvgRequestTime, s.Connections, s.RequestRate, requestTotal, s.SuccessTotal, s.ErrorTotal, s.TimeElapsed)
 
+	if s.DroppedTotal > 0 {
+		fmt.Fprintf(&outputBuffer, "\nWARNING! Achieved %.2f req/s of the target %.2f req/s, %d requests were dropped as all %d Clients were busy, the server is saturated or Clients must be increased\n",
+			s.AchievedRate, s.TargetRate, s.DroppedTotal, s.Connections)
+	}
+
+	if s.AbortReason != "" {
+		fmt.Fprintf(&outputBuffer, "\nABORTED! The run was stopped early, %s\n", s.AbortReason)
+	}
+
 	if s.OutputJson {
 		// Serializing Summary object into JSON
 		jsonString, err := json.Marshal(s)
@@ -77,6 +253,51 @@ func (s *Summary) String() string {
 	metricsTable.Append([]string{"Request Rate (req/sec)", strconv.FormatFloat(s.RequestRate, 'f', 2, 64), ""})
 	metricsTable.Append([]string{"Throughput (req/sec)", strconv.FormatFloat(s.Throughput, 'f', 2, 64), ""})
 	metricsTable.Append([]string{"AvgRequestTime (ms)", strconv.FormatFloat(s.AvgRequestTime, 'f', 2, 64), ""})
+	if s.RateLimitedTotal > 0 {
+		rateLimitedRate := float64(s.RateLimitedTotal) / float64(requestTotal) * 100
+		metricsTable.Append([]string{"Rate Limited Requests", strconv.FormatUint(s.RateLimitedTotal, 10), strconv.FormatFloat(rateLimitedRate, 'f', 2, 64)})
+	}
+	if s.DrainAbortedTotal > 0 {
+		metricsTable.Append([]string{"In Flight At Drain Timeout", strconv.FormatUint(s.DrainAbortedTotal, 10), ""})
+	}
+	if s.RetriedTotal > 0 {
+		retriedRate := float64(s.RetriedTotal) / float64(requestTotal) * 100
+		metricsTable.Append([]string{"Retried Requests", strconv.FormatUint(s.RetriedTotal, 10), strconv.FormatFloat(retriedRate, 'f', 2, 64)})
+		metricsTable.Append([]string{"Retries", strconv.FormatUint(s.RetriesTotal, 10), ""})
+	}
+	if s.BytesSent > 0 || s.BytesReceived > 0 {
+		metricsTable.Append([]string{"Bytes Sent", strconv.FormatUint(s.BytesSent, 10), ""})
+		metricsTable.Append([]string{"Bytes Received", strconv.FormatUint(s.BytesReceived, 10), ""})
+		if s.BytesDecompressed != s.BytesReceived {
+			metricsTable.Append([]string{"Bytes Decompressed", strconv.FormatUint(s.BytesDecompressed, 10), ""})
+		}
+		metricsTable.Append([]string{"Upload (MB/sec)", strconv.FormatFloat(s.UploadMBps(), 'f', 2, 64), ""})
+		metricsTable.Append([]string{"Download (MB/sec)", strconv.FormatFloat(s.DownloadMBps(), 'f', 2, 64), ""})
+	}
+	if s.OutOfRangeTotal > 0 {
+		outOfRangeRate := float64(s.OutOfRangeTotal) / float64(requestTotal) * 100
+		metricsTable.Append([]string{"Latencies Beyond Histogram Max", strconv.FormatUint(s.OutOfRangeTotal, 10), strconv.FormatFloat(outOfRangeRate, 'f', 2, 64)})
+	}
+	if s.ConnectionWarmUpTime > 0 {
+		warmedUpRate := float64(s.WarmedUpConnections) / float64(s.Connections) * 100
+		metricsTable.Append([]string{"Connections Warmed Up", strconv.FormatUint(s.WarmedUpConnections, 10), strconv.FormatFloat(warmedUpRate, 'f', 2, 64)})
+		metricsTable.Append([]string{"Connection Warm-Up (ms)", strconv.FormatFloat(float64(s.ConnectionWarmUpTime)/float64(time.Millisecond), 'f', 2, 64), ""})
+	}
+	if s.ConnectionsOpened > 0 {
+		metricsTable.Append([]string{"Connections Opened", strconv.FormatUint(s.ConnectionsOpened, 10), ""})
+	}
+	if reuse := s.ConnectionReuse; reuse.Requests > 0 {
+		idleRate := float64(reuse.WasIdle) / float64(reuse.Requests) * 100
+		metricsTable.Append([]string{"Sent On Reused Connections", strconv.FormatUint(reuse.Reused, 10), strconv.FormatFloat(reuse.ReuseRate, 'f', 2, 64)})
+		metricsTable.Append([]string{"Sent On Idle Connections", strconv.FormatUint(reuse.WasIdle, 10), strconv.FormatFloat(idleRate, 'f', 2, 64)})
+	}
+	metricsTable.Append([]string{"Target Rate (req/sec)", strconv.FormatFloat(s.TargetRate, 'f', 2, 64), ""})
+	achievedRatio := 0.
+	if s.TargetRate > 0 {
+		achievedRatio = s.AchievedRate / s.TargetRate * 100
+	}
+	metricsTable.Append([]string{"Achieved Rate (req/sec)", strconv.FormatFloat(s.AchievedRate, 'f', 2, 64), strconv.FormatFloat(achievedRatio, 'f', 2, 64)})
+	metricsTable.Append([]string{"Dropped Requests", strconv.FormatUint(s.DroppedTotal, 10), strconv.FormatFloat(100-s.TicksTimelyRatio, 'f', 2, 64)})
 	metricsTable.Append([]string{"Timely Ticks", strconv.FormatUint(s.TicksTimely, 10), strconv.FormatFloat(s.TicksTimelyRatio, 'f', 2, 64)})
 	metricsTable.Append([]string{"Timely Sends", strconv.FormatUint(s.SendsTimely, 10), strconv.FormatFloat(s.SendsTimelyRatio, 'f', 2, 64)})
 
@@ -86,13 +307,7 @@ func (s *Summary) String() string {
 	errorTable.SetHeader([]string{"Error", "Absolute", "Percentage %"})
 
 	//Sorting errors by highest count
-	el := make(ErrorList, len(s.Errors))
-	i := 0
-	for code, count := range s.Errors {
-		el[i] = Error{code, count}
-		i++
-	}
-	sort.Sort(sort.Reverse(el)) //Sort in descending order
+	el := sortedErrors(s.Errors)
 
 	//Loop through each Error and print count
 	for _, err := range el {
@@ -103,7 +318,116 @@ func (s *Summary) String() string {
 	outputBuffer.WriteString("\n")
 	metricsTable.Render()
 
+	if s.ErrorTotal > 0 || s.TTFBLatency.Count > 0 || s.Corrected {
+		//Printing latency of successful and failed requests side by side, as failures are often faster
+		latencyTable := tablewriter.NewWriter(&outputBuffer)
+		latencyTable.SetHeader(append([]string{"Latency"}, latencyPercentilesHeader(s.Percentiles)...))
+		if s.Corrected {
+			// the count of corrected latency includes the requests presumed omitted
+			latencyTable.Append(s.SuccessLatency.row("Successful (CO corrected)"))
+			if s.Uncorrected != nil {
+				latencyTable.Append(s.UncorrectedLatency.row("Successful (uncorrected)"))
+			}
+		} else {
+			latencyTable.Append(s.SuccessLatency.row("Successful"))
+		}
+		if s.ErrorTotal > 0 {
+			latencyTable.Append(s.FailureLatency.row("Failed"))
+		}
+		if s.TTFBLatency.Count > 0 {
+			latencyTable.Append(s.TTFBLatency.row("Time To First Byte"))
+		}
+
+		outputBuffer.WriteString("\n")
+		latencyTable.Render()
+	}
+
+	if s.ConnectLatency.Count > 0 {
+		//Printing time spent opening connections, zero for reused connections
+		connectionTable := tablewriter.NewWriter(&outputBuffer)
+		connectionTable.SetHeader(append([]string{"Connection"}, latencyPercentilesHeader(s.Percentiles)...))
+		connectionTable.Append(s.DNSLatency.row("DNS Lookup"))
+		connectionTable.Append(s.ConnectLatency.row("TCP Connect"))
+		connectionTable.Append(s.TLSLatency.row("TLS Handshake"))
+
+		outputBuffer.WriteString("\n")
+		connectionTable.Render()
+	}
+
+	if s.BytesReceived > 0 {
+		//Printing response body sizes, to spot truncated or bloated responses
+		sizeTable := tablewriter.NewWriter(&outputBuffer)
+		sizeTable.SetHeader(append([]string{"Response Size"}, percentilesHeader(s.Percentiles, byteSize)...))
+		sizeTable.Append(s.ResponseSize.row("Successful"))
+
+		outputBuffer.WriteString("\n")
+		sizeTable.Render()
+	}
+
+	if len(s.StatusCodes) > 0 {
+		//Printing requests per status code, sorted by code
+		codes := make([]int, 0, len(s.StatusCodes))
+		for code := range s.StatusCodes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+
+		statusTable := tablewriter.NewWriter(&outputBuffer)
+		statusTable.SetHeader([]string{"Status Code", "Absolute", "Percentage %"})
+		for _, code := range codes {
+			percentage := float64(s.StatusCodes[code]) / float64(requestTotal) * 100
+			statusTable.Append([]string{strconv.Itoa(code), strconv.Itoa(s.StatusCodes[code]), strconv.FormatFloat(percentage, 'f', 2, 64)})
+		}
+
+		outputBuffer.WriteString("\n")
+		statusTable.Render()
+	}
+
+	if len(s.LabelHistograms) > 0 {
+		//Printing latency breakdown per kind of request, sorted by label
+		labels := make([]string, 0, len(s.LabelHistograms))
+		for label := range s.LabelHistograms {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+
+		labelsTable := tablewriter.NewWriter(&outputBuffer)
+		labelsTable.SetHeader(append([]string{"Successful Request"}, latencyPercentilesHeader(s.Percentiles)...))
+		for _, label := range labels {
+			labelsTable.Append(newLatencyPercentiles(s.LabelHistograms[label], s.Percentiles).row(label))
+		}
+
+		outputBuffer.WriteString("\n")
+		labelsTable.Render()
+	}
+
+	if len(s.StepHistograms) > 0 {
+		//Printing latency breakdown per load step, in the order they were played
+		stepsTable := tablewriter.NewWriter(&outputBuffer)
+		stepsTable.SetHeader(append([]string{"Load Step"}, latencyPercentilesHeader(s.Percentiles)...))
+		for i, histogram := range s.StepHistograms {
+			step := s.LoadSteps[i]
+			stepsTable.Append(newLatencyPercentiles(histogram, s.Percentiles).row(fmt.Sprintf("%d req/s for %s", step.Rate, step.Duration)))
+		}
+
+		outputBuffer.WriteString("\n")
+		stepsTable.Render()
+	}
+
 	if el.Len() > 0 {
+		//Printing failed requests per category, sorted by highest count
+		categories := sortedErrors(s.ErrorCategories)
+
+		categoryTable := tablewriter.NewWriter(&outputBuffer)
+		categoryTable.SetHeader([]string{"Error Category", "Absolute", "Percentage %"})
+		for _, category := range categories {
+			percentage := float64(category.Count) / float64(requestTotal) * 100
+			categoryTable.Append([]string{category.ErrorCode, strconv.Itoa(category.Count), strconv.FormatFloat(percentage, 'f', 2, 64)})
+		}
+
+		outputBuffer.WriteString("\n")
+		categoryTable.Render()
+
 		outputBuffer.WriteString("\n")
 		errorTable.Render()
 	}
@@ -112,18 +436,45 @@ func (s *Summary) String() string {
 }
 
 // GenerateLatencyDistribution generates a text file containing the specified
-// latency distribution in a format plottable by
+// latency distribution in the given format, HGRM is plottable by
 // http://hdrhistogram.github.io/HdrHistogram/plotFiles.html. Percentiles is a
 // list of percentiles to include, e.g. 10.0, 50.0, 99.0, 99.99, etc. If
 // percentiles is nil, it defaults to a logarithmic percentile scale. If a
 // request rate was specified for the benchmark, this will also generate an
 // uncorrected distribution file which does not account for coordinated
-// omission.
-func (s *Summary) GenerateLatencyDistribution(percentiles Percentiles, file string) error {
-	return generateLatencyDistribution(s.SuccessHistogram, nil, s.RequestRate, percentiles, file)
+// omission, if the Summary holds it. HLOG is written from the HistogramLog,
+// or as a single interval if there is none, and percentiles do not apply to
+// it.
+func (s *Summary) GenerateLatencyDistribution(format DistributionFormat, percentiles Percentiles, file string) error {
+	if format == HLOG && len(s.HistogramLog) > 0 {
+		return s.writeHistogramLog(file, s.HistogramLog, milliseconds)
+	}
+	return s.generateDistribution(s.SuccessHistogram, s.Uncorrected, s.RequestRate, format, percentiles, milliseconds, file)
+}
+
+// GenerateTTFBDistribution generates a text file containing the time to first
+// byte distribution of successful requests, the same way as
+// GenerateLatencyDistribution does for their latency.
+func (s *Summary) GenerateTTFBDistribution(format DistributionFormat, percentiles Percentiles, file string) error {
+	return s.generateDistribution(s.TTFBHistogram, nil, s.RequestRate, format, percentiles, milliseconds, file)
 }
 
-func generateLatencyDistribution(histogram, unHistogram *hdrhistogram.Histogram, requestRate float64, percentiles Percentiles, file string) error {
+// GenerateSizeDistribution generates a text file containing the response
+// body size distribution of successful requests in bytes, the same way as
+// GenerateLatencyDistribution does for their latency.
+func (s *Summary) GenerateSizeDistribution(format DistributionFormat, percentiles Percentiles, file string) error {
+	return s.generateDistribution(s.SizeHistogram, nil, s.RequestRate, format, percentiles, byteSize, file)
+}
+
+func (s *Summary) generateDistribution(histogram, unHistogram *hdrhistogram.Histogram, requestRate float64, format DistributionFormat, percentiles Percentiles, unit valueUnit, file string) error {
+	if format == HLOG {
+		interval, err := newHistogramLogInterval(histogram, 0, s.TimeElapsed)
+		if err != nil {
+			return err
+		}
+		return s.writeHistogramLog(file, []HistogramLogInterval{interval}, unit)
+	}
+
 	if percentiles == nil {
 		percentiles = Logarithmic
 	}
@@ -133,14 +484,8 @@ func generateLatencyDistribution(histogram, unHistogram *hdrhistogram.Histogram,
 	}
 	defer f.Close()
 
-	f.WriteString("Value    Percentile    TotalCount    1/(1-Percentile)\n\n")
-	for _, percentile := range percentiles {
-		value := float64(histogram.ValueAtQuantile(percentile)) / 1000000
-		_, err := f.WriteString(fmt.Sprintf("%f    %f        %d            %f\n",
-			value, percentile/100, 0, 1/(1-(percentile/100))))
-		if err != nil {
-			return err
-		}
+	if err = writeDistribution(f, histogram, percentiles, format, s.Chart, unit); err != nil {
+		return err
 	}
 
 	// Generate uncorrected distribution.
@@ -151,16 +496,20 @@ func generateLatencyDistribution(histogram, unHistogram *hdrhistogram.Histogram,
 		}
 		defer f.Close()
 
-		f.WriteString("Value    Percentile    TotalCount    1/(1-Percentile)\n\n")
-		for _, percentile := range percentiles {
-			value := float64(unHistogram.ValueAtQuantile(percentile)) / 1000000
-			_, err := f.WriteString(fmt.Sprintf("%f    %f        %d            %f\n",
-				value, percentile/100, 0, 1/(1-(percentile/100))))
-			if err != nil {
-				return err
-			}
+		if err = writeDistribution(f, unHistogram, percentiles, format, s.Chart, unit); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
+
+func (s *Summary) writeHistogramLog(file string, intervals []HistogramLogInterval, unit valueUnit) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return writeHistogramLog(f, s.StartTime, intervals, unit)
+}
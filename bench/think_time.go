@@ -0,0 +1,74 @@
+package bench
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// ThinkTimeDistribution is how the think time of a connection varies.
+type ThinkTimeDistribution string
+
+const (
+	// FixedThinkTime is always the Mean.
+	FixedThinkTime ThinkTimeDistribution = "Fixed"
+
+	// UniformThinkTime is picked uniformly from Min to Max.
+	UniformThinkTime ThinkTimeDistribution = "Uniform"
+
+	// ExponentialThinkTime is exponentially distributed around the Mean and
+	// clamped from Min to Max, a zero Max doesn't limit it.
+	ExponentialThinkTime ThinkTimeDistribution = "Exponential"
+)
+
+// ThinkTime is how long a connection waits after each of its requests before
+// it takes the next one, like a user reading a page before the next click.
+type ThinkTime struct {
+	Distribution ThinkTimeDistribution
+	Mean         time.Duration
+	Min          time.Duration
+	Max          time.Duration
+}
+
+// validate returns an error if the think time can't be used.
+func (t ThinkTime) validate() error {
+	if t.Mean < 0 || t.Min < 0 || t.Max < 0 {
+		return fmt.Errorf("think time must not be negative, got %+v", t)
+	}
+
+	switch t.Distribution {
+	case FixedThinkTime:
+	case UniformThinkTime:
+		if t.Max < t.Min {
+			return fmt.Errorf("uniform think time Max %v must be at least Min %v", t.Max, t.Min)
+		}
+	case ExponentialThinkTime:
+		if t.Max > 0 && t.Max < t.Min {
+			return fmt.Errorf("exponential think time Max %v must be at least Min %v", t.Max, t.Min)
+		}
+	default:
+		return fmt.Errorf("think time distribution must be %s, %s or %s, got %q", FixedThinkTime, UniformThinkTime, ExponentialThinkTime, t.Distribution)
+	}
+	return nil
+}
+
+// next returns the think time after a request.
+func (t ThinkTime) next(rnd *rand.Rand) time.Duration {
+	switch t.Distribution {
+	case UniformThinkTime:
+		return t.Min + time.Duration(rnd.Int63n(int64(t.Max-t.Min)+1))
+
+	case ExponentialThinkTime:
+		think := time.Duration(rnd.ExpFloat64() * float64(t.Mean))
+		if think < t.Min {
+			think = t.Min
+		}
+		if t.Max > 0 && think > t.Max {
+			think = t.Max
+		}
+		return think
+
+	default:
+		return t.Mean
+	}
+}
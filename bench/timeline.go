@@ -0,0 +1,114 @@
+package bench
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TimelineInterval is the latency of the successful requests completed in an
+// interval of the run, in milliseconds like Report.Latency. Labels are those
+// of the Summary, so that the intervals of many runs can be told apart.
+type TimelineInterval struct {
+	StartSec   float64
+	LengthSec  float64
+	Count      int64
+	Throughput float64
+	Latency    map[string]float64
+	Labels     map[string]string `json:",omitempty"`
+}
+
+// Timeline returns the percentiles of each interval of the HistogramLog, to
+// see how latency evolved during the run. The Summary only has intervals if
+// SetHistogramLogInterval was called.
+func (s *Summary) Timeline() ([]TimelineInterval, error) {
+	timeline := make([]TimelineInterval, 0, len(s.HistogramLog))
+	for _, interval := range s.HistogramLog {
+		histogram, err := decodeCompressedHistogram(interval.Histogram)
+		if err != nil {
+			return nil, err
+		}
+		count := histogram.TotalCount()
+		timeline = append(timeline, TimelineInterval{
+			StartSec:   interval.Start.Seconds(),
+			LengthSec:  interval.Length.Seconds(),
+			Count:      count,
+			Throughput: float64(count) / interval.Length.Seconds(),
+			Latency:    reportLatency(histogram, s.Percentiles),
+			Labels:     s.Labels,
+		})
+	}
+	return timeline, nil
+}
+
+// WriteTimeline writes the Timeline to a file, as JSON if its extension is
+// .json and as CSV with a column per percentile and then per label otherwise.
+func (s *Summary) WriteTimeline(file string) error {
+	if len(s.HistogramLog) == 0 {
+		return errors.New("the Summary has no intervals to write a timeline from, SetHistogramLogInterval was not called")
+	}
+	timeline, err := s.Timeline()
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(filepath.Ext(file), ".json") {
+		content, err := json.MarshalIndent(timeline, "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(file, append(content, '\n'), 0644)
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	columns := []string{"Start (sec)", "Length (sec)", "Count", "Throughput (req/sec)"}
+	names := make([]string, 0, len(s.Percentiles)+1)
+	for _, percentile := range s.Percentiles {
+		name := PercentileName(percentile)
+		names = append(names, name)
+		columns = append(columns, name+" (ms)")
+	}
+	names = append(names, "max")
+	columns = append(columns, "max (ms)")
+	labels := make([]string, 0, len(s.Labels))
+	for label := range s.Labels {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	columns = append(columns, labels...)
+	if err = w.Write(columns); err != nil {
+		return err
+	}
+
+	for _, interval := range timeline {
+		record := []string{
+			strconv.FormatFloat(interval.StartSec, 'f', 3, 64),
+			strconv.FormatFloat(interval.LengthSec, 'f', 3, 64),
+			strconv.FormatInt(interval.Count, 10),
+			strconv.FormatFloat(interval.Throughput, 'f', 2, 64),
+		}
+		for _, name := range names {
+			record = append(record, strconv.FormatFloat(interval.Latency[name], 'f', 3, 64))
+		}
+		for _, label := range labels {
+			record = append(record, s.Labels[label])
+		}
+		if err = w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+
+	"labench/bench"
+)
+
+// capacitySearch finds the highest request rate which keeps the latency
+// percentile under MaxLatency and the error rate, as a fraction, under
+// MaxErrorRate, by running probe benchmarks of ProbeDuration. The rate is
+// doubled from MinRate until a probe fails or MaxRate is reached, then bisected
+// until it is known within Precision percent.
+type capacitySearch struct {
+	MinRate       uint64        `yaml:"MinRate"`
+	MaxRate       uint64        `yaml:"MaxRate"`
+	Percentile    float64       `yaml:"Percentile"`
+	MaxLatency    time.Duration `yaml:"MaxLatency"`
+	MaxErrorRate  float64       `yaml:"MaxErrorRate"`
+	ProbeDuration time.Duration `yaml:"ProbeDuration"`
+	Precision     float64       `yaml:"Precision"`
+}
+
+// a probe also fails if fewer requests were sent, as all clients were busy
+const minAchievedRatio = 0.95
+
+func (s *capacitySearch) setDefaults() {
+	if s.MinRate == 0 {
+		s.MinRate = 10
+	}
+	if s.MaxRate == 0 {
+		s.MaxRate = 100000
+	}
+	if s.Percentile == 0 {
+		s.Percentile = 99
+	}
+	if s.MaxErrorRate == 0 {
+		s.MaxErrorRate = 0.01
+	}
+	if s.ProbeDuration == 0 {
+		s.ProbeDuration = 10 * time.Second
+	}
+	if s.Precision == 0 {
+		s.Precision = 5
+	}
+}
+
+// capacityProbe is the outcome of a probe benchmark.
+type capacityProbe struct {
+	rate      uint64
+	latency   time.Duration
+	errorRate float64
+	achieved  float64
+	failure   string
+	summary   *bench.Summary
+}
+
+// searchCapacity runs the probes, newProbe returns the benchmark of a rate.
+// It returns the probes in the order they ran and the highest passing one,
+// nil if none passed. The search stops early once stopped returns true, the
+// probe it interrupted is left out.
+func searchCapacity(s capacitySearch, newProbe func(rate uint64) *bench.Benchmark, run func(*bench.Benchmark) *bench.Summary, stopped func() bool) ([]*capacityProbe, *capacityProbe) {
+	var probes []*capacityProbe
+	var best, worst *capacityProbe
+	probeRate := func(rate uint64) bool {
+		slog.Info("Probing", "rate", rate, "duration", s.ProbeDuration)
+		summary := run(newProbe(rate))
+		if stopped() {
+			// cut short, it tells nothing of the rate
+			slog.Warn("Interrupted, the probe is discarded", "rate", rate)
+			return false
+		}
+		probe := s.evaluate(rate, summary)
+		probes = append(probes, probe)
+		if probe.failure == "" {
+			best = probe
+		} else {
+			worst = probe
+		}
+		return probe.failure == ""
+	}
+
+	for rate := s.MinRate; probeRate(rate) && rate < s.MaxRate && !stopped(); {
+		rate *= 2
+		if rate > s.MaxRate {
+			rate = s.MaxRate
+		}
+	}
+
+	for best != nil && worst != nil && !stopped() {
+		precision := uint64(float64(best.rate) * s.Precision / 100)
+		if precision < 1 {
+			precision = 1
+		}
+		if worst.rate-best.rate <= precision {
+			break
+		}
+		probeRate((best.rate + worst.rate) / 2)
+	}
+
+	return probes, best
+}
+
+// evaluate checks the summary of a probe against the targets.
+func (s *capacitySearch) evaluate(rate uint64, summary *bench.Summary) *capacityProbe {
+	probe := &capacityProbe{rate: rate, summary: summary}
+
+	requestTotal := summary.SuccessTotal + summary.ErrorTotal
+	if requestTotal > 0 {
+		probe.errorRate = float64(summary.ErrorTotal) / float64(requestTotal) * 100
+	}
+	if summary.TargetRate > 0 {
+		probe.achieved = summary.AchievedRate / summary.TargetRate
+	}
+	if summary.SuccessHistogram.TotalCount() > 0 {
+		probe.latency = time.Duration(summary.SuccessHistogram.ValueAtQuantile(s.Percentile))
+	}
+
+	switch {
+	case summary.SuccessTotal == 0:
+		probe.failure = "no successful requests"
+	case probe.latency > s.MaxLatency:
+		probe.failure = fmt.Sprintf("p%g latency over %v", s.Percentile, s.MaxLatency)
+	case probe.errorRate > s.MaxErrorRate*100:
+		probe.failure = fmt.Sprintf("error rate over %.4g%%", s.MaxErrorRate*100)
+	case probe.achieved < minAchievedRatio:
+		probe.failure = "requests dropped"
+	}
+	return probe
+}
+
+// printCapacitySearch prints the probes and the rate found.
+func printCapacitySearch(s capacitySearch, probes []*capacityProbe, best *capacityProbe) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Rate (req/sec)", fmt.Sprintf("p%g (ms)", s.Percentile), "Error Rate %", "Achieved %", "Result"})
+	table.SetAlignment(tablewriter.ALIGN_RIGHT)
+	for _, probe := range probes {
+		result := "OK"
+		if probe.failure != "" {
+			result = "FAILED, " + probe.failure
+		}
+		table.Append([]string{
+			strconv.FormatUint(probe.rate, 10),
+			strconv.FormatFloat(float64(probe.latency)/float64(time.Millisecond), 'f', 2, 64),
+			strconv.FormatFloat(probe.errorRate, 'f', 2, 64),
+			strconv.FormatFloat(probe.achieved*100, 'f', 2, 64),
+			result,
+		})
+	}
+	fmt.Println()
+	table.Render()
+
+	if best == nil {
+		fmt.Printf("\nNo rate from %d req/s sustains p%g under %v with under %.4g%% errors\n", s.MinRate, s.Percentile, s.MaxLatency, s.MaxErrorRate*100)
+		return
+	}
+	fmt.Printf("\nMax sustainable rate: %d req/s, p%g %v, %.2f%% errors\n", best.rate, s.Percentile, best.latency, best.errorRate)
+	if best.rate == s.MaxRate {
+		fmt.Println("The MaxRate of the search was reached, the service may sustain more")
+	}
+}
+
+// runCapacitySearch searches the capacity instead of running the benchmark,
+// writes the summary of the best probe to SummaryFile and the Webhook and exits
+// with 1 if no probe passed. The Webhook then gets the last probe, failing the
+// SLA of the search.
+func runCapacitySearch(conf *config, newProbe func(rate uint64) *bench.Benchmark, done <-chan struct{}, stopped func() bool) {
+	s := conf.CapacitySearch
+	s.setDefaults()
+
+	run := func(benchmark *bench.Benchmark) *bench.Summary {
+		summary, err := benchmark.Run(done, false, conf.Params.TightTicker)
+		maybePanic(err)
+		return summary
+	}
+	probes, best := searchCapacity(*s, newProbe, run, stopped)
+	printCapacitySearch(*s, probes, best)
+
+	if conf.Webhook.URL != "" && len(probes) > 0 {
+		notified := best
+		if notified == nil {
+			notified = probes[len(probes)-1]
+		}
+		notified.summary.Labels = conf.Labels
+		notifyWebhook(conf.Webhook, notified.summary, true, best != nil)
+	}
+
+	if best == nil {
+		os.Exit(1)
+	}
+	if conf.Summary != "" {
+		best.summary.Labels = conf.Labels
+		file, err := expandFileName(conf.Summary, newFileNameData(best.summary.StartTime, best.rate, conf.Labels))
+		maybePanic(err)
+		maybePanic(writeSummary(best.summary, file))
+	}
+}
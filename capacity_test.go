@@ -0,0 +1,160 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/codahale/hdrhistogram"
+
+	"labench/bench"
+)
+
+// probeSummary is the summary of a probe of rate which sent 1000 requests.
+func probeSummary(rate uint64, latency time.Duration, errors uint64, achievedRate float64) *bench.Summary {
+	histogram := hdrhistogram.New(1, int64(time.Minute), 3)
+	if err := histogram.RecordValues(int64(latency), int64(1000-errors)); err != nil {
+		panic(err)
+	}
+	return &bench.Summary{
+		SuccessTotal:     1000 - errors,
+		ErrorTotal:       errors,
+		TargetRate:       float64(rate),
+		AchievedRate:     achievedRate,
+		SuccessHistogram: histogram,
+	}
+}
+
+func TestSearchCapacity(t *testing.T) {
+	slowAbove := func(capacity uint64) func(rate uint64) *bench.Summary {
+		return func(rate uint64) *bench.Summary {
+			if rate > capacity {
+				return probeSummary(rate, 500*time.Millisecond, 0, float64(rate))
+			}
+			return probeSummary(rate, 10*time.Millisecond, 0, float64(rate))
+		}
+	}
+
+	tests := []struct {
+		name    string
+		search  capacitySearch
+		service func(rate uint64) *bench.Summary
+		stopAt  uint64
+		rates   []uint64
+		best    uint64
+	}{
+		{
+			name:    "bisected within Precision",
+			search:  capacitySearch{MinRate: 10},
+			service: slowAbove(1000),
+			rates:   []uint64{10, 20, 40, 80, 160, 320, 640, 1280, 960, 1120, 1040, 1000},
+			best:    1000,
+		},
+		{
+			name:    "MaxRate reached",
+			search:  capacitySearch{MinRate: 100, MaxRate: 1000},
+			service: slowAbove(1e9),
+			rates:   []uint64{100, 200, 400, 800, 1000},
+			best:    1000,
+		},
+		{
+			name:    "none passed",
+			search:  capacitySearch{MinRate: 10},
+			service: slowAbove(5),
+			rates:   []uint64{10},
+		},
+		{
+			name:   "error rate as a fraction",
+			search: capacitySearch{MinRate: 50, MaxRate: 150, MaxErrorRate: 0.01},
+			service: func(rate uint64) *bench.Summary {
+				if rate > 100 {
+					return probeSummary(rate, 10*time.Millisecond, 20, float64(rate))
+				}
+				return probeSummary(rate, 10*time.Millisecond, 5, float64(rate))
+			},
+			rates: []uint64{50, 100, 150, 125, 112, 106, 103},
+			best:  100,
+		},
+		{
+			name:   "requests dropped",
+			search: capacitySearch{MinRate: 100, MaxRate: 1000, Precision: 10},
+			service: func(rate uint64) *bench.Summary {
+				if rate > 300 {
+					return probeSummary(rate, 10*time.Millisecond, 0, 300)
+				}
+				return probeSummary(rate, 10*time.Millisecond, 0, float64(rate))
+			},
+			rates: []uint64{100, 200, 400, 300, 350, 325},
+			best:  300,
+		},
+		{
+			name:    "interrupted probe discarded",
+			search:  capacitySearch{MinRate: 10},
+			service: slowAbove(1000),
+			stopAt:  640,
+			rates:   []uint64{10, 20, 40, 80, 160, 320},
+			best:    320,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			search := test.search
+			search.MaxLatency = 100 * time.Millisecond
+			search.setDefaults()
+
+			var rate uint64
+			stopped := false
+			newProbe := func(probeRate uint64) *bench.Benchmark {
+				rate = probeRate
+				return nil
+			}
+			run := func(*bench.Benchmark) *bench.Summary {
+				if test.stopAt != 0 && rate >= test.stopAt {
+					stopped = true
+				}
+				return test.service(rate)
+			}
+			probes, best := searchCapacity(search, newProbe, run, func() bool { return stopped })
+
+			var rates []uint64
+			for _, probe := range probes {
+				rates = append(rates, probe.rate)
+			}
+			if !reflect.DeepEqual(rates, test.rates) {
+				t.Errorf("probed %v, want %v", rates, test.rates)
+			}
+			switch {
+			case best == nil && test.best != 0:
+				t.Errorf("no rate found, want %d", test.best)
+			case best != nil && best.rate != test.best:
+				t.Errorf("found %d, want %d", best.rate, test.best)
+			}
+		})
+	}
+}
+
+func TestEvaluateCapacityProbe(t *testing.T) {
+	search := capacitySearch{MaxLatency: 100 * time.Millisecond}
+	search.setDefaults()
+
+	tests := []struct {
+		name    string
+		summary *bench.Summary
+		failure string
+	}{
+		{"passed", probeSummary(100, 10*time.Millisecond, 10, 100), ""},
+		{"slow", probeSummary(100, 200*time.Millisecond, 0, 100), "p99 latency over 100ms"},
+		{"errors", probeSummary(100, 10*time.Millisecond, 11, 100), "error rate over 1%"},
+		{"dropped", probeSummary(100, 10*time.Millisecond, 0, 94), "requests dropped"},
+		{"no successes", probeSummary(100, 10*time.Millisecond, 1000, 100), "no successful requests"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if probe := search.evaluate(100, test.summary); probe.failure != test.failure {
+				t.Errorf("got %q, want %q", probe.failure, test.failure)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// breakerConfig opens the circuit of a target after ConsecutiveFailures
+// failed requests in a row, defaulting to 5, and probes it again with a single
+// request after CoolDown, defaulting to 10s.
+type breakerConfig struct {
+	ConsecutiveFailures int           `yaml:"ConsecutiveFailures"`
+	CoolDown            time.Duration `yaml:"CoolDown"`
+}
+
+// circuitBreakers are all the breakers of the run, to report on at the end.
+var (
+	circuitBreakersMu sync.Mutex
+	circuitBreakers   []*circuitBreaker
+)
+
+// circuitBreaker stops sending to a target which keeps failing. It is shared
+// by all clients, so the failures of all of them count.
+type circuitBreaker struct {
+	target    string
+	threshold int
+	coolDown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	open     bool
+	probing  bool
+	openedAt time.Time
+	retryAt  time.Time
+	opened   int
+	openFor  time.Duration
+}
+
+// newCircuitBreakers returns a breaker for each target.
+func newCircuitBreakers(config breakerConfig, targets []string) []*circuitBreaker {
+	if config.ConsecutiveFailures == 0 {
+		config.ConsecutiveFailures = 5
+	}
+	if config.CoolDown == 0 {
+		config.CoolDown = 10 * time.Second
+	}
+
+	breakers := make([]*circuitBreaker, len(targets))
+	for i, target := range targets {
+		breakers[i] = &circuitBreaker{target: target, threshold: config.ConsecutiveFailures, coolDown: config.CoolDown}
+	}
+
+	circuitBreakersMu.Lock()
+	defer circuitBreakersMu.Unlock()
+	circuitBreakers = append(circuitBreakers, breakers...)
+	return breakers
+}
+
+// pickTarget returns the first target from i on whose breaker lets a request
+// through, false if all of them are open.
+func pickTarget(breakers []*circuitBreaker, i int) (int, bool) {
+	for k := range breakers {
+		j := (i + k) % len(breakers)
+		if breakers[j].allow() {
+			return j, true
+		}
+	}
+	return 0, false
+}
+
+// allow reports whether a request may be sent to the target, always if the
+// circuit is closed and to a single probe once the cool-down passed if open.
+func (c *circuitBreaker) allow() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.open {
+		return true
+	}
+	if c.probing || time.Now().Before(c.retryAt) {
+		return false
+	}
+	c.probing = true
+	slog.Info("Circuit breaker half-open, probing target", "target", c.target)
+	return true
+}
+
+// record counts the outcome of a request sent to the target, a success closes
+// the circuit and enough failures in a row open it.
+func (c *circuitBreaker) record(failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if !failed {
+		c.failures = 0
+		if c.open {
+			c.open, c.probing = false, false
+			c.openFor += now.Sub(c.openedAt)
+			slog.Warn("Circuit breaker closed, target recovered", "target", c.target, "wasOpenFor", now.Sub(c.openedAt).Round(time.Millisecond))
+		}
+		return
+	}
+
+	c.failures++
+	if c.open {
+		// a failed probe waits for another cool-down, requests sent before the
+		// circuit opened don't
+		if c.probing {
+			c.probing = false
+			c.retryAt = now.Add(c.coolDown)
+			slog.Info("Circuit breaker probe failed, target stays open", "target", c.target, "coolDown", c.coolDown)
+		}
+		return
+	}
+	if c.failures >= c.threshold {
+		c.open = true
+		c.openedAt, c.retryAt = now, now.Add(c.coolDown)
+		c.opened++
+		slog.Warn("Circuit breaker opened, not sending to target", "target", c.target, "consecutiveFailures", c.failures, "coolDown", c.coolDown)
+	}
+}
+
+// reportCircuitBreakers logs how often and how long the circuit of each
+// target was open during the run, and forgets them for the next run.
+func reportCircuitBreakers() {
+	circuitBreakersMu.Lock()
+	defer circuitBreakersMu.Unlock()
+
+	for _, c := range circuitBreakers {
+		c.mu.Lock()
+		openFor := c.openFor
+		if c.open {
+			openFor += time.Since(c.openedAt)
+		}
+		if c.opened > 0 {
+			slog.Warn("Circuit breaker of target was open", "target", c.target, "times", c.opened, "openFor", openFor.Round(time.Millisecond), "openAtEnd", c.open)
+		}
+		c.mu.Unlock()
+	}
+	circuitBreakers = nil
+}
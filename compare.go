@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+
+	"labench/bench"
+)
+
+const (
+	compareUsage = "Usage: %s compare <baseline.json> <candidate.json> [-threshold [metric=]percent]...\n" +
+		"\tCompares two SummaryFile reports, exits with 1 if a metric regressed by more than its threshold, %g%% by default\n" +
+		"\tMetrics are latency percentiles named p50, p99.9 etc. and max, Throughput and ErrorRate, whose threshold is in percentage points"
+
+	defaultRegressionThreshold = 10.
+)
+
+// comparedMetric is a metric of two runs and how much worse the candidate is.
+type comparedMetric struct {
+	name       string
+	baseline   float64
+	candidate  float64
+	regression float64 // percent, or percentage points for ErrorRate
+}
+
+// compareCommand compares the SummaryFile reports of a baseline and a
+// candidate run, for gating performance regressions in CI.
+func compareCommand(args []string) {
+	usageText := fmt.Sprintf(compareUsage, os.Args[0], defaultRegressionThreshold)
+
+	var files []string
+	defaultThreshold := defaultRegressionThreshold
+	thresholds := make(map[string]float64)
+	for i := 0; i < len(args); i++ {
+		if args[i] != "-threshold" {
+			files = append(files, args[i])
+			continue
+		}
+
+		if i+1 == len(args) {
+			usage(usageText)
+		}
+		i++
+		metric, value := "", args[i]
+		if sep := strings.IndexByte(value, '='); sep >= 0 {
+			metric, value = strings.ToLower(value[:sep]), value[sep+1:]
+		}
+		threshold, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil || threshold < 0 {
+			usage(fmt.Sprintf("Invalid threshold %q\n%s", args[i], usageText))
+		}
+		if metric == "" {
+			defaultThreshold = threshold
+		} else {
+			thresholds[metric] = threshold
+		}
+	}
+	if len(files) != 2 {
+		usage(usageText)
+	}
+
+	baseline, err := readReport(files[0])
+	maybePanic(err)
+	candidate, err := readReport(files[1])
+	maybePanic(err)
+
+	metrics := compareReports(baseline, candidate)
+	for metric := range thresholds {
+		known := false
+		for _, m := range metrics {
+			known = known || strings.EqualFold(m.name, metric)
+		}
+		assert(known, fmt.Sprintf("Unknown metric %q in threshold, the reports have %v", metric, metricNames(metrics)))
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Metric", "Baseline", "Candidate", "Regression", "Threshold", ""})
+	table.SetAlignment(tablewriter.ALIGN_RIGHT)
+	regressed := 0
+	for _, m := range metrics {
+		threshold, ok := thresholds[strings.ToLower(m.name)]
+		if !ok {
+			threshold = defaultThreshold
+		}
+
+		unit := "%"
+		if m.name == "ErrorRate" {
+			unit = " pp"
+		}
+		verdict := "OK"
+		if m.regression > threshold {
+			verdict = "REGRESSED"
+			regressed++
+		}
+		table.Append([]string{
+			m.name,
+			strconv.FormatFloat(m.baseline, 'f', 2, 64),
+			strconv.FormatFloat(m.candidate, 'f', 2, 64),
+			strconv.FormatFloat(m.regression, 'f', 2, 64) + unit,
+			strconv.FormatFloat(threshold, 'f', 2, 64) + unit,
+			verdict,
+		})
+	}
+	table.Render()
+
+	if regressed > 0 {
+		fmt.Println(regressed, "of", len(metrics), "metrics regressed beyond their threshold")
+		os.Exit(1)
+	}
+	fmt.Println("No regressions beyond the thresholds")
+}
+
+func readReport(file string) (*bench.Report, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var report bench.Report
+	if err = json.Unmarshal(content, &report); err != nil {
+		return nil, fmt.Errorf("%s is not a SummaryFile report: %v", file, err)
+	}
+	return &report, nil
+}
+
+// compareReports returns the latency percentiles both reports have, in
+// increasing order, then max, Throughput and ErrorRate. Regressions are
+// relative, except for ErrorRate where it is the difference.
+func compareReports(baseline, candidate *bench.Report) []comparedMetric {
+	var percentiles []float64
+	for name := range baseline.Latency {
+		if _, ok := candidate.Latency[name]; !ok || name == "max" {
+			continue
+		}
+		if percentile, err := strconv.ParseFloat(strings.TrimPrefix(name, "p"), 64); err == nil {
+			percentiles = append(percentiles, percentile)
+		}
+	}
+	sort.Float64s(percentiles)
+
+	var metrics []comparedMetric
+	addLatency := func(name string) {
+		b, c := baseline.Latency[name], candidate.Latency[name]
+		metrics = append(metrics, comparedMetric{name, b, c, relativeChange(b, c)})
+	}
+	for _, percentile := range percentiles {
+		addLatency(bench.PercentileName(percentile))
+	}
+	if _, ok := baseline.Latency["max"]; ok {
+		addLatency("max")
+	}
+
+	// lower throughput is worse
+	metrics = append(metrics, comparedMetric{"Throughput", baseline.Throughput, candidate.Throughput, -relativeChange(baseline.Throughput, candidate.Throughput)})
+
+	baselineErrors, candidateErrors := errorRate(baseline), errorRate(candidate)
+	metrics = append(metrics, comparedMetric{"ErrorRate", baselineErrors, candidateErrors, candidateErrors - baselineErrors})
+
+	return metrics
+}
+
+// relativeChange returns the change from baseline to candidate in percent.
+func relativeChange(baseline, candidate float64) float64 {
+	if baseline == 0 {
+		if candidate == 0 {
+			return 0
+		}
+		return math.Inf(int(math.Copysign(1, candidate)))
+	}
+	return (candidate - baseline) / baseline * 100
+}
+
+func errorRate(report *bench.Report) float64 {
+	if report.RequestTotal == 0 {
+		return 0
+	}
+	return float64(report.ErrorTotal) / float64(report.RequestTotal) * 100
+}
+
+func metricNames(metrics []comparedMetric) []string {
+	names := make([]string, len(metrics))
+	for i, m := range metrics {
+		names[i] = m.name
+	}
+	return names
+}
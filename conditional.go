@@ -0,0 +1,60 @@
+package main
+
+import "net/http"
+
+// maxCacheValidators is how many URLs each client remembers the validators of,
+// so that templated URLs don't grow them without bound. URLs past it are sent
+// unconditionally.
+const maxCacheValidators = 10000
+
+// cacheValidators are what a response said about its version, sent back with
+// the next request to the same URL to get 304 Not Modified if it's unchanged.
+type cacheValidators struct {
+	etag         string
+	lastModified string
+}
+
+// conditionalHeaders adds If-None-Match and If-Modified-Since to headers from
+// the validators of the last response to reqURL, if there was one.
+func (w *webRequester) conditionalHeaders(reqURL string, headers map[string][]string) {
+	validators, ok := w.validators[reqURL]
+	if !ok {
+		return
+	}
+	if validators.etag != "" {
+		headers["If-None-Match"] = []string{validators.etag}
+	}
+	if validators.lastModified != "" {
+		headers["If-Modified-Since"] = []string{validators.lastModified}
+	}
+}
+
+// rememberValidators keeps the ETag and Last-Modified of a response to reqURL
+// for the next request to it. A 304 may leave them out, then the previous
+// ones still apply.
+func (w *webRequester) rememberValidators(reqURL string, resp *http.Response) {
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return
+	}
+	if resp.StatusCode != http.StatusNotModified && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		return
+	}
+	if _, ok := w.validators[reqURL]; !ok && len(w.validators) >= maxCacheValidators {
+		return
+	}
+	w.validators[reqURL] = cacheValidators{etag: etag, lastModified: lastModified}
+}
+
+// acceptedStatus reports whether a status counts as success.
+func (w *webRequester) acceptedStatus(statusCode int) bool {
+	if statusCode == w.expectedReturnCode {
+		return true
+	}
+	for _, status := range w.acceptedCodes {
+		if statusCode == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// envReference matches ${VAR} and ${VAR:-default} in a config, and $${ which
+// stands for a literal ${.
+var envReference = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// legacyEnvReference also matches $VAR, which the options of legacyEnvFields
+// expanded before ${VAR} could be used everywhere. It's expanded for them in
+// the same pass, so that a value from the environment isn't expanded again, and
+// to nothing if VAR is not set, as it was then.
+var legacyEnvReference = regexp.MustCompile(envReference.String() + `|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// legacyEnvFields are the options whose values, and the values under them,
+// expand $VAR.
+var legacyEnvFields = map[string]bool{
+	"Headers":      true,
+	"UserAgent":    true,
+	"BearerToken":  true,
+	"Username":     true,
+	"Password":     true,
+	"ClientID":     true,
+	"ClientSecret": true,
+}
+
+// expandEnvVars substitutes environment variables in the values of a config
+// before it is unmarshalled. The scalars of the parsed document are replaced
+// and the document is written back, so that a value can't change the
+// structure of the config whatever it holds. A plain value, unlike a quoted
+// one, may become a number or a boolean, so that any value can come from the
+// environment. A variable without a default must be set, even if to an empty
+// value. Comments are left alone.
+func expandEnvVars(content []byte) ([]byte, error) {
+	var document yamlv3.Node
+	if err := yamlv3.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+	if document.Kind == 0 {
+		// an empty config
+		return content, nil
+	}
+
+	var undefined []string
+	expandEnvNode(&document, false, &undefined)
+	if len(undefined) > 0 {
+		return nil, fmt.Errorf("environment variables %s are not set, set them or give a default as ${VAR:-default}", strings.Join(undefined, ", "))
+	}
+
+	var out bytes.Buffer
+	encoder := yamlv3.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// expandEnvNode substitutes the variables of the scalars under node, adding
+// the variables which are not set to undefined. legacy is set under the
+// options of legacyEnvFields. Aliases are expanded where their anchor is.
+func expandEnvNode(node *yamlv3.Node, legacy bool, undefined *[]string) {
+	switch node.Kind {
+	case yamlv3.DocumentNode, yamlv3.SequenceNode:
+		for _, child := range node.Content {
+			expandEnvNode(child, legacy, undefined)
+		}
+
+	case yamlv3.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			expandEnvNode(key, legacy, undefined)
+			expandEnvNode(value, legacy || legacyEnvFields[key.Value], undefined)
+		}
+
+	case yamlv3.ScalarNode:
+		expanded := expandEnvString(node.Value, legacy, undefined)
+		if expanded == node.Value {
+			return
+		}
+		node.Value = expanded
+		if node.Style&(yamlv3.TaggedStyle|yamlv3.DoubleQuotedStyle|yamlv3.SingleQuotedStyle|yamlv3.LiteralStyle|yamlv3.FoldedStyle) == 0 {
+			// resolved again like the value had been written in the config
+			node.Tag = ""
+		}
+	}
+}
+
+// expandEnvString substitutes the variables of a value, and $VAR too if it's
+// legacy.
+func expandEnvString(value string, legacy bool, undefined *[]string) string {
+	reference := envReference
+	if legacy {
+		reference = legacyEnvReference
+	}
+	return reference.ReplaceAllStringFunc(value, func(text string) string {
+		if text == "$${" {
+			return "${"
+		}
+
+		match := reference.FindStringSubmatch(text)
+		if legacy && match[4] != "" {
+			return os.Getenv(match[4])
+		}
+		if value, ok := os.LookupEnv(match[1]); ok {
+			return value
+		}
+		if match[2] != "" {
+			return match[3]
+		}
+		if !contains(*undefined, match[1]) {
+			*undefined = append(*undefined, match[1])
+		}
+		return text
+	})
+}
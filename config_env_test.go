@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestExpandEnvVars(t *testing.T) {
+	t.Setenv("LABENCH_TEST_TOKEN", "s3cr3t")
+	t.Setenv("LABENCH_TEST_RATE", "250")
+	t.Setenv("LABENCH_TEST_EMPTY", "")
+	t.Setenv("LABENCH_TEST_YAML", "a #b: \"c\"\nd: e")
+	t.Setenv("LABENCH_TEST_DOLLAR", "abc$LABENCH_TEST_TOKEN")
+	t.Setenv("LABENCH_TEST_OCTAL", "0123")
+
+	tests := []struct {
+		name   string
+		config string
+		check  func(conf *config) string
+		want   string
+	}{
+		{
+			name:   "variable",
+			config: "Request:\n  BearerToken: ${LABENCH_TEST_TOKEN}\n",
+			check:  func(conf *config) string { return conf.Request.BearerToken },
+			want:   "s3cr3t",
+		},
+		{
+			name:   "variable within a value",
+			config: "Request:\n  URL: https://host/${LABENCH_TEST_TOKEN}/x\n",
+			check:  func(conf *config) string { return conf.Request.URL },
+			want:   "https://host/s3cr3t/x",
+		},
+		{
+			name:   "default",
+			config: "Request:\n  URL: ${LABENCH_TEST_UNSET:-https://fallback/}\n",
+			check:  func(conf *config) string { return conf.Request.URL },
+			want:   "https://fallback/",
+		},
+		{
+			name:   "empty default",
+			config: "Request:\n  Body: \"${LABENCH_TEST_UNSET:-}\"\n",
+			check:  func(conf *config) string { return conf.Request.Body },
+			want:   "",
+		},
+		{
+			name:   "set to empty wins over the default",
+			config: "Request:\n  Body: \"${LABENCH_TEST_EMPTY:-x}\"\n",
+			check:  func(conf *config) string { return conf.Request.Body },
+			want:   "",
+		},
+		{
+			name:   "escaped",
+			config: "Request:\n  Body: \"$${LABENCH_TEST_TOKEN}\"\n",
+			check:  func(conf *config) string { return conf.Request.Body },
+			want:   "${LABENCH_TEST_TOKEN}",
+		},
+		{
+			name:   "plain number",
+			config: "RequestRatePerSec: ${LABENCH_TEST_RATE}\n",
+			check:  func(conf *config) string { return fmt.Sprint(conf.Params.RequestRatePerSec) },
+			want:   "250",
+		},
+		{
+			name:   "plain number in a string keeps its text",
+			config: "Request:\n  Password: ${LABENCH_TEST_OCTAL}\n",
+			check:  func(conf *config) string { return conf.Request.Password },
+			want:   "0123",
+		},
+		{
+			name:   "YAML syntax stays in the value",
+			config: "Request:\n  Headers:\n    X-Value: ${LABENCH_TEST_YAML}\n",
+			check: func(conf *config) string {
+				return fmt.Sprintf("%d %s", len(conf.Request.Headers), conf.Request.Headers["X-Value"])
+			},
+			want: "1 a #b: \"c\"\nd: e",
+		},
+		{
+			name:   "YAML syntax stays in a quoted value",
+			config: "Request:\n  Body: \"${LABENCH_TEST_YAML}\"\n",
+			check:  func(conf *config) string { return conf.Request.Body },
+			want:   "a #b: \"c\"\nd: e",
+		},
+		{
+			name:   "comments are not substituted",
+			config: "# ${LABENCH_TEST_UNSET}\nRequest:\n  Body: x # ${LABENCH_TEST_UNSET}\n",
+			check:  func(conf *config) string { return conf.Request.Body },
+			want:   "x",
+		},
+		{
+			name:   "values from the environment are not expanded again",
+			config: "Request:\n  BearerToken: ${LABENCH_TEST_DOLLAR}\n",
+			check:  func(conf *config) string { return conf.Request.BearerToken },
+			want:   "abc$LABENCH_TEST_TOKEN",
+		},
+		{
+			name:   "legacy $VAR in Headers",
+			config: "Request:\n  Headers:\n    Authorization: Bearer $LABENCH_TEST_TOKEN\n",
+			check:  func(conf *config) string { return conf.Request.Headers["Authorization"] },
+			want:   "Bearer s3cr3t",
+		},
+		{
+			name:   "legacy $VAR not set",
+			config: "Request:\n  Password: x$LABENCH_TEST_UNSET\n",
+			check:  func(conf *config) string { return conf.Request.Password },
+			want:   "x",
+		},
+		{
+			name:   "$VAR is left alone elsewhere",
+			config: "Request:\n  Body: '{\"$LABENCH_TEST_TOKEN\": 1}'\n",
+			check:  func(conf *config) string { return conf.Request.Body },
+			want:   "{\"$LABENCH_TEST_TOKEN\": 1}",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content, err := expandEnvVars([]byte(test.config))
+			if err != nil {
+				t.Fatalf("expandEnvVars: %v", err)
+			}
+			var conf config
+			if err := yaml.Unmarshal(content, &conf); err != nil {
+				t.Fatalf("unmarshal %q: %v", content, err)
+			}
+			if got := test.check(&conf); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExpandEnvVarsUndefined(t *testing.T) {
+	_, err := expandEnvVars([]byte("Request:\n  URL: ${LABENCH_TEST_UNSET}\n  Body: ${LABENCH_TEST_UNSET2}${LABENCH_TEST_UNSET}\n"))
+	if err == nil {
+		t.Fatal("expected an error for variables which are not set")
+	}
+	if !strings.Contains(err.Error(), "LABENCH_TEST_UNSET, LABENCH_TEST_UNSET2 ") {
+		t.Errorf("the error should list each variable once, got %q", err)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"sync"
+)
+
+var (
+	cookieClientsMu sync.Mutex
+	cookieClients   = make(map[uint64]*http.Client)
+)
+
+// clientWithCookieJar returns the HTTP client of a Benchmark connection which
+// sends through client, stores the cookies set by responses and sends them
+// with its later requests.
+// The jar is shared by all request definitions of the connection, so that a
+// session started by a login request carries over to the others, but not
+// with other connections.
+func clientWithCookieJar(number uint64, client *http.Client) *http.Client {
+	cookieClientsMu.Lock()
+	defer cookieClientsMu.Unlock()
+
+	withJar, ok := cookieClients[number]
+	if !ok {
+		// the jar of a single client doesn't need the public suffix list
+		jar, err := cookiejar.New(nil)
+		maybePanic(err)
+
+		withJar = &http.Client{}
+		*withJar = *client
+		withJar.Jar = jar
+		cookieClients[number] = withJar
+	}
+	return withJar
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// acceptEncoding is what is asked for when decompressResponses is set. The
+// transports never ask for compression themselves, so that the bytes on the
+// wire can be counted.
+const acceptEncoding = "gzip, deflate, br"
+
+var decompressResponses = true
+
+// initDecompression makes the requests ask for gzip, deflate and Brotli
+// compressed responses and decode them, or send no Accept-Encoding at all so
+// that only the bodies as the server sends them by default are measured.
+func initDecompression(enabled bool) {
+	decompressResponses = enabled
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// decodedBody returns the body of a response decoded according to its
+// Content-Encoding, and the reader counting its bytes on the wire. The body
+// is returned as is if it's not compressed, or responses are not decompressed.
+func decodedBody(resp *http.Response) (io.Reader, *countingReader, bool) {
+	wire := &countingReader{r: resp.Body}
+	if !decompressResponses {
+		return wire, wire, false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		return &lazyDecoder{open: func() (io.Reader, error) { return gzip.NewReader(wire) }}, wire, true
+	case "deflate":
+		return &lazyDecoder{open: func() (io.Reader, error) { return zlib.NewReader(wire) }}, wire, true
+	case "br":
+		return brotli.NewReader(wire), wire, true
+	}
+	return wire, wire, false
+}
+
+// lazyDecoder opens its decoder on the first Read, as opening one already
+// reads the header of the compressed stream.
+type lazyDecoder struct {
+	open    func() (io.Reader, error)
+	decoder io.Reader
+}
+
+func (d *lazyDecoder) Read(p []byte) (int, error) {
+	if d.decoder == nil {
+		decoder, err := d.open()
+		if err != nil {
+			return 0, err
+		}
+		d.decoder = decoder
+	}
+	return d.decoder.Read(p)
+}
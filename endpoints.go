@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"gopkg.in/yaml.v2"
+
+	"labench/bench"
+)
+
+// endpoint is one of the Endpoints benchmarked in turn, with the Request and
+// the load profile of the config. Name tells the output files of its run
+// apart.
+type endpoint struct {
+	Name string `yaml:"Name"`
+	URL  string `yaml:"URL"`
+}
+
+// endpointResult is the outcome of the run of an endpoint, for the overview.
+type endpointResult struct {
+	endpoint  endpoint
+	summary   *bench.Summary
+	slaPassed bool
+}
+
+// withURL returns a copy of the request sent to url. It's copied through
+// YAML, so that none of the state prepared for the request is shared.
+func (w *WebRequesterFactory) withURL(url string) *WebRequesterFactory {
+	content, err := yaml.Marshal(w)
+	maybePanic(err)
+
+	var request WebRequesterFactory
+	maybePanic(yaml.Unmarshal(content, &request))
+	request.URL = url
+	return &request
+}
+
+// endpointFile returns the name of a file of the run of an endpoint, with the
+// name of the endpoint before the extension, e.g. out/res-home.hgrm.
+func endpointFile(file, name string) string {
+	if file == "" {
+		return ""
+	}
+	ext := path.Ext(file)
+	return strings.TrimSuffix(file, ext) + "-" + name + ext
+}
+
+// variesByEndpoint returns whether the name of a file expands differently for
+// each endpoint, as with {{.Label}} or {{.Labels.endpoint}}.
+func variesByEndpoint(file string, rate uint64, labels map[string]string) bool {
+	names := make([]string, 2)
+	start := time.Now()
+	for i, name := range []string{"a", "b"} {
+		endpointLabels := map[string]string{"endpoint": name}
+		for label, value := range labels {
+			endpointLabels[label] = value
+		}
+		expanded, err := expandFileName(file, newFileNameData(start, rate, endpointLabels))
+		maybePanic(err)
+		names[i] = expanded
+	}
+	return names[0] != names[1]
+}
+
+// runEndpoints runs a benchmark for each of the Endpoints in turn, each
+// writing its own output files and labeled with the endpoint, then prints an
+// overview of all of them. The name of the endpoint is added to the files
+// whose names don't already expand to one per endpoint. A SummaryFile ending
+// with .jsonl is shared, the runs are appended to it. It returns whether any
+// run was aborted and whether all of them passed the SLA.
+func runEndpoints(conf *config, newRun func(factory bench.RequesterFactory) *bench.Benchmark, format bench.DistributionFormat, done chan struct{}, stopped func() bool) (bool, bool) {
+	if conf.Output == "" {
+		conf.Output = "out/res" + format.Extension()
+	}
+	files := outputFiles(conf)
+	baseFiles := make(map[string]string, len(files))
+	suffixed := make(map[string]bool, len(files))
+	for name, file := range files {
+		baseFiles[name] = *file
+		shared := name == "SummaryFile" && strings.HasSuffix(*file, ".jsonl")
+		suffixed[name] = !shared && !variesByEndpoint(*file, conf.Params.RequestRatePerSec, conf.Labels)
+	}
+	labels := conf.Labels
+
+	// the requests are prepared up front, so that they fail before the first run
+	requests := make([]*WebRequesterFactory, len(conf.Endpoints))
+	for i, e := range conf.Endpoints {
+		requests[i] = conf.Request.withURL(e.URL)
+		requests[i].ensurePrepared()
+	}
+
+	var results []endpointResult
+	for i, e := range conf.Endpoints {
+		if stopped() {
+			slog.Warn("Interrupted, the remaining endpoints are not benchmarked", "skipped", len(conf.Endpoints)-i)
+			break
+		}
+		conf.Labels = map[string]string{"endpoint": e.Name}
+		for name, value := range labels {
+			conf.Labels[name] = value
+		}
+		for name, file := range files {
+			*file = baseFiles[name]
+		}
+		expandOutputFiles(conf, newFileNameData(time.Now(), conf.Params.RequestRatePerSec, conf.Labels))
+		for name, file := range files {
+			if suffixed[name] {
+				*file = endpointFile(*file, e.Name)
+			}
+		}
+
+		// the connections of the endpoint before are neither counted nor reused
+		if i > 0 {
+			closeIdleConnections()
+		}
+
+		slog.Info("Benchmarking endpoint", "endpoint", e.Name, "url", e.URL, "n", i+1, "of", len(conf.Endpoints))
+		summary, slaPassed := runBenchmark(conf, newRun(requests[i]), format, done)
+		results = append(results, endpointResult{e, summary, slaPassed})
+	}
+
+	printEndpoints(results, conf.SLA != nil)
+
+	aborted, slaPassed := false, true
+	for _, result := range results {
+		aborted = aborted || result.summary.AbortReason != ""
+		slaPassed = slaPassed && result.slaPassed
+	}
+	return aborted, slaPassed
+}
+
+// printEndpoints prints an overview of the runs of the endpoints.
+func printEndpoints(results []endpointResult, slaChecked bool) {
+	header := []string{"Endpoint", "Requests", "Success %", "Throughput (req/sec)", "p50 (ms)", "p99 (ms)", "Max (ms)"}
+	if slaChecked {
+		header = append(header, "SLA")
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(header)
+	table.SetAlignment(tablewriter.ALIGN_RIGHT)
+	for _, result := range results {
+		report := result.summary.Report()
+		histogram := result.summary.SuccessHistogram
+		row := []string{
+			result.endpoint.Name,
+			strconv.FormatUint(report.RequestTotal, 10),
+			strconv.FormatFloat(report.SuccessRate, 'f', 2, 64),
+			strconv.FormatFloat(report.Throughput, 'f', 2, 64),
+			strconv.FormatFloat(float64(histogram.ValueAtQuantile(50))/1e6, 'f', 2, 64),
+			strconv.FormatFloat(float64(histogram.ValueAtQuantile(99))/1e6, 'f', 2, 64),
+			strconv.FormatFloat(float64(histogram.Max())/1e6, 'f', 2, 64),
+		}
+		if slaChecked {
+			row = append(row, map[bool]string{true: "PASS", false: "FAIL"}[result.slaPassed])
+		}
+		if result.summary.AbortReason != "" {
+			row[0] += fmt.Sprintf(" (aborted: %s)", result.summary.AbortReason)
+		}
+		table.Append(row)
+	}
+	fmt.Println()
+	table.Render()
+}
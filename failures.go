@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"labench/bench"
+)
+
+// failureLogConfig is where failed requests are logged and how much of them.
+// MaxBodyBytes defaults to 1024 and MaxFailures to 1000.
+type failureLogConfig struct {
+	File         string   `yaml:"File"`
+	MaxBodyBytes int      `yaml:"MaxBodyBytes"`
+	MaxFailures  int      `yaml:"MaxFailures"`
+	Headers      []string `yaml:"Headers"`
+}
+
+// failureBodyBytes is how much of the response bodies is kept in case the
+// request fails, zero if failures are not logged. failureHeaders are the
+// response headers logged.
+var (
+	failureBodyBytes int
+	failureHeaders   []string
+)
+
+// failedRequest is a failed request as written to the failure log.
+type failedRequest struct {
+	Timestamp     time.Time
+	LatencyMs     float64
+	Method        string `json:",omitempty"`
+	URL           string `json:",omitempty"`
+	StatusCode    int    `json:",omitempty"`
+	Error         string
+	RequestID     string            `json:",omitempty"`
+	Headers       map[string]string `json:",omitempty"`
+	Body          string            `json:",omitempty"`
+	BodyTruncated bool              `json:",omitempty"`
+}
+
+// detailedError is the error of a failed request along with what was sent and
+// received, for the failure log. It is the error for everything else.
+type detailedError struct {
+	error
+	details *failedRequest
+}
+
+func (e *detailedError) Unwrap() error { return e.error }
+
+// withDetails attaches the request and response to the error of a failed
+// request if failures are logged, resp and body are nil without a response.
+func withDetails(err error, req *http.Request, resp *http.Response, body *bodyPrefix) error {
+	if failureBodyBytes == 0 {
+		return err
+	}
+
+	details := &failedRequest{Method: req.Method, URL: req.URL.String()}
+	if resp != nil {
+		details.StatusCode = resp.StatusCode
+		for _, name := range failureHeaders {
+			if values := resp.Header.Values(name); len(values) > 0 {
+				if details.Headers == nil {
+					details.Headers = make(map[string]string, len(failureHeaders))
+				}
+				details.Headers[name] = strings.Join(values, ", ")
+			}
+		}
+	}
+	if body != nil {
+		details.Body, details.BodyTruncated = string(body.buf), body.truncated
+	}
+	return &detailedError{err, details}
+}
+
+// bodyPrefix keeps the start of a response body as it's written through.
+type bodyPrefix struct {
+	buf       []byte
+	truncated bool
+}
+
+// newBodyPrefix returns a bodyPrefix if failures are logged, nil otherwise.
+func newBodyPrefix() *bodyPrefix {
+	if failureBodyBytes == 0 {
+		return nil
+	}
+	return &bodyPrefix{}
+}
+
+// Write keeps what fits of p, all of it counts as written.
+func (b *bodyPrefix) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := failureBodyBytes - len(b.buf); n > room {
+		p, b.truncated = p[:room], true
+	}
+	b.buf = append(b.buf, p...)
+	return n, nil
+}
+
+// failureLog writes failed requests to a file as JSON lines, up to a number
+// of them. Like RawLatencyFile they are written on a separate goroutine and
+// dropped if it can't keep up.
+type failureLog struct {
+	file        *os.File
+	maxFailures int
+	logged      int
+	skipped     int
+	queue       chan failedRequest
+	done        chan error
+}
+
+// startFailureLog observes benchmark and starts writing its failed requests
+// to the file of config.
+func startFailureLog(benchmark *bench.Benchmark, config failureLogConfig) (*failureLog, error) {
+	err := os.MkdirAll(path.Dir(config.File), os.ModeDir|os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(config.File)
+	if err != nil {
+		return nil, err
+	}
+
+	failureBodyBytes = config.MaxBodyBytes
+	if failureBodyBytes == 0 {
+		failureBodyBytes = 1024
+	}
+	failureHeaders = make([]string, len(config.Headers))
+	for i, name := range config.Headers {
+		failureHeaders[i] = http.CanonicalHeaderKey(name)
+	}
+
+	l := &failureLog{
+		file:        f,
+		maxFailures: config.MaxFailures,
+		queue:       make(chan failedRequest, 10000),
+		done:        make(chan error, 1),
+	}
+	if l.maxFailures == 0 {
+		l.maxFailures = 1000
+	}
+	benchmark.AddObserver(l)
+
+	go func() { l.done <- l.write() }()
+
+	return l, nil
+}
+
+// Observe implements bench.Observer.
+func (l *failureLog) Observe(start time.Time, latency time.Duration, result bench.Result, err error) {
+	if err == nil {
+		return
+	}
+	if l.logged >= l.maxFailures {
+		l.skipped++
+		return
+	}
+
+	failure := failedRequest{StatusCode: result.StatusCode}
+	var detailed *detailedError
+	if errors.As(err, &detailed) {
+		failure = *detailed.details
+	}
+	failure.Timestamp = start.UTC()
+	failure.LatencyMs = float64(latency) / float64(time.Millisecond)
+	failure.Error = err.Error()
+	failure.RequestID = result.RequestID
+
+	select {
+	case l.queue <- failure:
+		l.logged++
+	default:
+		// only the collector goroutine queues failures
+		l.skipped++
+	}
+}
+
+func (l *failureLog) write() error {
+	buffered := bufio.NewWriter(l.file)
+	encoder := json.NewEncoder(buffered)
+	for failure := range l.queue {
+		if err := encoder.Encode(failure); err != nil {
+			return err
+		}
+	}
+	return buffered.Flush()
+}
+
+// close writes the failures still queued and closes the file.
+func (l *failureLog) close() error {
+	close(l.queue)
+	err := <-l.done
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if l.skipped > 0 {
+		slog.Warn("Failed requests were left out of FailureLog, MaxFailures was reached or writing could not keep up", "logged", l.logged, "skipped", l.skipped)
+	}
+	return err
+}
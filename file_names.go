@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// fileNameData is what the names of the output files may refer to, as
+// templates such as out/{{.Timestamp}}-{{.Rate}}.hgrm, so that the runs of a
+// sweep don't overwrite each other. Timestamp is the start of the run in UTC
+// as 20060102-150405, Label the values of the Labels sorted by name and joined
+// with -, and Labels.name a single label.
+type fileNameData struct {
+	Timestamp string
+	Rate      uint64
+	Label     string
+	Labels    map[string]string
+}
+
+// newFileNameData returns the data of the file names of a run starting at
+// start with the rate and labels.
+func newFileNameData(start time.Time, rate uint64, labels map[string]string) fileNameData {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = fileNameSafe(labels[name])
+	}
+
+	safeLabels := make(map[string]string, len(labels))
+	for name, value := range labels {
+		safeLabels[name] = fileNameSafe(value)
+	}
+	return fileNameData{
+		Timestamp: start.UTC().Format("20060102-150405"),
+		Rate:      rate,
+		Label:     strings.Join(values, "-"),
+		Labels:    safeLabels,
+	}
+}
+
+// fileNameSafe keeps label values from adding directories to file names.
+func fileNameSafe(value string) string {
+	return strings.NewReplacer("/", "_", "\\", "_").Replace(value)
+}
+
+// outputFiles returns the names of the output files of the config by the
+// names of their options, for expanding them.
+func outputFiles(conf *config) map[string]*string {
+	return map[string]*string{
+		"OutFile":             &conf.Output,
+		"SummaryFile":         &conf.Summary,
+		"RawLatencyFile":      &conf.Raw,
+		"TimelineFile":        &conf.Timeline,
+		"HTMLReportFile":      &conf.HTMLReport,
+		"MarkdownSummaryFile": &conf.Markdown,
+		"FailureLog.File":     &conf.FailureLog.File,
+	}
+}
+
+// expandFileName executes name as a template of the data. Names without
+// actions are returned as they are.
+func expandFileName(name string, data fileNameData) (string, error) {
+	if !strings.Contains(name, "{{") {
+		return name, nil
+	}
+	tmpl, err := template.New("file").Option("missingkey=error").Parse(name)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// expandOutputFiles replaces the names of the output files of the config with
+// their expansion for a run.
+func expandOutputFiles(conf *config, data fileNameData) {
+	for _, file := range outputFiles(conf) {
+		expanded, err := expandFileName(*file, data)
+		maybePanic(err)
+		*file = expanded
+	}
+}
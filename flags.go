@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+const defaultConfigFile = "labench.yaml"
+
+// commandLine holds the flags of a benchmark run. Those overriding config
+// values take precedence over the config file and the environment variables
+// substituted in it, so that parameters can be swept without editing it.
+type commandLine struct {
+	configFile   string
+	validateOnly bool
+	printConfig  bool
+	rate         uint64
+	duration     time.Duration
+	clients      uint64
+	url          string
+	// set holds the names of the flags given
+	set map[string]bool
+}
+
+// parseCommandLine parses the arguments of a benchmark run, flags can come
+// before or after the config file.
+func parseCommandLine(args []string) *commandLine {
+	c := &commandLine{configFile: defaultConfigFile, set: make(map[string]bool)}
+
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	flags.BoolVar(&c.validateOnly, "validate", false, "check the config and exit without running")
+	flags.BoolVar(&c.printConfig, "print-config", false, "print the config as YAML after defaults are applied, exits after it with --validate")
+	flags.Uint64Var(&c.rate, "rate", 0, "override RequestRatePerSec")
+	flags.DurationVar(&c.duration, "duration", 0, "override Duration, e.g. 30s")
+	flags.Uint64Var(&c.clients, "clients", 0, "override Clients")
+	flags.StringVar(&c.url, "url", "", "override the URL of Request")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [config.yaml]\n\tThe default config file name is: %s\n", os.Args[0], defaultConfigFile)
+		flags.PrintDefaults()
+		fmt.Fprintf(os.Stderr, mergeUsage+"\n"+compareUsage+"\n", os.Args[0], "out/merged.hgrm", os.Args[0], defaultRegressionThreshold)
+	}
+
+	var files []string
+	for {
+		flags.Parse(args)
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		files = append(files, args[0])
+		args = args[1:]
+	}
+	if len(files) > 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if len(files) == 1 {
+		c.configFile = files[0]
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		c.set[f.Name] = true
+	})
+	return c
+}
+
+// apply overrides the config values of the flags given.
+func (c *commandLine) apply(conf *config) {
+	if c.set["rate"] {
+		assert(len(conf.Params.LoadSteps) == 0 && conf.Params.RateScheduleFile == "", "--rate cannot be used with LoadSteps or RateScheduleFile, they set the rate")
+		assert(conf.Params.RatePerClient == 0, "--rate cannot be used with RequestRatePerClient, scale the rate with --clients instead")
+		conf.Params.RequestRatePerSec = c.rate
+	}
+	if c.set["duration"] {
+		assert(len(conf.Params.LoadSteps) == 0 && conf.Params.RateScheduleFile == "", "--duration cannot be used with LoadSteps or RateScheduleFile, they set the duration")
+		conf.Params.Duration = c.duration
+	}
+	if c.set["clients"] {
+		conf.Params.Clients = c.clients
+	}
+	if c.set["url"] {
+		assert(len(conf.Requests) == 0 && len(conf.Endpoints) == 0, "--url cannot be used with Requests or Endpoints, it overrides the URL of Request")
+		conf.Request.URL = c.url
+		conf.Request.URLs = nil
+	}
+}
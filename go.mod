@@ -1,9 +1,28 @@
 module labench
 
+go 1.27.1
+
 require (
-	golang.org/x/net v0.0.0-20190522155817-f3200d17e092
+	github.com/andybalholm/brotli v1.2.5
+	github.com/codahale/hdrhistogram v0.0.0-20161010025455-3a0bb77429bd
+	github.com/gorilla/websocket v1.5.3
+	github.com/olekukonko/tablewriter v0.0.1
+	github.com/quic-go/quic-go v0.63.0
+	golang.org/x/net v0.57.0
+	google.golang.org/grpc v1.84.0
+	google.golang.org/protobuf v1.36.12
 	gopkg.in/yaml.v2 v2.2.2
+	gopkg.in/yaml.v3 v3.0.1
 	labench/bench v0.0.0
 )
 
+require (
+	github.com/mattn/go-runewidth v0.0.4 // indirect
+	github.com/quic-go/qpack v0.6.0 // indirect
+	golang.org/x/crypto v0.54.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260706201446-f0a921348800 // indirect
+)
+
 replace labench/bench => ./bench
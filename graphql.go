@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// graphQLConfig is a GraphQL operation sent as the JSON body of the request,
+// so that the envelope needn't be built by hand. The Query is read from
+// QueryFile if it's set. Variables may hold placeholders like Body does. With
+// FailOnErrors a response with errors is a failure, even with status 200.
+type graphQLConfig struct {
+	Query         string                 `yaml:"Query"`
+	QueryFile     string                 `yaml:"QueryFile"`
+	OperationName string                 `yaml:"OperationName"`
+	Variables     map[string]interface{} `yaml:"Variables"`
+	FailOnErrors  bool                   `yaml:"FailOnErrors"`
+}
+
+// graphQLRequest is the body of a GraphQL request.
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// newGraphQLBody returns the JSON body of the operation.
+func newGraphQLBody(config *graphQLConfig) (string, error) {
+	query := config.Query
+	if config.QueryFile != "" {
+		content, err := ioutil.ReadFile(config.QueryFile)
+		if err != nil {
+			return "", err
+		}
+		query = string(content)
+	}
+
+	request := graphQLRequest{Query: query, OperationName: config.OperationName}
+	if len(config.Variables) > 0 {
+		request.Variables = make(map[string]interface{}, len(config.Variables))
+		for name, value := range config.Variables {
+			converted, err := jsonValue(value)
+			if err != nil {
+				return "", fmt.Errorf("GraphQL.Variables.%s: %v", name, err)
+			}
+			request.Variables[name] = converted
+		}
+	}
+
+	// placeholders are kept as they are written, rather than with < and > escaped
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(request); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(body.String(), "\n"), nil
+}
+
+// jsonValue converts the maps YAML decodes, which have keys of any type, to
+// maps JSON can encode.
+func jsonValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, element := range v {
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("key %v is not a string", key)
+			}
+			converted, err := jsonValue(element)
+			if err != nil {
+				return nil, err
+			}
+			object[name] = converted
+		}
+		return object, nil
+
+	case []interface{}:
+		array := make([]interface{}, len(v))
+		for i, element := range v {
+			converted, err := jsonValue(element)
+			if err != nil {
+				return nil, err
+			}
+			array[i] = converted
+		}
+		return array, nil
+	}
+	return value, nil
+}
+
+// checkGraphQLErrors returns an error if the response of a GraphQL request
+// has errors. The messages are left out of the error to keep the errors of
+// the summary few, FailureLog records the bodies with them.
+func checkGraphQLErrors(body []byte) error {
+	var response struct {
+		Errors []json.RawMessage `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return newRequestError(validationErrors, "Response body is not valid JSON")
+	}
+	if len(response.Errors) > 0 {
+		return newRequestError(validationErrors, "GraphQL response has errors")
+	}
+	return nil
+}
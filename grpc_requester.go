@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"labench/bench"
+)
+
+var (
+	grpcConn    *grpc.ClientConn
+	grpcTimeout time.Duration
+)
+
+// initGRPCClient sets up a gRPC client connection to the host of the given URL.
+// https:// URLs are dialed with TLS and http:// URLs in plaintext.
+// All calls are multiplexed over a single HTTP/2 connection, so ReuseConnections does not apply.
+func initGRPCClient(target string, requestTimeout, connectTimeout time.Duration, dontLinger bool, tlsConfig *tls.Config, proxyURL *url.URL) {
+	parsedURL, err := url.Parse(target)
+	maybePanic(err)
+
+	var creds credentials.TransportCredentials
+	switch parsedURL.Scheme {
+	case "https":
+		creds = credentials.NewTLS(tlsConfig.Clone())
+	case "http":
+		creds = insecure.NewCredentials()
+	default:
+		assert(false, fmt.Sprintf("gRPC URL must start with http:// or https://, got %q", target))
+	}
+
+	host := parsedURL.Host
+	if parsedURL.Port() == "" {
+		if parsedURL.Scheme == "https" {
+			host = net.JoinHostPort(parsedURL.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(parsedURL.Hostname(), "80")
+		}
+	}
+
+	defaultDialer = &net.Dialer{
+		Timeout: connectTimeout,
+		// Disable TCP keepalives as we are sending data very actively anyway.
+		KeepAlive: 0,
+	}
+
+	dial := proxyDialContext(proxyURL, tlsConfig)
+	grpcConn, err = grpc.NewClient(host,
+		grpc.WithTransportCredentials(creds),
+		// only the configured Proxy is used, not the one from environment
+		grpc.WithNoProxy(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return dial(ctx, "tcp", addr)
+		}))
+	maybePanic(err)
+
+	grpcTimeout = requestTimeout
+	noLinger = dontLinger
+}
+
+// grpcMethod holds what is needed to invoke a unary gRPC method,
+// resolved once from the descriptor set.
+type grpcMethod struct {
+	fullName string
+	request  proto.Message
+	response protoreflect.MessageDescriptor
+}
+
+// loadGRPCMethod resolves GRPCMethod in ProtoDescriptorSet and transcodes the JSON body into the request message.
+func loadGRPCMethod(descriptorSetFile, methodName, body string) (*grpcMethod, error) {
+	content, err := ioutil.ReadFile(descriptorSetFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var fdSet descriptorpb.FileDescriptorSet
+	if err = proto.Unmarshal(content, &fdSet); err != nil {
+		return nil, fmt.Errorf("cannot parse descriptor set %s: %v", descriptorSetFile, err)
+	}
+
+	files, err := protodesc.NewFiles(&fdSet)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load descriptor set %s: %v", descriptorSetFile, err)
+	}
+
+	// both package.Service/Method and package.Service.Method are accepted
+	name := strings.TrimPrefix(methodName, "/")
+	sep := strings.LastIndexAny(name, "/.")
+	if sep < 0 {
+		return nil, fmt.Errorf("GRPCMethod must be fully-qualified, e.g. package.Service/Method, got %q", methodName)
+	}
+	serviceName, method := name[:sep], name[sep+1:]
+
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(serviceName))
+	if err != nil {
+		return nil, fmt.Errorf("cannot find service %s: %v", serviceName, err)
+	}
+	service, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", serviceName)
+	}
+	methodDesc := service.Methods().ByName(protoreflect.Name(method))
+	if methodDesc == nil {
+		return nil, fmt.Errorf("cannot find method %s in service %s", method, serviceName)
+	}
+	if methodDesc.IsStreamingClient() || methodDesc.IsStreamingServer() {
+		return nil, fmt.Errorf("method %s is not unary", methodName)
+	}
+
+	request := dynamicpb.NewMessage(methodDesc.Input())
+	if body != "" {
+		if err = protojson.Unmarshal([]byte(body), request); err != nil {
+			return nil, fmt.Errorf("cannot transcode Body to %s: %v", methodDesc.Input().FullName(), err)
+		}
+	}
+
+	return &grpcMethod{
+		fullName: fmt.Sprintf("/%s/%s", serviceName, method),
+		request:  request,
+		response: methodDesc.Output(),
+	}, nil
+}
+
+// grpcRequester implements Requester by making unary gRPC calls.
+type grpcRequester struct {
+	method   *grpcMethod
+	metadata metadata.MD
+	timeout  time.Duration
+}
+
+// newGRPCRequester returns a requester calling method, with the global
+// RequestTimeout unless timeout overrides it.
+func newGRPCRequester(method *grpcMethod, headers map[string][]string, timeout time.Duration) bench.Requester {
+	md := metadata.MD{}
+	for key, val := range headers {
+		// host is carried in :authority by gRPC
+		if key == "Host" {
+			continue
+		}
+		md.Append(key, val...)
+	}
+
+	if timeout == 0 {
+		timeout = grpcTimeout
+	}
+	return &grpcRequester{method, md, timeout}
+}
+
+// Setup prepares the Requester for benchmarking.
+func (g *grpcRequester) Setup() error { return nil }
+
+// WarmUpConnection waits for the connection shared by all calls to be ready.
+func (g *grpcRequester) WarmUpConnection() error {
+	ctx := context.Background()
+	if grpcTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, grpcTimeout)
+		defer cancel()
+	}
+
+	grpcConn.Connect()
+	for state := grpcConn.GetState(); state != connectivity.Ready; state = grpcConn.GetState() {
+		if !grpcConn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("gRPC connection is %v: %v", state, ctx.Err())
+		}
+	}
+	return nil
+}
+
+// Request performs a synchronous request to the system under test.
+func (g *grpcRequester) Request() (bench.Result, error) {
+	return g.RequestContext(context.Background())
+}
+
+// RequestContext implements bench.ContextRequester, the call is canceled once
+// ctx is done.
+func (g *grpcRequester) RequestContext(ctx context.Context) (bench.Result, error) {
+	ctx = metadata.NewOutgoingContext(ctx, g.metadata)
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+
+	response := dynamicpb.NewMessage(g.method.response)
+	err := grpcConn.Invoke(ctx, g.method.fullName, g.method.request, response)
+	if err != nil {
+		if st, ok := status.FromError(err); ok {
+			category := statusMismatchErrors
+			switch st.Code() {
+			case codes.DeadlineExceeded:
+				category = timeoutErrors
+			case codes.Unavailable:
+				category = connectionErrors
+			}
+			return bench.Result{StatusCode: int(st.Code()), StatusReceived: true}, newRequestError(category, "Expected OK got %v: %v", st.Code(), st.Message())
+		}
+		return bench.Result{}, classifyError(err)
+	}
+
+	return bench.Result{StatusCode: int(codes.OK), StatusReceived: true, BytesSent: int64(proto.Size(g.method.request)), BytesReceived: int64(proto.Size(response))}, nil
+}
+
+// Teardown is called upon benchmark completion.
+func (g *grpcRequester) Teardown() error { return nil }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// initHTTP10Client sets up a client speaking HTTP/1.0 to servers which don't
+// speak HTTP/1.1. Every request opens its own connection, which the server
+// closes after the response. The net/http client only writes HTTP/1.1, so the
+// request line is rewritten on the connection, which is why TLS is done here
+// rather than by the transport and a Proxy is not supported.
+func initHTTP10Client(requestTimeout, connectTimeout time.Duration, dontLinger bool, tlsConfig *tls.Config) {
+	initHTTPClient(false, requestTimeout, connectTimeout, dontLinger, tlsConfig, nil)
+
+	transport := httpClient.Transport.(*http.Transport)
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		con, err := noLingerDialer(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &http10Conn{Conn: con}, nil
+	}
+	transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		con, err := noLingerDialer(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg := transport.TLSClientConfig.Clone()
+		if cfg.ServerName == "" {
+			cfg.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		if connectTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, connectTimeout)
+			defer cancel()
+		}
+		tlsCon := tls.Client(con, cfg)
+		if err = tlsCon.HandshakeContext(ctx); err != nil {
+			_ = con.Close()
+			return nil, err
+		}
+		return &http10Conn{Conn: tlsCon}, nil
+	}
+}
+
+// http10Conn rewrites the version in the request line of the first write,
+// which the transport buffers along with the rest of the request header.
+type http10Conn struct {
+	net.Conn
+	written bool
+}
+
+func (c *http10Conn) Write(b []byte) (int, error) {
+	if c.written {
+		return c.Conn.Write(b)
+	}
+	c.written = true
+
+	end := bytes.Index(b, []byte("\r\n"))
+	if end < 0 || !bytes.HasSuffix(b[:end], []byte(" HTTP/1.1")) {
+		return c.Conn.Write(b)
+	}
+	rewritten := append(append(append([]byte{}, b[:end-len("1.1")]...), "1.0"...), b[end:]...)
+	if _, err := c.Conn.Write(rewritten); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
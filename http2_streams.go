@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+)
+
+// http2MaxStreams is how many Benchmark connections share an HTTP/2
+// connection, zero if all of them share one.
+var (
+	http2MaxStreams   uint64
+	newHTTP2Transport func() http.RoundTripper
+	http2ClientsMu    sync.Mutex
+	http2Clients      = make(map[uint64]*http.Client)
+)
+
+// http2StreamsClient returns the HTTP client of a Benchmark connection, which
+// shares its own transport with the next http2MaxStreams-1 Benchmark
+// connections. As each Benchmark connection has one request in flight, a
+// connection of the transport carries at most http2MaxStreams concurrent
+// streams, and Clients / http2MaxStreams connections are opened per host.
+func http2StreamsClient(number uint64) *http.Client {
+	http2ClientsMu.Lock()
+	defer http2ClientsMu.Unlock()
+
+	group := number / http2MaxStreams
+	client, ok := http2Clients[group]
+	if !ok {
+		streams := *httpClient
+		streams.Transport = newHTTP2Transport()
+		client = &streams
+		http2Clients[group] = client
+	}
+	return client
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a parsed JSONPath expression selecting a single value,
+// elements are either object keys (string) or array indexes (int).
+// Only the dot and bracket child operators are supported, e.g. $.items[0].status or $['status'].
+type jsonPath []interface{}
+
+func parseJSONPath(expr string) (jsonPath, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("JSONPath %q must start with $", expr)
+	}
+
+	var path jsonPath
+	rest := expr[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("JSONPath %q has an empty key", expr)
+			}
+			path = append(path, key)
+			rest = rest[end+1:]
+
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("JSONPath %q has unclosed [", expr)
+			}
+			selector := rest[1:end]
+			if len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0] {
+				path = append(path, selector[1:len(selector)-1])
+			} else {
+				index, err := strconv.Atoi(selector)
+				if err != nil {
+					return nil, fmt.Errorf("JSONPath %q has invalid selector [%s]", expr, selector)
+				}
+				path = append(path, index)
+			}
+			rest = rest[end+1:]
+
+		default:
+			return nil, fmt.Errorf("JSONPath %q is not supported, only . and [] selectors are", expr)
+		}
+	}
+
+	return path, nil
+}
+
+// lookup returns the value selected by the path in a decoded JSON document.
+func (p jsonPath) lookup(doc interface{}) (interface{}, bool) {
+	for _, element := range p {
+		switch selector := element.(type) {
+		case string:
+			object, ok := doc.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if doc, ok = object[selector]; !ok {
+				return nil, false
+			}
+
+		case int:
+			array, ok := doc.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			if selector < 0 {
+				selector += len(array)
+			}
+			if selector < 0 || selector >= len(array) {
+				return nil, false
+			}
+			doc = array[selector]
+		}
+	}
+
+	return doc, true
+}
+
+// jsonAssertion checks that a JSONPath selects the expected value in a response.
+type jsonAssertion struct {
+	path     jsonPath
+	expr     string
+	expected interface{}
+}
+
+// newJSONAssertion creates an assertion, expected is compared as JSON if it's valid JSON and as a plain string otherwise.
+func newJSONAssertion(expr, expected string) (*jsonAssertion, error) {
+	path, err := parseJSONPath(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	var expectedValue interface{}
+	if err = json.Unmarshal([]byte(expected), &expectedValue); err != nil {
+		expectedValue = expected
+	}
+
+	return &jsonAssertion{path, expr, expectedValue}, nil
+}
+
+// check returns an error if body doesn't contain the expected value.
+func (a *jsonAssertion) check(body []byte) error {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return newRequestError(validationErrors, "Response body is not valid JSON")
+	}
+
+	value, ok := a.path.lookup(doc)
+	if !ok {
+		return newRequestError(validationErrors, "Response JSON has no %s", a.expr)
+	}
+
+	if !reflect.DeepEqual(value, a.expected) {
+		return newRequestError(validationErrors, "Response JSON %s is not %v", a.expr, a.expected)
+	}
+
+	return nil
+}
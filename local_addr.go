@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+)
+
+// dialNetwork is tcp4 or tcp6 to connect over that IP version only, empty to
+// use both.
+var dialNetwork string
+
+// localAddrs are the source addresses new connections are bound to in turn,
+// none lets the system pick one.
+var (
+	localAddrs    []*net.TCPAddr
+	nextLocalAddr atomic.Uint64
+)
+
+// setDialNetwork validates and installs the DialNetwork setting.
+func setDialNetwork(network string) error {
+	switch network {
+	case "", "tcp":
+	case "tcp4", "tcp6":
+		dialNetwork = network
+	default:
+		return fmt.Errorf("DialNetwork must be tcp, tcp4 or tcp6, got %q", network)
+	}
+	return nil
+}
+
+// connectionNetwork returns the network to dial instead of network.
+func connectionNetwork(network string) string {
+	if dialNetwork != "" && network == "tcp" {
+		return dialNetwork
+	}
+	return network
+}
+
+// lookupNetwork returns the network of IP lookups, so that hosts resolve to
+// addresses connections can be made to.
+func lookupNetwork() string {
+	return strings.Replace(connectionNetwork("tcp"), "tcp", "ip", 1)
+}
+
+// setLocalAddresses validates and installs the LocalAddresses setting.
+func setLocalAddresses(addrs []string) error {
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return fmt.Errorf("LocalAddresses %q must be an IP address", addr)
+		}
+		localAddrs = append(localAddrs, &net.TCPAddr{IP: ip})
+	}
+	return nil
+}
+
+// connectionDialer returns the dialer of a new connection, bound to the next
+// of the local addresses if there are any. The port is left to the system, so
+// each address has its own range of ephemeral ports. The dialer only connects
+// to remote addresses of the family of its local address.
+func connectionDialer() *net.Dialer {
+	if len(localAddrs) == 0 {
+		return defaultDialer
+	}
+
+	dialer := *defaultDialer
+	dialer.LocalAddr = localAddrs[(nextLocalAddr.Add(1)-1)%uint64(len(localAddrs))]
+	return &dialer
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"strings"
+)
+
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// initLogging makes the default logger write records of the level and above
+// to stderr, as text or as JSON lines. Level defaults to info and format to
+// text, both are case insensitive. The summary of the run is not a log and
+// still goes to stdout.
+func initLogging(level, format string) error {
+	var options slog.HandlerOptions
+	if level != "" {
+		l, ok := logLevels[strings.ToLower(level)]
+		if !ok {
+			return fmt.Errorf("LogLevel must be debug, info, warn or error, got %q", level)
+		}
+		options.Level = l
+	}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stderr, &options)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, &options)
+	default:
+		return fmt.Errorf("LogFormat must be text or json, got %q", format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// exitOnPanic turns a panic of the main goroutine, e.g. by maybePanic or
+// assert on a bad config, into an error log and exit code 1. The stack trace
+// is only logged at debug level.
+func exitOnPanic() {
+	if r := recover(); r != nil {
+		slog.Debug("Stack trace", "stack", string(debug.Stack()))
+		slog.Error(fmt.Sprint(r))
+		os.Exit(1)
+	}
+}
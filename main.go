@@ -4,12 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"math"
 	"net/http"
 	"os"
 	"os/signal"
 	"path"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -19,125 +21,653 @@ import (
 )
 
 type benchParams struct {
-	RequestRatePerSec uint64        `yaml:"RequestRatePerSec"`
-	Clients           uint64        `yaml:"Clients"`
-	WarmUpDuration    time.Duration `yaml:"WarmUpDuration"`
-	Duration          time.Duration `yaml:"Duration"`
-	BaseLatency       time.Duration `yaml:"BaseLatency"`
-	RequestTimeout    time.Duration `yaml:"RequestTimeout"`
-	ReuseConnections  bool          `yaml:"ReuseConnections"`
-	DontLinger        bool          `yaml:"DontLinger"`
-	OutputJSON        bool          `yaml:"OutputJSON"`
-	TightTicker       bool          `yaml:"TightTicker"`
-	Insecure          bool          `yaml:"Insecure"`
+	RequestRatePerSec   uint64            `yaml:"RequestRatePerSec"`
+	RatePerClient       float64           `yaml:"RequestRatePerClient"`
+	Clients             uint64            `yaml:"Clients"`
+	WarmUpDuration      time.Duration     `yaml:"WarmUpDuration"`
+	ConnectionWarmUp    bool              `yaml:"ConnectionWarmUp"`
+	WarmUpConnections   uint64            `yaml:"WarmUpConnections"`
+	RampUpDuration      time.Duration     `yaml:"RampUpDuration"`
+	RampUpStartRate     uint64            `yaml:"RampUpStartRate"`
+	LoadSteps           []loadStep        `yaml:"LoadSteps"`
+	StepLatency         bool              `yaml:"StepLatency"`
+	RateScheduleFile    string            `yaml:"RateScheduleFile"`
+	Duration            time.Duration     `yaml:"Duration"`
+	Continuous          bool              `yaml:"Continuous"`
+	ExcludePausedTime   bool              `yaml:"ExcludePausedTime"`
+	MaxRequests         uint64            `yaml:"MaxRequests"`
+	MaxErrorRate        float64           `yaml:"MaxErrorRate"`
+	StopOnFirstError    bool              `yaml:"StopOnFirstError"`
+	DrainTimeout        time.Duration     `yaml:"DrainTimeout"`
+	ErrorRateWindow     time.Duration     `yaml:"ErrorRateWindow"`
+	BaseLatency         time.Duration     `yaml:"BaseLatency"`
+	CoordinatedOmission string            `yaml:"CoordinatedOmission"`
+	Percentiles         []float64         `yaml:"Percentiles"`
+	HistogramDigits     int               `yaml:"HistogramSignificantDigits"`
+	HistogramMinValue   time.Duration     `yaml:"HistogramMinValue"`
+	HistogramMaxValue   time.Duration     `yaml:"HistogramMaxValue"`
+	RequestTimeout      time.Duration     `yaml:"RequestTimeout"`
+	ConnectTimeout      time.Duration     `yaml:"ConnectTimeout"`
+	ReuseConnections    bool              `yaml:"ReuseConnections"`
+	MaxIdleConnsPerHost int               `yaml:"MaxIdleConnsPerHost"`
+	MaxConnsPerHost     int               `yaml:"MaxConnsPerHost"`
+	IdleConnTimeout     time.Duration     `yaml:"IdleConnTimeout"`
+	FollowRedirects     *bool             `yaml:"FollowRedirects"`
+	MaxRedirects        int               `yaml:"MaxRedirects"`
+	DecompressResponses *bool             `yaml:"DecompressResponses"`
+	DontLinger          bool              `yaml:"DontLinger"`
+	TCPNoDelay          *bool             `yaml:"TCPNoDelay"`
+	SendBuffer          int               `yaml:"SocketSendBuffer"`
+	ReceiveBuffer       int               `yaml:"SocketReceiveBuffer"`
+	OutputJSON          bool              `yaml:"OutputJSON"`
+	Dashboard           bool              `yaml:"Dashboard"`
+	ProgressInterval    time.Duration     `yaml:"ProgressInterval"`
+	TightTicker         bool              `yaml:"TightTicker"`
+	Arrivals            string            `yaml:"Arrivals"`
+	RandomSeed          *int64            `yaml:"RandomSeed"`
+	ThinkTime           thinkTime         `yaml:"ThinkTime"`
+	Insecure            bool              `yaml:"Insecure"`
+	ClientCert          string            `yaml:"ClientCert"`
+	ClientKey           string            `yaml:"ClientKey"`
+	TLSMinVersion       string            `yaml:"TLSMinVersion"`
+	TLSMaxVersion       string            `yaml:"TLSMaxVersion"`
+	TLSCipherSuites     []string          `yaml:"TLSCipherSuites"`
+	ServerName          string            `yaml:"ServerName"`
+	Proxy               string            `yaml:"Proxy"`
+	PipelineDepth       uint64            `yaml:"PipelineDepth"`
+	HTTP2MaxStreams     uint64            `yaml:"HTTP2MaxConcurrentStreams"`
+	ResolveOverrides    map[string]string `yaml:"ResolveOverrides"`
+	LocalAddresses      []string          `yaml:"LocalAddresses"`
+	DialNetwork         string            `yaml:"DialNetwork"`
+	UnixSocket          string            `yaml:"UnixSocket"`
+	DNSCacheTTL         time.Duration     `yaml:"DNSCacheTTL"`
+	MetricsPort         int               `yaml:"MetricsPort"`
+}
+
+type loadStep struct {
+	Rate     uint64        `yaml:"Rate"`
+	Duration time.Duration `yaml:"Duration"`
+}
+
+type thinkTime struct {
+	Distribution string        `yaml:"Distribution"`
+	Mean         time.Duration `yaml:"Mean"`
+	Min          time.Duration `yaml:"Min"`
+	Max          time.Duration `yaml:"Max"`
+}
+
+type chartConfig struct {
+	MaxPercentile float64       `yaml:"MaxPercentile"`
+	MinLatency    time.Duration `yaml:"MinLatency"`
+	MaxLatency    time.Duration `yaml:"MaxLatency"`
 }
 
 type config struct {
-	Params   benchParams         `yaml:",inline"`
-	Protocol string              `yaml:"Protocol"`
-	Request  WebRequesterFactory `yaml:"Request"`
-	Output   string              `yaml:"OutFile"`
+	Params         benchParams         `yaml:",inline"`
+	Protocol       string              `yaml:"Protocol"`
+	Request        WebRequesterFactory `yaml:"Request"`
+	Requests       []requestDefinition `yaml:"Requests"`
+	Output         string              `yaml:"OutFile"`
+	Format         string              `yaml:"OutFormat"`
+	Interval       time.Duration       `yaml:"HistogramLogInterval"`
+	Chart          chartConfig         `yaml:"Chart"`
+	Summary        string              `yaml:"SummaryFile"`
+	Raw            string              `yaml:"RawLatencyFile"`
+	Timeline       string              `yaml:"TimelineFile"`
+	HTMLReport     string              `yaml:"HTMLReportFile"`
+	Markdown       string              `yaml:"MarkdownSummaryFile"`
+	FailureLog     failureLogConfig    `yaml:"FailureLog"`
+	StatsD         statsdConfig        `yaml:"StatsD"`
+	Webhook        webhookConfig       `yaml:"Webhook"`
+	Labels         map[string]string   `yaml:"Labels"`
+	Endpoints      []endpoint          `yaml:"Endpoints"`
+	LogLevel       string              `yaml:"LogLevel"`
+	LogFormat      string              `yaml:"LogFormat"`
+	CapacitySearch *capacitySearch     `yaml:"CapacitySearch"`
+	SLA            *slaConfig          `yaml:"SLA"`
 }
 
+// maybePanic and assert panic on errors, exitOnPanic logs those of the main
+// goroutine and exits.
 func maybePanic(err error) {
 	if err != nil {
-		log.Panic(err)
+		panic(err)
 	}
 }
 
 func assert(cond bool, err string) {
 	if !cond {
-		log.Panic(errors.New(err))
+		panic(errors.New(err))
+	}
+}
+
+// usage prints how to run labench and exits with 2.
+func usage(text string) {
+	fmt.Fprintln(os.Stderr, text)
+	os.Exit(2)
+}
+
+// clientsFor returns enough clients for the rate when each request takes up to timeout.
+func clientsFor(rate uint64, timeout time.Duration) uint64 {
+	clients := rate * uint64(math.Ceil(timeout.Seconds()))
+	return clients + clients/5 // add 20%
+}
+
+// writeSummary writes the JSON summary to file, or appends it as a line if
+// the file name ends with .jsonl, to accumulate runs.
+func writeSummary(summary *bench.Summary, file string) error {
+	if err := os.MkdirAll(path.Dir(file), os.ModeDir|os.ModePerm); err != nil {
+		return err
+	}
+	if strings.HasSuffix(file, ".jsonl") {
+		return summary.AppendJSONLine(file)
+	}
+	return summary.WriteJSON(file)
+}
+
+func setRequestDefaults(request *WebRequesterFactory) {
+	if request.ExpectedHTTPStatusCode == 0 {
+		request.ExpectedHTTPStatusCode = 200
+	}
+
+	// an explicit method is kept, HEAD is only spelled the way servers expect it
+	if strings.EqualFold(request.HTTPMethod, http.MethodHead) {
+		request.HTTPMethod = http.MethodHead
+	}
+	if request.HTTPMethod == "" {
+		if request.Body == "" && request.BodyFile == "" && request.RandomBodySize == 0 && request.Multipart == nil && request.GraphQL == nil {
+			request.HTTPMethod = http.MethodGet
+		} else {
+			request.HTTPMethod = http.MethodPost
+		}
 	}
 }
 
 func main() {
+	defer exitOnPanic()
+	maybePanic(initLogging("", ""))
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	configFile := "labench.yaml"
 	if len(os.Args) > 1 {
-		assert(len(os.Args) == 2, fmt.Sprintf("Usage: %s [config.yaml]\n\tThe default config file name is: %s", os.Args[0], configFile))
-		configFile = os.Args[1]
+		switch os.Args[1] {
+		case "merge":
+			mergeCommand(os.Args[2:])
+			return
+		case "compare":
+			compareCommand(os.Args[2:])
+			return
+		}
 	}
 
+	commandLine := parseCommandLine(os.Args[1:])
+	configFile := commandLine.configFile
+
 	configBytes, err := ioutil.ReadFile(configFile)
 	maybePanic(err)
 
+	configBytes, err = expandEnvVars(configBytes)
+	maybePanic(err)
+
 	var conf config
 	err = yaml.Unmarshal(configBytes, &conf)
 	maybePanic(err)
+	commandLine.apply(&conf)
 
-	// fmt.Printf("%+v\n", conf)
-	fmt.Println("timeStart =", time.Now().UTC().Add(-5*time.Second).Truncate(time.Second))
+	err = initLogging(conf.LogLevel, conf.LogFormat)
+	maybePanic(err)
 
-	if conf.Request.ExpectedHTTPStatusCode == 0 {
-		conf.Request.ExpectedHTTPStatusCode = 200
+	if problems := validateConfig(&conf); len(problems) > 0 {
+		for _, problem := range problems {
+			slog.Error(problem)
+		}
+		slog.Error("Invalid config, fix the problems above and re-run", "config", configFile, "problems", len(problems))
+		os.Exit(1)
+	}
+	if commandLine.validateOnly && !commandLine.printConfig {
+		fmt.Println(configFile, "is valid")
+		return
 	}
 
-	if conf.Request.HTTPMethod == "" {
-		if conf.Request.Body == "" && conf.Request.BodyFile == "" {
-			conf.Request.HTTPMethod = http.MethodGet
-		} else {
-			conf.Request.HTTPMethod = http.MethodPost
-		}
+	slog.Info("Starting", "timeStart", time.Now().UTC().Add(-5*time.Second).Truncate(time.Second), "config", configFile)
+
+	setRequestDefaults(&conf.Request)
+	for i := range conf.Requests {
+		setRequestDefaults(&conf.Requests[i].Request)
 	}
 
 	if conf.Protocol == "" {
 		conf.Protocol = "HTTP/1.1"
 	}
 
-	fmt.Println("Protocol:", conf.Protocol)
+	slog.Info("Protocol", "protocol", conf.Protocol)
+
+	randomSeed = time.Now().UnixNano()
+	if conf.Params.RandomSeed != nil {
+		randomSeed = *conf.Params.RandomSeed
+	}
+	slog.Info("Random seed, set RandomSeed to it to reproduce the run", "seed", randomSeed)
+
+	if conf.Params.RatePerClient > 0 {
+		conf.Params.RequestRatePerSec = uint64(math.Round(float64(conf.Params.Clients) * conf.Params.RatePerClient))
+		slog.Info("RequestRatePerSec is Clients times RequestRatePerClient", "rate", conf.Params.RequestRatePerSec)
+	}
+
+	var loadSteps []bench.LoadStep
+	if len(conf.Params.LoadSteps) > 0 {
+		// the steps replace RequestRatePerSec and Duration, clients are sized for the highest rate
+		conf.Params.RequestRatePerSec = 0
+		for _, step := range conf.Params.LoadSteps {
+			if step.Rate > conf.Params.RequestRatePerSec {
+				conf.Params.RequestRatePerSec = step.Rate
+			}
+			loadSteps = append(loadSteps, bench.LoadStep{Rate: step.Rate, Duration: step.Duration})
+		}
+	}
+
+	var rateSchedule []bench.RatePoint
+	if conf.Params.RateScheduleFile != "" {
+		rateSchedule, err = loadRateSchedule(conf.Params.RateScheduleFile)
+		maybePanic(err)
+
+		// the schedule replaces RequestRatePerSec and Duration, clients are sized for the highest rate
+		conf.Params.RequestRatePerSec = 1
+		for _, point := range rateSchedule {
+			if rate := uint64(math.Ceil(point.Rate)); rate > conf.Params.RequestRatePerSec {
+				conf.Params.RequestRatePerSec = rate
+			}
+		}
+	}
+
+	format, err := bench.ParseDistributionFormat(conf.Format)
+	maybePanic(err)
+
+	err = bench.ValidatePercentiles(conf.Params.Percentiles)
+	maybePanic(err)
+
+	tlsConfig, err := newTLSConfig(&conf.Params)
+	maybePanic(err)
+
+	proxyURL, err := parseProxyURL(conf.Params.Proxy)
+	maybePanic(err)
+
+	err = setResolveOverrides(conf.Params.ResolveOverrides)
+	maybePanic(err)
+
+	err = setLocalAddresses(conf.Params.LocalAddresses)
+	maybePanic(err)
+
+	err = setDialNetwork(conf.Params.DialNetwork)
+	maybePanic(err)
+
+	err = setUnixSocket(conf.Params.UnixSocket)
+	maybePanic(err)
+
+	if conf.Params.DNSCacheTTL > 0 {
+		hostCache = newDNSCache(conf.Params.DNSCacheTTL)
+	}
+
+	if conf.Params.RequestTimeout == 0 {
+		conf.Params.RequestTimeout = 10 * time.Second
+	}
+
+	// the clients time out at the longest RequestTimeout, requests overriding it at their own
+	requests := []*WebRequesterFactory{&conf.Request}
+	if len(conf.Requests) > 0 {
+		requests = requests[:0]
+		for i := range conf.Requests {
+			requests = append(requests, &conf.Requests[i].Request)
+		}
+	}
+	requestTimeout := resolveRequestTimeouts(requests, conf.Params.RequestTimeout)
+
+	connectTimeout := conf.Params.ConnectTimeout
+	if connectTimeout == 0 {
+		connectTimeout = conf.Params.RequestTimeout
+	}
 
 	switch conf.Protocol {
 	case "HTTP/2":
-		initHTTP2Client(conf.Params.RequestTimeout, conf.Params.DontLinger, conf.Params.Insecure)
+		initHTTP2Client(requestTimeout, connectTimeout, conf.Params.DontLinger, tlsConfig, proxyURL, conf.Params.HTTP2MaxStreams)
+
+	case "HTTP/1.0":
+		assert(proxyURL == nil, "Proxy is not supported with HTTP/1.0")
+		if conf.Params.ReuseConnections {
+			slog.Warn("ReuseConnections is ignored with HTTP/1.0, the server closes the connection after each response")
+		}
+		initHTTP10Client(requestTimeout, connectTimeout, conf.Params.DontLinger, tlsConfig)
+
+	case "HTTP/3":
+		assert(proxyURL == nil, "Proxy is not supported with HTTP/3")
+		initHTTP3Client(requestTimeout, connectTimeout, conf.Params.DontLinger, tlsConfig)
+
+	case "gRPC":
+		initGRPCClient(conf.Request.URL, requestTimeout, connectTimeout, conf.Params.DontLinger, tlsConfig, proxyURL)
+
+	case "WebSocket":
+		initWebSocketDialer(requestTimeout, connectTimeout, conf.Params.DontLinger, tlsConfig, proxyURL)
 
 	default:
-		initHTTPClient(conf.Params.ReuseConnections, conf.Params.RequestTimeout, conf.Params.DontLinger, conf.Params.Insecure)
+		initHTTPClient(conf.Params.ReuseConnections, requestTimeout, connectTimeout, conf.Params.DontLinger, tlsConfig, proxyURL)
+		if conf.Params.PipelineDepth > 0 {
+			assert(proxyURL == nil, "Proxy is not supported with PipelineDepth")
+			if !conf.Params.ReuseConnections {
+				slog.Warn("ReuseConnections false is ignored with PipelineDepth, pipelined connections are kept open")
+			}
+			initPipelining(conf.Params.PipelineDepth)
+		}
 	}
 
-	if conf.Params.RequestTimeout == 0 {
-		conf.Params.RequestTimeout = 10 * time.Second
+	setSocketOptions(conf.Params.TCPNoDelay == nil || *conf.Params.TCPNoDelay, conf.Params.SendBuffer, conf.Params.ReceiveBuffer)
+
+	if conf.Protocol != "gRPC" && conf.Protocol != "WebSocket" {
+		maxRedirects := conf.Params.MaxRedirects
+		if maxRedirects == 0 {
+			maxRedirects = 10
+		}
+		setRedirectPolicy(conf.Params.FollowRedirects == nil || *conf.Params.FollowRedirects, maxRedirects)
+		initDecompression(conf.Params.DecompressResponses == nil || *conf.Params.DecompressResponses)
 	}
 
-	if conf.Params.Clients == 0 {
-		clients := conf.Params.RequestRatePerSec * uint64(math.Ceil(conf.Params.RequestTimeout.Seconds()))
-		clients += clients / 5 // add 20%
-		conf.Params.Clients = clients
-		fmt.Println("Clients:", clients)
+	// the capacity search sizes the clients of each probe for its rate
+	configuredClients := conf.Params.Clients
+	if conf.Params.Clients == 0 && conf.CapacitySearch == nil {
+		conf.Params.Clients = clientsFor(conf.Params.RequestRatePerSec, conf.Params.RequestTimeout)
+		slog.Info("Clients sized for RequestRatePerSec and RequestTimeout", "clients", conf.Params.Clients)
+	}
+	if commandLine.printConfig {
+		resolved, err := resolvedConfig(&conf, randomSeed)
+		maybePanic(err)
+		fmt.Print(string(resolved))
+		if commandLine.validateOnly {
+			return
+		}
 	}
+	setConnectionPool(conf.Params.MaxIdleConnsPerHost, conf.Params.MaxConnsPerHost, conf.Params.IdleConnTimeout, int(conf.Params.Clients))
 
+	var interrupted atomic.Bool
 	done := make(chan struct{}, 1)
 	go func() {
 	loop:
 		for {
 			select {
 			case c := <-sigChan:
-				fmt.Println("Receive signal", c.String())
+				slog.Warn("Received signal, stopping", "signal", c.String())
+				interrupted.Store(true)
 				done <- struct{}{}
 			case <-done:
 				break loop
 			}
 		}
 	}()
-	benchmark := bench.NewBenchmark(&conf.Request, conf.Params.RequestRatePerSec, conf.Params.Clients, conf.Params.Duration, conf.Params.WarmUpDuration, conf.Params.BaseLatency)
+	// shared state such as bodies and tokens is prepared up front, so that it fails before the run
+	if len(conf.Requests) == 0 && len(conf.Endpoints) == 0 {
+		conf.Request.ensurePrepared()
+	}
+	for i := range conf.Requests {
+		conf.Requests[i].Request.ensurePrepared()
+	}
+
+	var factory bench.RequesterFactory = &conf.Request
+	if len(conf.Requests) > 0 {
+		factory = newRequestMixFactory(conf.Requests)
+	}
+
+	// newBenchmark applies the options which also hold for the probes of the capacity search
+	newBenchmark := func(factory bench.RequesterFactory, rate, clients uint64, duration time.Duration) *bench.Benchmark {
+		benchmark := bench.NewBenchmark(factory, rate, clients, duration, conf.Params.WarmUpDuration, conf.Params.BaseLatency)
+		benchmark.SetRandomSeed(randomSeed)
+		if len(conf.Params.Percentiles) > 0 {
+			benchmark.SetPercentiles(conf.Params.Percentiles)
+		}
+		if conf.Params.HistogramDigits != 0 || conf.Params.HistogramMinValue != 0 || conf.Params.HistogramMaxValue != 0 {
+			benchmark.SetHistogramRange(conf.Params.HistogramMinValue, conf.Params.HistogramMaxValue, conf.Params.HistogramDigits)
+		}
+		switch conf.Params.CoordinatedOmission {
+		case "", "Uncorrected":
+		case "Corrected":
+			benchmark.SetCoordinatedOmissionCorrection(false)
+		case "Both":
+			benchmark.SetCoordinatedOmissionCorrection(true)
+		default:
+			panic(fmt.Sprintf("CoordinatedOmission must be Uncorrected, Corrected or Both, got %q", conf.Params.CoordinatedOmission))
+		}
+		switch conf.Params.Arrivals {
+		case "", "Uniform":
+		case "Poisson":
+			benchmark.SetPoissonArrivals(randomSeed)
+		default:
+			panic(fmt.Sprintf("Arrivals must be Uniform or Poisson, got %q", conf.Params.Arrivals))
+		}
+		if think := conf.Params.ThinkTime; think != (thinkTime{}) {
+			distribution := bench.ThinkTimeDistribution(think.Distribution)
+			if distribution == "" {
+				distribution = bench.FixedThinkTime
+			}
+			benchmark.SetThinkTime(bench.ThinkTime{Distribution: distribution, Mean: think.Mean, Min: think.Min, Max: think.Max})
+		}
+		return benchmark
+	}
+
+	if conf.CapacitySearch != nil {
+		newProbe := func(rate uint64) *bench.Benchmark {
+			clients := configuredClients
+			if clients == 0 {
+				clients = clientsFor(rate, conf.Params.RequestTimeout)
+			}
+			// the pool is sized for the clients of the probe, which are only known here
+			setConnectionPool(conf.Params.MaxIdleConnsPerHost, conf.Params.MaxConnsPerHost, conf.Params.IdleConnTimeout, int(clients))
+			return newBenchmark(factory, rate, clients, conf.CapacitySearch.ProbeDuration)
+		}
+		runCapacitySearch(&conf, newProbe, done, interrupted.Load)
+		close(done)
+		return
+	}
+
+	// newRun applies the options of a benchmark run, of each endpoint if there are Endpoints
+	newRun := func(factory bench.RequesterFactory) *bench.Benchmark {
+		benchmark := newBenchmark(factory, conf.Params.RequestRatePerSec, conf.Params.Clients, conf.Params.Duration)
+		if format == bench.HLOG || conf.Timeline != "" || conf.HTMLReport != "" {
+			interval := conf.Interval
+			if interval == 0 {
+				interval = time.Second
+			}
+			benchmark.SetHistogramLogInterval(interval)
+		}
+		if conf.Params.Continuous {
+			benchmark.SetContinuous()
+			slog.Info("Running continuously until interrupted, press Ctrl-C to stop and report")
+		}
+		if conf.Params.MaxRequests > 0 {
+			benchmark.SetMaxRequests(conf.Params.MaxRequests)
+			if conf.Params.Duration == 0 && !conf.Params.Continuous {
+				// without a Duration the run lasts until MaxRequests were sent
+				benchmark.SetContinuous()
+			}
+		}
+		if conf.Params.MaxErrorRate > 0 {
+			window := conf.Params.ErrorRateWindow
+			if window == 0 {
+				window = 10 * time.Second
+			}
+			// a fraction like SLA.ErrorRate, the benchmark takes percent
+			benchmark.SetMaxErrorRate(conf.Params.MaxErrorRate*100, window)
+		}
+		if conf.Params.StopOnFirstError {
+			benchmark.SetStopOnFirstError()
+		}
+		if conf.Params.DrainTimeout > 0 {
+			benchmark.SetDrainTimeout(conf.Params.DrainTimeout)
+		}
+		if conf.Params.ConnectionWarmUp {
+			if conf.Protocol == "HTTP/1.0" || conf.Protocol == "HTTP/1.1" && !conf.Params.ReuseConnections {
+				slog.Warn("ConnectionWarmUp is ignored with HTTP/1.0 and without ReuseConnections, HTTP/1.x connections are not kept open")
+			} else {
+				benchmark.SetConnectionWarmUp(conf.Params.WarmUpConnections)
+			}
+		}
+		if loadSteps != nil {
+			benchmark.SetLoadSteps(loadSteps, conf.Params.StepLatency)
+		}
+		if rateSchedule != nil {
+			benchmark.SetRateSchedule(rateSchedule)
+		}
+		if conf.Params.RampUpDuration > 0 {
+			// the rate of LoadSteps and RateScheduleFile is only known from here
+			assert(conf.Params.RampUpStartRate <= conf.Params.RequestRatePerSec, "RampUpStartRate must not exceed RequestRatePerSec")
+			benchmark.SetRampUp(conf.Params.RampUpDuration, conf.Params.RampUpStartRate)
+		}
+		return benchmark
+	}
+
+	var aborted, slaPassed bool
+	if len(conf.Endpoints) > 0 {
+		aborted, slaPassed = runEndpoints(&conf, newRun, format, done, interrupted.Load)
+	} else {
+		expandOutputFiles(&conf, newFileNameData(time.Now(), conf.Params.RequestRatePerSec, conf.Labels))
+		var summary *bench.Summary
+		summary, slaPassed = runBenchmark(&conf, newRun(factory), format, done)
+		aborted = summary.AbortReason != ""
+	}
+	close(done)
+	if aborted {
+		os.Exit(1)
+	}
+	if !slaPassed {
+		os.Exit(slaViolatedExitCode)
+	}
+}
+
+// runBenchmark runs the benchmark with the observers of the config, prints its
+// summary and writes the output files. It returns the summary and whether it
+// passed the SLA, if there is one.
+func runBenchmark(conf *config, benchmark *bench.Benchmark, format bench.DistributionFormat, done chan struct{}) (*bench.Summary, bool) {
+	var err error
+
+	var metrics *metricsExporter
+	if conf.Params.MetricsPort != 0 {
+		metrics, err = startMetricsExporter(benchmark, conf.Params.RequestRatePerSec, conf.Params.MetricsPort, conf.Labels)
+		maybePanic(err)
+	}
+
+	var statsd *statsdEmitter
+	if conf.StatsD.Address != "" {
+		statsd, err = startStatsDEmitter(benchmark, conf.StatsD, conf.Labels)
+		maybePanic(err)
+	}
+
+	var raw *rawLatencyWriter
+	if conf.Raw != "" {
+		raw, err = startRawLatencyWriter(benchmark, conf.Raw)
+		maybePanic(err)
+	}
+
+	var failures *failureLog
+	if conf.FailureLog.File != "" {
+		failures, err = startFailureLog(benchmark, conf.FailureLog)
+		maybePanic(err)
+	}
+
+	var progress *progressReporter
+	// a continuous run has no end to wait for, so its progress is printed by default
+	if conf.Params.Dashboard || conf.Params.ProgressInterval > 0 || conf.Params.Continuous {
+		progress = startProgressReporter(benchmark, conf.Params.ProgressInterval, conf.Params.Dashboard)
+	}
+
+	if conf.Params.ExcludePausedTime {
+		benchmark.SetExcludePausedTime()
+	}
+	stopPauseSignals := make(chan struct{})
+	handlePauseSignals(benchmark, stopPauseSignals)
+
 	summary, err := benchmark.Run(done, conf.Params.OutputJSON, conf.Params.TightTicker)
 	maybePanic(err)
-	close(done)
+	close(stopPauseSignals)
+	reportCircuitBreakers()
+	if progress != nil {
+		progress.shutdown()
+	}
+	if metrics != nil {
+		metrics.shutdown()
+	}
+	if statsd != nil {
+		statsd.stop()
+	}
+	if raw != nil {
+		maybePanic(raw.close())
+	}
+	if failures != nil {
+		maybePanic(failures.close())
+	}
 
-	fmt.Println("timeEnd   =", time.Now().UTC().Add(5*time.Second).Round(time.Second))
+	slog.Info("Finished", "timeEnd", time.Now().UTC().Add(5*time.Second).Round(time.Second))
 
+	summary.Labels = conf.Labels
 	fmt.Println(summary)
 
+	slaPassed := true
+	if conf.SLA != nil {
+		summary.SLA = checkSLA(conf.SLA, summary)
+		slaPassed = printSLA(summary.SLA)
+	}
+
 	outfile := conf.Output
 	if outfile == "" {
-		outfile = "out/res.hgrm"
+		outfile = "out/res" + format.Extension()
 	}
 
 	err = os.MkdirAll(path.Dir(outfile), os.ModeDir|os.ModePerm)
 	maybePanic(err)
 
-	err = summary.GenerateLatencyDistribution(bench.Logarithmic, outfile)
+	summary.Chart = bench.ChartOptions(conf.Chart)
+	err = summary.GenerateLatencyDistribution(format, bench.Logarithmic, outfile)
 	maybePanic(err)
+
+	if summary.TTFBHistogram.TotalCount() > 0 {
+		ttfbFile := strings.TrimSuffix(outfile, path.Ext(outfile)) + ".ttfb" + path.Ext(outfile)
+		err = summary.GenerateTTFBDistribution(format, bench.Logarithmic, ttfbFile)
+		maybePanic(err)
+	}
+
+	if summary.BytesReceived > 0 {
+		sizeFile := strings.TrimSuffix(outfile, path.Ext(outfile)) + ".size" + path.Ext(outfile)
+		err = summary.GenerateSizeDistribution(format, bench.Logarithmic, sizeFile)
+		maybePanic(err)
+	}
+
+	if conf.Summary != "" {
+		err = writeSummary(summary, conf.Summary)
+		maybePanic(err)
+	}
+
+	if conf.Markdown != "" {
+		err = os.MkdirAll(path.Dir(conf.Markdown), os.ModeDir|os.ModePerm)
+		maybePanic(err)
+
+		err = summary.WriteMarkdown(conf.Markdown)
+		maybePanic(err)
+	}
+
+	if conf.HTMLReport != "" {
+		err = os.MkdirAll(path.Dir(conf.HTMLReport), os.ModeDir|os.ModePerm)
+		maybePanic(err)
+
+		err = summary.WriteHTML(conf.HTMLReport)
+		maybePanic(err)
+	}
+
+	if conf.Timeline != "" {
+		err = os.MkdirAll(path.Dir(conf.Timeline), os.ModeDir|os.ModePerm)
+		maybePanic(err)
+
+		err = summary.WriteTimeline(conf.Timeline)
+		maybePanic(err)
+	}
+
+	if conf.Webhook.URL != "" {
+		notifyWebhook(conf.Webhook, summary, conf.SLA != nil, slaPassed)
+	}
+
+	return summary, slaPassed
 }
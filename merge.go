@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/codahale/hdrhistogram"
+
+	"labench/bench"
+)
+
+const mergeUsage = "Usage: %s merge <file.hgrm|file.hlog>... [-o merged.hgrm]\n\tThe output format follows its extension, HGRM or CSV, the default output file is: %s"
+
+// mergeCommand sums the histograms of result files, e.g. of several load
+// generators running the same test, and writes the distribution of the sum.
+func mergeCommand(args []string) {
+	outfile := "out/merged.hgrm"
+	var files []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-o" {
+			if i+1 == len(args) {
+				usage(fmt.Sprintf(mergeUsage, os.Args[0], outfile))
+			}
+			i++
+			outfile = args[i]
+			continue
+		}
+		files = append(files, args[i])
+	}
+	if len(files) == 0 {
+		usage(fmt.Sprintf(mergeUsage, os.Args[0], outfile))
+	}
+
+	format, err := distributionFormatOf(outfile)
+	maybePanic(err)
+
+	var merged *hdrhistogram.Histogram
+	for _, file := range files {
+		inputFormat, err := distributionFormatOf(file)
+		maybePanic(err)
+
+		histogram, err := bench.ReadHistogram(file, inputFormat)
+		maybePanic(err)
+
+		if merged == nil {
+			merged = histogram
+			continue
+		}
+		dropped := merged.Merge(histogram)
+		assert(dropped == 0, fmt.Sprintf("%s: %d values are out of the range of the histograms merged before it", file, dropped))
+	}
+
+	err = os.MkdirAll(path.Dir(outfile), os.ModeDir|os.ModePerm)
+	maybePanic(err)
+
+	err = bench.WriteDistribution(merged, format, bench.Logarithmic, outfile)
+	maybePanic(err)
+
+	fmt.Printf("Merged %d requests of %d files into %s\n", merged.TotalCount(), len(files), outfile)
+}
+
+// distributionFormatOf returns the distribution format by the extension of a file.
+func distributionFormatOf(file string) (bench.DistributionFormat, error) {
+	return bench.ParseDistributionFormat(strings.TrimPrefix(path.Ext(file), "."))
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"labench/bench"
+)
+
+// latencyBuckets are the upper bounds in seconds of the exported latency histogram.
+var latencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metricsExporter serves live metrics of the benchmark in Prometheus text format.
+type metricsExporter struct {
+	benchmark  *bench.Benchmark
+	targetRate uint64
+	server     *http.Server
+	// labels are the Labels of the run, formatted for appending to those of every sample
+	labels string
+
+	mu           sync.Mutex
+	successTotal uint64
+	errorTotal   uint64
+	errors       map[string]uint64
+	buckets      []uint64
+	latencySum   float64
+}
+
+// startMetricsExporter observes benchmark and starts serving the metrics on
+// port, with the labels on every sample.
+func startMetricsExporter(benchmark *bench.Benchmark, targetRate uint64, port int, labels map[string]string) (*metricsExporter, error) {
+	e := &metricsExporter{
+		benchmark:  benchmark,
+		targetRate: targetRate,
+		labels:     prometheusLabels(labels),
+		errors:     make(map[string]uint64),
+		buckets:    make([]uint64, len(latencyBuckets)),
+	}
+	benchmark.AddObserver(e)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", e.serveMetrics)
+	e.server = &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: mux}
+
+	listener, err := net.Listen("tcp", e.server.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot serve metrics: %v", err)
+	}
+
+	go func() {
+		if err := e.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			slog.Warn("Metrics server failed", "error", err)
+		}
+	}()
+	slog.Info("Serving metrics", "url", fmt.Sprintf("http://localhost:%d/metrics", port))
+
+	return e, nil
+}
+
+// Observe implements bench.Observer.
+func (e *metricsExporter) Observe(start time.Time, latency time.Duration, result bench.Result, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err != nil {
+		e.errorTotal++
+		category := bench.OtherErrors
+		var categorized bench.CategorizedError
+		if errors.As(err, &categorized) {
+			category = categorized.Category()
+		}
+		e.errors[category]++
+		return
+	}
+
+	e.successTotal++
+	seconds := latency.Seconds()
+	e.latencySum += seconds
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			e.buckets[i]++
+		}
+	}
+}
+
+// prometheusLabels formats labels as Prometheus label pairs, sorted by name.
+// Characters Prometheus doesn't allow in names are replaced with _, values are
+// kept as they are.
+func prometheusLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var pairs strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&pairs, ",%s=%s", prometheusLabelName(name), prometheusLabelValue(labels[name]))
+	}
+	return pairs.String()
+}
+
+// prometheusLabelValue quotes a label value as the text format wants it, only
+// backslashes, double quotes and line feeds are escaped.
+func prometheusLabelValue(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+func prometheusLabelName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// sample writes a sample of a metric, with the labels of the run after its own.
+func (e *metricsExporter) sample(w io.Writer, name, labels string, value interface{}) {
+	labels += e.labels
+	if labels == "" {
+		fmt.Fprintln(w, name, value)
+		return
+	}
+	fmt.Fprintf(w, "%s{%s} %v\n", name, strings.TrimPrefix(labels, ","), value)
+}
+
+func (e *metricsExporter) serveMetrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	e.writeMetrics(w)
+}
+
+func (e *metricsExporter) writeMetrics(w io.Writer) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP labench_target_request_rate Requests per second the benchmark attempts to issue.")
+	fmt.Fprintln(w, "# TYPE labench_target_request_rate gauge")
+	e.sample(w, "labench_target_request_rate", "", e.targetRate)
+
+	fmt.Fprintln(w, "# HELP labench_requests_total Measured requests by result.")
+	fmt.Fprintln(w, "# TYPE labench_requests_total counter")
+	e.sample(w, "labench_requests_total", `result="success"`, e.successTotal)
+	e.sample(w, "labench_requests_total", `result="error"`, e.errorTotal)
+
+	fmt.Fprintln(w, "# HELP labench_in_flight_requests Requests currently being performed.")
+	fmt.Fprintln(w, "# TYPE labench_in_flight_requests gauge")
+	e.sample(w, "labench_in_flight_requests", "", e.benchmark.InFlight())
+
+	fmt.Fprintln(w, "# HELP labench_errors_total Failed requests by error category.")
+	fmt.Fprintln(w, "# TYPE labench_errors_total counter")
+	categories := make([]string, 0, len(e.errors))
+	for category := range e.errors {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		e.sample(w, "labench_errors_total", "category="+prometheusLabelValue(category), e.errors[category])
+	}
+
+	fmt.Fprintln(w, "# HELP labench_request_duration_seconds Latency of successful requests.")
+	fmt.Fprintln(w, "# TYPE labench_request_duration_seconds histogram")
+	for i, bound := range latencyBuckets {
+		e.sample(w, "labench_request_duration_seconds_bucket", fmt.Sprintf("le=\"%g\"", bound), e.buckets[i])
+	}
+	e.sample(w, "labench_request_duration_seconds_bucket", `le="+Inf"`, e.successTotal)
+	e.sample(w, "labench_request_duration_seconds_sum", "", e.latencySum)
+	e.sample(w, "labench_request_duration_seconds_count", "", e.successTotal)
+}
+
+// shutdown stops serving the metrics, waiting a moment for scrapes in progress.
+func (e *metricsExporter) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.server.Shutdown(ctx); err != nil {
+		slog.Warn("Metrics server did not shut down cleanly", "error", err)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// multipartConfig is a multipart/form-data body of form fields and files, for
+// benchmarking upload endpoints.
+type multipartConfig struct {
+	Fields map[string]string `yaml:"Fields"`
+	Files  []multipartFile   `yaml:"Files"`
+}
+
+// multipartFile is a file part of a form. FileName defaults to the base name
+// of Path and ContentType to application/octet-stream.
+type multipartFile struct {
+	Field       string `yaml:"Field"`
+	Path        string `yaml:"Path"`
+	FileName    string `yaml:"FileName"`
+	ContentType string `yaml:"ContentType"`
+}
+
+// multipartBody is a multipart body laid out once: the encoded fields and part
+// headers are kept in memory, while the files are streamed from disk by every
+// request, so large files are never buffered. Files must not change size
+// during the run, as the length of the body is computed up front.
+type multipartBody struct {
+	contentType string
+	length      int64
+	segments    []multipartSegment
+}
+
+// multipartSegment is either encoded bytes or the path of a file.
+type multipartSegment struct {
+	encoded []byte
+	path    string
+}
+
+// newMultipartBody lays out the body, fields in the order of their names and
+// then the files.
+func newMultipartBody(config *multipartConfig) (*multipartBody, error) {
+	var encoded bytes.Buffer
+	writer := multipart.NewWriter(&encoded)
+	body := &multipartBody{contentType: writer.FormDataContentType()}
+
+	names := make([]string, 0, len(config.Fields))
+	for name := range config.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := writer.WriteField(name, config.Fields[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, file := range config.Files {
+		info, err := os.Stat(file.Path)
+		if err != nil {
+			return nil, fmt.Errorf("Multipart file of %s: %v", file.Field, err)
+		}
+
+		fileName, contentType := file.FileName, file.ContentType
+		if fileName == "" {
+			fileName = filepath.Base(file.Path)
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(file.Field), escapeQuotes(fileName)))
+		header.Set("Content-Type", contentType)
+		if _, err = writer.CreatePart(header); err != nil {
+			return nil, err
+		}
+
+		body.add(&encoded)
+		body.segments = append(body.segments, multipartSegment{path: file.Path})
+		body.length += info.Size()
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	body.add(&encoded)
+	return body, nil
+}
+
+// add moves what was encoded so far into a segment.
+func (b *multipartBody) add(encoded *bytes.Buffer) {
+	segment := append([]byte(nil), encoded.Bytes()...)
+	b.segments = append(b.segments, multipartSegment{encoded: segment})
+	b.length += int64(len(segment))
+	encoded.Reset()
+}
+
+// reader returns the body of a request, files are opened as they are reached.
+func (b *multipartBody) reader() io.ReadCloser {
+	return &multipartReader{segments: b.segments}
+}
+
+type multipartReader struct {
+	segments []multipartSegment
+	current  io.Reader
+	file     *os.File
+}
+
+func (r *multipartReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.segments) == 0 {
+				return 0, io.EOF
+			}
+			segment := r.segments[0]
+			r.segments = r.segments[1:]
+			if segment.path == "" {
+				r.current = bytes.NewReader(segment.encoded)
+			} else {
+				file, err := os.Open(segment.path)
+				if err != nil {
+					return 0, err
+				}
+				r.file, r.current = file, file
+			}
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.closeFile()
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// Close closes the file being read, if a request gives up on its body.
+func (r *multipartReader) Close() error {
+	r.closeFile()
+	return nil
+}
+
+func (r *multipartReader) closeFile() {
+	if r.file != nil {
+		_ = r.file.Close()
+		r.file = nil
+	}
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// escapeQuotes escapes a name for a quoted Content-Disposition parameter, like mime/multipart does.
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// tokens without expires_in are refreshed this often
+const oauth2DefaultLifetime = time.Hour
+
+// oauth2Config is the client of the OAuth2 client credentials grant. The
+// client authenticates to the token endpoint with HTTP Basic authentication.
+type oauth2Config struct {
+	TokenURL     string   `yaml:"TokenURL"`
+	ClientID     string   `yaml:"ClientID"`
+	ClientSecret string   `yaml:"ClientSecret"`
+	Scopes       []string `yaml:"Scopes"`
+}
+
+// oauth2Client fetches access tokens from the token endpoint.
+type oauth2Client struct {
+	config oauth2Config
+	client *http.Client
+}
+
+func newOAuth2Client(config oauth2Config) *oauth2Client {
+	return &oauth2Client{
+		config: config,
+		// the benchmark client is not used, so token requests don't count as load
+		client: &http.Client{Timeout: tokenFetchTimeout},
+	}
+}
+
+// fetch requests a new access token from the token endpoint and returns it
+// along with its lifetime.
+func (t *oauth2Client) fetch() (string, time.Duration, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(t.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(t.config.Scopes, " "))
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(t.config.ClientID), url.QueryEscape(t.config.ClientSecret))
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("OAuth2 token endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(content)))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err = json.Unmarshal(content, &token); err != nil {
+		return "", 0, fmt.Errorf("OAuth2 token response is not JSON: %v", err)
+	}
+	if token.AccessToken == "" {
+		return "", 0, errors.New("OAuth2 token response has no access_token")
+	}
+
+	if token.ExpiresIn <= 0 {
+		return token.AccessToken, oauth2DefaultLifetime, nil
+	}
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"time"
+
+	"labench/bench"
+)
+
+// handlePauseSignals pauses benchmark on pauseSignal and resumes it on
+// resumeSignal until stop is closed. Nothing is handled where the signals
+// don't exist.
+func handlePauseSignals(benchmark *bench.Benchmark, stop <-chan struct{}) {
+	if pauseSignal == nil {
+		return
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, pauseSignal, resumeSignal)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case sig := <-signals:
+				if sig == pauseSignal {
+					if !benchmark.Pause() {
+						slog.Info("Already paused, send SIGUSR2 to resume")
+					} else {
+						slog.Warn("PAUSED sending requests, connections are kept open, send SIGUSR2 to resume", "inFlight", benchmark.InFlight())
+					}
+				} else if paused, ok := benchmark.Resume(); ok {
+					slog.Warn("RESUMED sending requests", "paused", paused.Round(time.Millisecond))
+				} else {
+					slog.Info("Not paused, send SIGUSR1 to pause")
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
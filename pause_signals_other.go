@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// pauseSignal pauses the benchmark and resumeSignal resumes it.
+var pauseSignal, resumeSignal os.Signal = syscall.SIGUSR1, syscall.SIGUSR2
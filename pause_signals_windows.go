@@ -0,0 +1,6 @@
+package main
+
+import "os"
+
+// Windows has no user signals, the benchmark can't be paused.
+var pauseSignal, resumeSignal os.Signal
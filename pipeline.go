@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+)
+
+// pipelineDepth is how many Benchmark connections pipeline their requests on
+// a shared HTTP/1.1 connection, zero if requests are not pipelined.
+var (
+	pipelineDepth uint64
+	pipelinesMu   sync.Mutex
+	pipelines     = make(map[uint64]*http.Client)
+)
+
+var errPipelineClosed = errors.New("server closed the pipelined connection")
+
+// initPipelining makes the HTTP/1.1 client pipeline the requests of depth
+// Benchmark connections on each connection it opens.
+func initPipelining(depth uint64) {
+	pipelineDepth = depth
+}
+
+// pipelinedClient returns the HTTP client of a Benchmark connection, which
+// shares its connections with the next depth-1 Benchmark connections. Those
+// send their requests without waiting for the responses of the others, and
+// the responses come back in the order of the requests, so the latency of a
+// request includes waiting for the responses before it.
+func pipelinedClient(number uint64) *http.Client {
+	pipelinesMu.Lock()
+	defer pipelinesMu.Unlock()
+
+	group := number / pipelineDepth
+	client, ok := pipelines[group]
+	if !ok {
+		pipelined := *httpClient
+		pipelined.Transport = &pipelinedTransport{
+			tlsConfig: httpClient.Transport.(*http.Transport).TLSClientConfig,
+			conns:     make(map[string]*pipelinedConn),
+		}
+		client = &pipelined
+		pipelines[group] = client
+	}
+	return client
+}
+
+// pipelinedTransport is a RoundTripper keeping a pipelined connection per host.
+// Requests are written in the order RoundTrip is called.
+type pipelinedTransport struct {
+	tlsConfig *tls.Config
+	mu        sync.Mutex
+	conns     map[string]*pipelinedConn
+}
+
+func (t *pipelinedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		defer req.Body.Close()
+	}
+
+	for {
+		resp, err := t.roundTrip(req)
+		if err != errPipelineClosed {
+			return resp, err
+		}
+
+		// the server closed the connection before answering, as at the end of
+		// its keep-alive limit, so the request is sent again on a new one
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return nil, newRequestError(connectionErrors, "pipelined connection failed: %v", err)
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			defer body.Close()
+			req.Body = body
+		}
+	}
+}
+
+// roundTrip sends the request on the pipelined connection to its host. It
+// returns errPipelineClosed if the server closed the connection without
+// answering it.
+func (t *pipelinedTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	addr := canonicalAddr(req)
+	conn := t.conns[addr]
+	if conn == nil || conn.failed() {
+		var err error
+		if conn, err = t.open(req.Context(), req.URL.Scheme == "https", addr, req.URL.Hostname()); err != nil {
+			t.mu.Unlock()
+			return nil, err
+		}
+		t.conns[addr] = conn
+	}
+
+	if deadline, ok := req.Context().Deadline(); ok {
+		_ = conn.conn.SetWriteDeadline(deadline)
+	}
+	err := req.Write(conn.w)
+	if err == nil {
+		err = conn.w.Flush()
+	}
+	if err != nil {
+		conn.fail(err)
+		t.mu.Unlock()
+		if conn.err == errPipelineClosed {
+			return nil, errPipelineClosed
+		}
+		return nil, err
+	}
+	pending := &pipelinedRequest{req: req, resp: make(chan *http.Response, 1)}
+	conn.pending <- pending
+	t.mu.Unlock()
+
+	select {
+	case resp := <-pending.resp:
+		return resp, nil
+	case <-conn.dead:
+		if conn.err == errPipelineClosed {
+			return nil, errPipelineClosed
+		}
+		return nil, newRequestError(connectionErrors, "pipelined connection failed: %v", conn.err)
+	case <-req.Context().Done():
+		// the responses before this one can't be skipped, so the connection is given up
+		conn.fail(req.Context().Err())
+		return nil, req.Context().Err()
+	}
+}
+
+// CloseIdleConnections closes the connections, it's only called once no
+// requests are in flight.
+func (t *pipelinedTransport) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for addr, conn := range t.conns {
+		conn.fail(errPipelineClosed)
+		delete(t.conns, addr)
+	}
+}
+
+// open connects to addr, with TLS if secure, and starts reading responses.
+func (t *pipelinedTransport) open(ctx context.Context, secure bool, addr, serverName string) (*pipelinedConn, error) {
+	con, err := noLingerDialer(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if secure {
+		cfg := t.tlsConfig.Clone()
+		if cfg.ServerName == "" {
+			cfg.ServerName = serverName
+		}
+		trace := httptrace.ContextClientTrace(ctx)
+		if trace != nil && trace.TLSHandshakeStart != nil {
+			trace.TLSHandshakeStart()
+		}
+		tlsCon := tls.Client(con, cfg)
+		err = tlsCon.HandshakeContext(ctx)
+		if trace != nil && trace.TLSHandshakeDone != nil {
+			trace.TLSHandshakeDone(tlsCon.ConnectionState(), err)
+		}
+		if err != nil {
+			_ = con.Close()
+			return nil, err
+		}
+		con = tlsCon
+	}
+
+	conn := &pipelinedConn{
+		conn:    con,
+		w:       bufio.NewWriter(con),
+		r:       bufio.NewReader(con),
+		pending: make(chan *pipelinedRequest, pipelineDepth),
+		dead:    make(chan struct{}),
+	}
+	go conn.read()
+	return conn, nil
+}
+
+// canonicalAddr returns the host:port of the request URL.
+func canonicalAddr(req *http.Request) string {
+	if req.URL.Port() != "" {
+		return req.URL.Host
+	}
+	if req.URL.Scheme == "https" {
+		return net.JoinHostPort(req.URL.Hostname(), "443")
+	}
+	return net.JoinHostPort(req.URL.Hostname(), "80")
+}
+
+// pipelinedConn is a connection with requests in flight, whose responses are
+// read in order. Once anything goes wrong all of them fail and the next
+// request opens a new connection.
+type pipelinedConn struct {
+	conn    net.Conn
+	w       *bufio.Writer
+	r       *bufio.Reader
+	pending chan *pipelinedRequest
+	dead    chan struct{}
+	once    sync.Once
+	err     error
+}
+
+type pipelinedRequest struct {
+	req  *http.Request
+	resp chan *http.Response
+}
+
+func (c *pipelinedConn) fail(err error) {
+	c.once.Do(func() {
+		c.err = err
+		close(c.dead)
+		_ = c.conn.Close()
+	})
+}
+
+func (c *pipelinedConn) failed() bool {
+	select {
+	case <-c.dead:
+		return true
+	default:
+		return false
+	}
+}
+
+// read hands out the responses in order, each after the body of the one
+// before it was closed.
+func (c *pipelinedConn) read() {
+	for {
+		var pending *pipelinedRequest
+		select {
+		case pending = <-c.pending:
+		case <-c.dead:
+			return
+		}
+
+		if _, err := c.r.Peek(1); err != nil {
+			c.fail(err)
+			return
+		}
+		if trace := httptrace.ContextClientTrace(pending.req.Context()); trace != nil && trace.GotFirstResponseByte != nil {
+			trace.GotFirstResponseByte()
+		}
+
+		resp, err := http.ReadResponse(c.r, pending.req)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		body := &pipelinedBody{ReadCloser: resp.Body, closed: make(chan struct{})}
+		resp.Body = body
+		pending.resp <- resp
+
+		ctx := pending.req.Context()
+		select {
+		case <-body.closed:
+		case <-c.dead:
+			return
+		case <-ctx.Done():
+			c.fail(ctx.Err())
+			return
+		}
+		if resp.Close {
+			c.fail(errPipelineClosed)
+			return
+		}
+	}
+}
+
+// pipelinedBody reads what is left of the body on Close, so that the next
+// response can be read.
+type pipelinedBody struct {
+	io.ReadCloser
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (b *pipelinedBody) Close() error {
+	var err error
+	b.once.Do(func() {
+		_, err = io.Copy(ioutil.Discard, b.ReadCloser)
+		_ = b.ReadCloser.Close()
+		close(b.closed)
+	})
+	return err
+}
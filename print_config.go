@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+
+	"gopkg.in/yaml.v2"
+)
+
+// redacted replaces secrets in the config printed by --print-config, which
+// ends up in the logs of CI.
+const redacted = "REDACTED"
+
+// secretHeaders are the headers holding credentials.
+var secretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key"}
+
+// resolvedConfig returns the config as YAML with the defaults applied, the
+// effective RandomSeed and the secrets redacted. It's copied through YAML, so
+// that the config of the run is left alone.
+func resolvedConfig(conf *config, seed int64) ([]byte, error) {
+	content, err := yaml.Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+	var resolved config
+	if err := yaml.Unmarshal(content, &resolved); err != nil {
+		return nil, err
+	}
+
+	resolved.Params.RandomSeed = &seed
+	resolved.Params.Proxy = redactURL(resolved.Params.Proxy)
+	if resolved.Webhook.URL != "" {
+		// the URL of an incoming webhook is its credential
+		resolved.Webhook.URL = redacted
+	}
+	redactRequest(&resolved.Request)
+	for i := range resolved.Requests {
+		redactRequest(&resolved.Requests[i].Request)
+	}
+	for i := range resolved.Endpoints {
+		resolved.Endpoints[i].URL = redactURL(resolved.Endpoints[i].URL)
+	}
+	return yaml.Marshal(&resolved)
+}
+
+// redactRequest replaces the credentials of a request, and its body and form
+// fields, which may be a login.
+func redactRequest(request *WebRequesterFactory) {
+	request.URL = redactURL(request.URL)
+	for i, u := range request.URLs {
+		request.URLs[i] = redactURL(u)
+	}
+	for name := range request.Headers {
+		for _, header := range secretHeaders {
+			if http.CanonicalHeaderKey(name) == header {
+				request.Headers[name] = redacted
+			}
+		}
+	}
+	if request.BearerToken != "" {
+		request.BearerToken = redacted
+	}
+	if request.Password != "" {
+		request.Password = redacted
+	}
+	if request.TokenCommand != "" {
+		// the command line often holds the credentials it gets the token with
+		request.TokenCommand = redacted
+	}
+	if request.OAuth2 != nil {
+		request.OAuth2.TokenURL = redactURL(request.OAuth2.TokenURL)
+		if request.OAuth2.ClientSecret != "" {
+			request.OAuth2.ClientSecret = redacted
+		}
+	}
+	if request.Body != "" {
+		request.Body = redacted
+	}
+	if request.Multipart != nil {
+		for name := range request.Multipart.Fields {
+			request.Multipart.Fields[name] = redacted
+		}
+	}
+	if request.GraphQL != nil {
+		for name := range request.GraphQL.Variables {
+			request.GraphQL.Variables[name] = redacted
+		}
+	}
+}
+
+// redactURL replaces the password of a URL, if it has one.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
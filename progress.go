@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"labench/bench"
+
+	"github.com/codahale/hdrhistogram"
+)
+
+const (
+	// dashboardRefresh is how often the dashboard is redrawn on a terminal by default
+	dashboardRefresh = time.Second
+	// plainProgressInterval is how often the dashboard is printed by default when stdout isn't a terminal
+	plainProgressInterval = 10 * time.Second
+)
+
+// progressReporter prints the progress of the benchmark while it runs, either
+// as a dashboard redrawn in place or as plain lines when stdout isn't a terminal.
+type progressReporter struct {
+	benchmark *bench.Benchmark
+	inPlace   bool
+	start     time.Time
+	stop      chan struct{}
+	done      chan struct{}
+
+	mu           sync.Mutex
+	histogram    *hdrhistogram.Histogram
+	successTotal uint64
+	errorTotal   uint64
+
+	lastTotal uint64
+	lastTime  time.Time
+	lines     int
+}
+
+// startProgressReporter observes benchmark and starts printing its progress
+// every interval, as a dashboard if asked for and stdout is a terminal.
+func startProgressReporter(benchmark *bench.Benchmark, interval time.Duration, dashboard bool) *progressReporter {
+	r := &progressReporter{
+		benchmark: benchmark,
+		inPlace:   dashboard && isTerminal(os.Stdout),
+		start:     time.Now(),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		// microseconds, up to 100 seconds
+		histogram: hdrhistogram.New(1, 100000000, 3),
+	}
+	r.lastTime = r.start
+	benchmark.AddObserver(r)
+
+	if interval == 0 {
+		interval = plainProgressInterval
+		if r.inPlace {
+			interval = dashboardRefresh
+		}
+	}
+	go r.run(interval)
+
+	return r
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Observe implements bench.Observer.
+func (r *progressReporter) Observe(start time.Time, latency time.Duration, result bench.Result, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		r.errorTotal++
+		return
+	}
+
+	r.successTotal++
+	// latencies out of range are left out of the running percentiles
+	_ = r.histogram.RecordValue(latency.Microseconds())
+}
+
+func (r *progressReporter) run(interval time.Duration) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.print()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func (r *progressReporter) print() {
+	r.mu.Lock()
+	total := r.successTotal + r.errorTotal
+	errorTotal := r.errorTotal
+	p50 := float64(r.histogram.ValueAtQuantile(50)) / 1000
+	p99 := float64(r.histogram.ValueAtQuantile(99)) / 1000
+	r.mu.Unlock()
+
+	now := time.Now()
+	rate := float64(total-r.lastTotal) / now.Sub(r.lastTime).Seconds()
+	r.lastTotal, r.lastTime = total, now
+	elapsed := now.Sub(r.start).Round(100 * time.Millisecond)
+
+	state := "running"
+	if r.benchmark.Paused() {
+		state = "PAUSED"
+	}
+
+	if !r.inPlace {
+		if state == "PAUSED" {
+			fmt.Printf("Progress: PAUSED, Elapsed = %s, InFlight = %d, Errors = %d\n", elapsed, r.benchmark.InFlight(), errorTotal)
+			return
+		}
+		fmt.Printf("Progress: Elapsed = %s, Rate = %.2f req/s, InFlight = %d, P50 = %.2f ms, P99 = %.2f ms, Errors = %d\n",
+			elapsed, rate, r.benchmark.InFlight(), p50, p99, errorTotal)
+		return
+	}
+
+	lines := []string{
+		fmt.Sprintf("State          %s", state),
+		fmt.Sprintf("Elapsed        %s", elapsed),
+		fmt.Sprintf("Rate           %.2f req/s", rate),
+		fmt.Sprintf("In flight      %d", r.benchmark.InFlight()),
+		fmt.Sprintf("Latency P50    %.2f ms", p50),
+		fmt.Sprintf("Latency P99    %.2f ms", p99),
+		fmt.Sprintf("Errors         %d", errorTotal),
+	}
+
+	var out strings.Builder
+	if r.lines > 0 {
+		// move the cursor back to the top of the dashboard to redraw it
+		fmt.Fprintf(&out, "\033[%dA", r.lines)
+	}
+	for _, line := range lines {
+		out.WriteString("\033[K" + line + "\n")
+	}
+	r.lines = len(lines)
+	fmt.Print(out.String())
+}
+
+// shutdown stops printing the progress.
+func (r *progressReporter) shutdown() {
+	close(r.stop)
+	<-r.done
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// parseProxyURL validates the Proxy setting, nil is returned if no proxy is used.
+func parseProxyURL(proxyURL string) (*url.URL, error) {
+	if proxyURL == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Proxy %q: %v", proxyURL, err)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("Proxy must start with http://, https:// or socks5://, got %q", proxyURL)
+	}
+
+	return u, nil
+}
+
+// proxyDialContext returns a dial function connecting either directly, or through the proxy if it's not nil.
+// HTTP proxies are asked to open a tunnel with CONNECT, HTTPS proxies are connected to with tlsConfig.
+func proxyDialContext(proxyURL *url.URL, tlsConfig *tls.Config) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if proxyURL == nil {
+		return noLingerDialer
+	}
+
+	if proxyURL.Scheme == "socks5" {
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialer, err := proxy.FromURL(proxyURL, resolvingDialer{})
+			if err != nil {
+				return nil, err
+			}
+			con, err := dialer.(proxy.ContextDialer).DialContext(ctx, connectionNetwork(network), addr)
+			if err == nil {
+				connectionsOpened.Add(1)
+			}
+			return con, err
+		}
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialHTTPProxy(ctx, proxyURL, tlsConfig, addr)
+	}
+}
+
+// resolvingDialer connects to the SOCKS5 proxy with ResolveOverrides and the
+// DNS cache applied to its address, like noLingerDialer does.
+type resolvingDialer struct{}
+
+func (d resolvingDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func (d resolvingDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	addr, err := resolveAddr(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	return connectionDialer().DialContext(ctx, network, addr)
+}
+
+func dialHTTPProxy(ctx context.Context, proxyURL *url.URL, tlsConfig *tls.Config, addr string) (net.Conn, error) {
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		if proxyURL.Scheme == "https" {
+			proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "443")
+		} else {
+			proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "80")
+		}
+	}
+
+	conn, err := noLingerDialer(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	if proxyURL.Scheme == "https" {
+		// the settings of the target apply, with the name of the proxy verified
+		proxyTLSConfig := tlsConfig.Clone()
+		proxyTLSConfig.ServerName = proxyURL.Hostname()
+		proxyTLSConfig.NextProtos = nil
+		tlsConn := tls.Client(conn, proxyTLSConfig)
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := proxyURL.User.Username() + ":" + password
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+
+	if err = req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	// nothing is sent through the tunnel before the client speaks, so the reader doesn't buffer any of it
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("Proxy refused to connect to %s: %s", addr, resp.Status)
+	}
+
+	return conn, nil
+}
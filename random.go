@@ -0,0 +1,19 @@
+package main
+
+import "math/rand"
+
+// randomSeed is what all randomized behavior of a run derives from, RandomSeed
+// or the clock, so that a run can be reproduced from the seed it logged.
+var randomSeed int64
+
+// streams of random numbers of a client, so that they don't repeat each other
+const (
+	requestRandom = iota
+	mixRandom
+)
+
+// newClientRand returns a stream of random numbers of a client derived from
+// randomSeed, the same in every run with the seed.
+func newClientRand(number uint64, stream int64) *rand.Rand {
+	return rand.New(rand.NewSource(randomSeed + int64(number)<<4 + stream))
+}
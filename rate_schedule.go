@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"labench/bench"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+type ratePoint struct {
+	Time time.Duration `yaml:"Time"`
+	Rate float64       `yaml:"Rate"`
+}
+
+// loadRateSchedule reads the points of a rate schedule from a YAML list of {Time, Rate}
+// or from a CSV file of time,rate lines, times are durations such as 90s, or seconds.
+func loadRateSchedule(file string) ([]bench.RatePoint, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var points []ratePoint
+	switch strings.ToLower(path.Ext(file)) {
+	case ".yaml", ".yml":
+		if err = yaml.Unmarshal(content, &points); err != nil {
+			return nil, fmt.Errorf("cannot read %s: %v", file, err)
+		}
+	default:
+		if points, err = parseRateScheduleCSV(content); err != nil {
+			return nil, fmt.Errorf("cannot read %s: %v", file, err)
+		}
+	}
+
+	if len(points) < 2 {
+		return nil, fmt.Errorf("%s must have at least two points", file)
+	}
+
+	schedule := make([]bench.RatePoint, len(points))
+	for i, point := range points {
+		if point.Rate < 0 {
+			return nil, fmt.Errorf("%s has a negative rate at %s", file, point.Time)
+		}
+		if i > 0 && point.Time < points[i-1].Time {
+			return nil, fmt.Errorf("%s is not sorted by time at %s", file, point.Time)
+		}
+		schedule[i] = bench.RatePoint{Time: point.Time, Rate: point.Rate}
+	}
+
+	return schedule, nil
+}
+
+func parseRateScheduleCSV(content []byte) ([]ratePoint, error) {
+	reader := csv.NewReader(strings.NewReader(string(content)))
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var points []ratePoint
+	for i, record := range records {
+		t, timeErr := parseScheduleTime(record[0])
+		rate, rateErr := strconv.ParseFloat(record[1], 64)
+		if timeErr != nil || rateErr != nil {
+			// the first line may name the columns
+			if i == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("invalid line %d: %s,%s", i+1, record[0], record[1])
+		}
+		points = append(points, ratePoint{t, rate})
+	}
+
+	return points, nil
+}
+
+func parseScheduleTime(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return time.ParseDuration(value)
+}
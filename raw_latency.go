@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"labench/bench"
+)
+
+// rawLatency is a measured request as written to RawLatencyFile.
+type rawLatency struct {
+	Timestamp     time.Time
+	LatencyMs     float64
+	StatusCode    int
+	BytesSent     int64
+	BytesReceived int64
+	Label         string `json:",omitempty"`
+	Error         string `json:",omitempty"`
+	RequestID     string `json:",omitempty"`
+}
+
+var rawLatencyColumns = []string{"Timestamp", "LatencyMs", "StatusCode", "BytesSent", "BytesReceived", "Label", "Error", "RequestID"}
+
+// rawLatencyWriter writes every measured request to a file, as CSV or as JSON
+// lines if the file name ends with .jsonl. Requests are queued and written on
+// a separate goroutine, so the collection of results is never held up, they
+// are dropped if the queue is full.
+type rawLatencyWriter struct {
+	file    *os.File
+	jsonl   bool
+	queue   chan rawLatency
+	done    chan error
+	dropped uint64
+}
+
+// startRawLatencyWriter observes benchmark and starts writing its requests to file.
+func startRawLatencyWriter(benchmark *bench.Benchmark, file string) (*rawLatencyWriter, error) {
+	err := os.MkdirAll(path.Dir(file), os.ModeDir|os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &rawLatencyWriter{
+		file:  f,
+		jsonl: strings.EqualFold(path.Ext(file), ".jsonl"),
+		queue: make(chan rawLatency, 100000),
+		done:  make(chan error, 1),
+	}
+	benchmark.AddObserver(w)
+
+	go func() { w.done <- w.write() }()
+
+	return w, nil
+}
+
+// Observe implements bench.Observer.
+func (w *rawLatencyWriter) Observe(start time.Time, latency time.Duration, result bench.Result, err error) {
+	r := rawLatency{
+		Timestamp:     start.UTC(),
+		LatencyMs:     float64(latency) / float64(time.Millisecond),
+		StatusCode:    result.StatusCode,
+		BytesSent:     result.BytesSent,
+		BytesReceived: result.BytesReceived,
+		Label:         result.Label,
+		RequestID:     result.RequestID,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	select {
+	case w.queue <- r:
+	default:
+		// only the collector goroutine queues requests
+		w.dropped++
+	}
+}
+
+func (w *rawLatencyWriter) write() error {
+	buffered := bufio.NewWriterSize(w.file, 1<<20)
+
+	if w.jsonl {
+		encoder := json.NewEncoder(buffered)
+		for r := range w.queue {
+			if err := encoder.Encode(r); err != nil {
+				return err
+			}
+		}
+		return buffered.Flush()
+	}
+
+	writer := csv.NewWriter(buffered)
+	if err := writer.Write(rawLatencyColumns); err != nil {
+		return err
+	}
+	for r := range w.queue {
+		err := writer.Write([]string{
+			r.Timestamp.Format(time.RFC3339Nano),
+			strconv.FormatFloat(r.LatencyMs, 'f', 3, 64),
+			strconv.Itoa(r.StatusCode),
+			strconv.FormatInt(r.BytesSent, 10),
+			strconv.FormatInt(r.BytesReceived, 10),
+			r.Label,
+			r.Error,
+			r.RequestID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// close writes the requests still queued and closes the file.
+func (w *rawLatencyWriter) close() error {
+	close(w.queue)
+	err := <-w.done
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if w.dropped > 0 {
+		slog.Warn("Requests were left out of RawLatencyFile, writing could not keep up with the request rate", "dropped", w.dropped)
+	}
+	return err
+}
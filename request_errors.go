@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// Categories of failed requests reported in the summary.
+const (
+	statusMismatchErrors = "Status mismatch"
+	validationErrors     = "Validation"
+	connectionErrors     = "Connection"
+	timeoutErrors        = "Timeout"
+	tlsErrors            = "TLS"
+	dnsErrors            = "DNS"
+	circuitOpenErrors    = "Circuit open"
+)
+
+// requestError is an error of a failed request along with its category.
+type requestError struct {
+	category string
+	err      error
+}
+
+func newRequestError(category string, format string, a ...interface{}) error {
+	return &requestError{category, fmt.Errorf(format, a...)}
+}
+
+func (e *requestError) Error() string { return e.err.Error() }
+
+// Category returns the name of the category the error belongs to.
+func (e *requestError) Category() string { return e.category }
+
+func (e *requestError) Unwrap() error { return e.err }
+
+// classifyError puts an error returned by a transport into its category.
+// Errors which don't fit any category are returned as is.
+func classifyError(err error) error {
+	var categorized *requestError
+	if errors.As(err, &categorized) {
+		return err
+	}
+
+	if category := errorCategory(err); category != "" {
+		return &requestError{category, err}
+	}
+	return err
+}
+
+func errorCategory(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErrors
+	}
+
+	var (
+		recordHeaderErr  tls.RecordHeaderError
+		alertErr         tls.AlertError
+		verificationErr  *tls.CertificateVerificationError
+		unknownAuthority x509.UnknownAuthorityError
+		hostnameErr      x509.HostnameError
+		invalidCertErr   x509.CertificateInvalidError
+	)
+	if errors.As(err, &recordHeaderErr) || errors.As(err, &alertErr) || errors.As(err, &verificationErr) ||
+		errors.As(err, &unknownAuthority) || errors.As(err, &hostnameErr) || errors.As(err, &invalidCertErr) ||
+		strings.Contains(err.Error(), "tls: ") {
+		return tlsErrors
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return timeoutErrors
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return connectionErrors
+	}
+
+	return ""
+}
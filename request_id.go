@@ -0,0 +1,26 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync/atomic"
+)
+
+// requestIDPrefix tells apart the IDs of different runs, the counter the
+// requests of a run, which makes IDs unique without the cost of a UUID.
+var (
+	requestIDPrefix = newRequestIDPrefix()
+	requestIDs      atomic.Uint64
+)
+
+func newRequestIDPrefix() string {
+	prefix := make([]byte, 8)
+	_, _ = rand.Read(prefix)
+	return hex.EncodeToString(prefix) + "-"
+}
+
+// nextRequestID returns a new ID, unique across requesters.
+func nextRequestID() string {
+	return requestIDPrefix + strconv.FormatUint(requestIDs.Add(1), 10)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"labench/bench"
+)
+
+// requestDefinition is one kind of request of a request mix.
+type requestDefinition struct {
+	// Name labels the request in the summary, defaults to method and URL.
+	Name string `yaml:"Name"`
+	// Weight is the relative share of requests, defaults to 1.
+	Weight  float64             `yaml:"Weight"`
+	Request WebRequesterFactory `yaml:",inline"`
+}
+
+// resolveRequestTimeouts returns the timeout of the clients, the longest
+// RequestTimeout of the requests and the global one. The requests overriding
+// it time out at their own, so if one is longer, those without an override
+// are given the global timeout as the clients don't time them out at it.
+func resolveRequestTimeouts(requests []*WebRequesterFactory, global time.Duration) time.Duration {
+	longest := global
+	for _, request := range requests {
+		if request.RequestTimeout > longest {
+			longest = request.RequestTimeout
+		}
+	}
+	if longest > global {
+		for _, request := range requests {
+			if request.RequestTimeout == 0 {
+				request.RequestTimeout = global
+			}
+		}
+	}
+	return longest
+}
+
+// requestMixFactory implements RequesterFactory by creating a Requester
+// which picks one of several request definitions according to their weights.
+type requestMixFactory struct {
+	definitions []requestDefinition
+	// cumulative holds normalized cumulative weights, the last one is 1
+	cumulative []float64
+}
+
+func newRequestMixFactory(definitions []requestDefinition) *requestMixFactory {
+	var total float64
+	for i := range definitions {
+		d := &definitions[i]
+		assert(d.Weight >= 0, fmt.Sprintf("Weight of request %d must not be negative", i+1))
+		if d.Weight == 0 {
+			d.Weight = 1
+		}
+		if d.Name == "" {
+			d.Name = d.Request.HTTPMethod + " " + d.Request.URL
+		}
+		total += d.Weight
+	}
+
+	cumulative := make([]float64, len(definitions))
+	var sum float64
+	for i := range definitions {
+		sum += definitions[i].Weight
+		cumulative[i] = sum / total
+	}
+
+	return &requestMixFactory{definitions, cumulative}
+}
+
+// ConnectionsOpened returns how many connections were opened to the system
+// under test.
+func (f *requestMixFactory) ConnectionsOpened() uint64 {
+	return connectionsOpened.Load()
+}
+
+// GetRequester returns a new Requester, called for each Benchmark connection.
+func (f *requestMixFactory) GetRequester(number uint64) bench.Requester {
+	requesters := make([]bench.Requester, len(f.definitions))
+	for i := range f.definitions {
+		requesters[i] = f.definitions[i].Request.GetRequester(number)
+	}
+
+	return &requestMixRequester{
+		factory:    f,
+		requesters: requesters,
+		rnd:        newClientRand(number, mixRandom),
+	}
+}
+
+// requestMixRequester implements Requester by delegating each request to
+// a Requester of a randomly picked request definition.
+type requestMixRequester struct {
+	factory    *requestMixFactory
+	requesters []bench.Requester
+	rnd        *rand.Rand
+}
+
+// Setup prepares the Requester for benchmarking.
+func (r *requestMixRequester) Setup() error {
+	for _, requester := range r.requesters {
+		if err := requester.Setup(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WarmUpConnection warms up a connection for each of the request definitions.
+func (r *requestMixRequester) WarmUpConnection() error {
+	for _, requester := range r.requesters {
+		if warmer, ok := requester.(bench.ConnectionWarmer); ok {
+			if err := warmer.WarmUpConnection(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Request performs a synchronous request to the system under test.
+func (r *requestMixRequester) Request() (bench.Result, error) {
+	return r.RequestContext(context.Background())
+}
+
+// RequestContext implements bench.ContextRequester, ctx is passed on to the
+// requesters of the definitions which can abort their requests.
+func (r *requestMixRequester) RequestContext(ctx context.Context) (bench.Result, error) {
+	p := r.rnd.Float64()
+	i := 0
+	for i < len(r.factory.cumulative)-1 && p >= r.factory.cumulative[i] {
+		i++
+	}
+
+	var (
+		result bench.Result
+		err    error
+	)
+	if requester, ok := r.requesters[i].(bench.ContextRequester); ok {
+		result, err = requester.RequestContext(ctx)
+	} else {
+		result, err = r.requesters[i].Request()
+	}
+	result.Label = r.factory.definitions[i].Name
+	return result, err
+}
+
+// Teardown is called upon benchmark completion.
+func (r *requestMixRequester) Teardown() error {
+	var firstErr error
+	for _, requester := range r.requesters {
+		if err := requester.Teardown(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// resolveOverrides maps host:port addresses to the ip:port to connect to instead, like curl --resolve.
+var resolveOverrides map[string]string
+
+// hostCache caches DNS lookups when DNSCacheTTL is set, nil otherwise.
+var hostCache *dnsCache
+
+// setResolveOverrides validates and installs the ResolveOverrides setting.
+func setResolveOverrides(overrides map[string]string) error {
+	for addr, override := range overrides {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("ResolveOverrides key %q must be host:port", addr)
+		}
+		host, _, err := net.SplitHostPort(override)
+		if err != nil || net.ParseIP(host) == nil {
+			return fmt.Errorf("ResolveOverrides value %q for %s must be ip:port", override, addr)
+		}
+	}
+
+	resolveOverrides = overrides
+	return nil
+}
+
+// resolveAddr returns the address to connect to for addr. Only the connection is
+// redirected, TLS and the Host header keep using the original hostname.
+func resolveAddr(ctx context.Context, addr string) (string, error) {
+	if override, ok := resolveOverrides[addr]; ok {
+		return override, nil
+	}
+
+	if hostCache == nil {
+		return addr, nil
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return addr, nil
+	}
+
+	ip, err := hostCache.lookup(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ip, port), nil
+}
+
+// dnsCache keeps the addresses of hosts in memory for a while, so the benchmark
+// doesn't measure resolver latency on every new connection.
+type dnsCache struct {
+	ttl     time.Duration
+	mu      sync.RWMutex
+	entries map[string]dnsEntry
+}
+
+type dnsEntry struct {
+	ip      string
+	expires time.Time
+}
+
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{ttl: ttl, entries: make(map[string]dnsEntry)}
+}
+
+// lookup returns the first address of host, resolving it only if it's not cached or expired.
+func (c *dnsCache) lookup(ctx context.Context, host string) (string, error) {
+	c.mu.RLock()
+	entry, ok := c.entries[host]
+	c.mu.RUnlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.ip, nil
+	}
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, lookupNetwork(), host)
+	if err != nil {
+		return "", err
+	}
+
+	entry = dnsEntry{ip: ips[0].String(), expires: time.Now().Add(c.ttl)}
+	c.mu.Lock()
+	c.entries[host] = entry
+	c.mu.Unlock()
+
+	return entry.ip, nil
+}
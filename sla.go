@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+
+	"labench/bench"
+)
+
+// the exit code of a run violating the SLA, apart from the 1 of a failed run
+const slaViolatedExitCode = 3
+
+// slaConfig is the service level agreement a run must meet. Latency holds the
+// highest latency of successful requests at percentiles named P50, P99.9 etc.
+// or Max, and ErrorRate the highest error rate as a fraction of all requests,
+// e.g. 0.01 for 1%.
+type slaConfig struct {
+	Latency   map[string]time.Duration `yaml:",inline"`
+	ErrorRate *float64                 `yaml:"ErrorRate"`
+}
+
+// parseSLAPercentile returns the percentile of a latency criterion, 100 for Max.
+func parseSLAPercentile(name string) (float64, error) {
+	if strings.EqualFold(name, "Max") {
+		return 100, nil
+	}
+	if len(name) > 1 && (name[0] == 'P' || name[0] == 'p') {
+		percentile, err := strconv.ParseFloat(name[1:], 64)
+		if err == nil && percentile > 0 && percentile < 100 {
+			return percentile, nil
+		}
+	}
+	return 0, fmt.Errorf("SLA criteria are latency percentiles like P99 or P99.9, Max and ErrorRate, got %q", name)
+}
+
+// checkSLA returns the checks of the SLA against the summary, the latency
+// percentiles in increasing order and then ErrorRate.
+func checkSLA(sla *slaConfig, summary *bench.Summary) []bench.SLACheck {
+	type latencyCriterion struct {
+		name       string
+		percentile float64
+		limit      time.Duration
+	}
+	var latency []latencyCriterion
+	for name, limit := range sla.Latency {
+		percentile, err := parseSLAPercentile(name)
+		maybePanic(err)
+		latency = append(latency, latencyCriterion{name, percentile, limit})
+	}
+	sort.Slice(latency, func(i, j int) bool { return latency[i].percentile < latency[j].percentile })
+
+	var checks []bench.SLACheck
+	for _, criterion := range latency {
+		actual := float64(summary.SuccessHistogram.Max())
+		if criterion.percentile < 100 {
+			actual = float64(summary.SuccessHistogram.ValueAtQuantile(criterion.percentile))
+		}
+		limit := float64(criterion.limit)
+		checks = append(checks, bench.SLACheck{
+			Criterion: criterion.name,
+			Limit:     limit / float64(time.Millisecond),
+			Actual:    actual / float64(time.Millisecond),
+			// no successful requests means no latency to meet the SLA with
+			Passed: summary.SuccessTotal > 0 && actual <= limit,
+		})
+	}
+
+	if sla.ErrorRate != nil {
+		errorRate := 100.
+		if requestTotal := summary.SuccessTotal + summary.ErrorTotal; requestTotal > 0 {
+			errorRate = float64(summary.ErrorTotal) / float64(requestTotal) * 100
+		}
+		// the check is in percent like the rest of the summary
+		limit := *sla.ErrorRate * 100
+		checks = append(checks, bench.SLACheck{
+			Criterion: "ErrorRate",
+			Limit:     limit,
+			Actual:    errorRate,
+			Passed:    errorRate <= limit,
+		})
+	}
+
+	return checks
+}
+
+// printSLA prints the checks and returns whether all of them passed.
+func printSLA(checks []bench.SLACheck) bool {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"SLA", "Limit", "Actual", ""})
+	table.SetAlignment(tablewriter.ALIGN_RIGHT)
+	failed := 0
+	for _, check := range checks {
+		unit := " ms"
+		if check.Criterion == "ErrorRate" {
+			unit = "%"
+		}
+		verdict := "PASS"
+		if !check.Passed {
+			verdict = "FAIL"
+			failed++
+		}
+		table.Append([]string{
+			check.Criterion,
+			strconv.FormatFloat(check.Limit, 'f', 2, 64) + unit,
+			strconv.FormatFloat(check.Actual, 'f', 2, 64) + unit,
+			verdict,
+		})
+	}
+	table.Render()
+
+	if failed > 0 {
+		fmt.Println(failed, "of", len(checks), "SLA criteria failed")
+		return false
+	}
+	fmt.Println("All SLA criteria passed")
+	return true
+}
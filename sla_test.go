@@ -0,0 +1,134 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/codahale/hdrhistogram"
+
+	"labench/bench"
+)
+
+// slaSummary is the summary of a run with successes taking 1, 2... ms and
+// errors.
+func slaSummary(successes, errors uint64) *bench.Summary {
+	histogram := hdrhistogram.New(1, int64(time.Minute), 3)
+	for i := uint64(1); i <= successes; i++ {
+		if err := histogram.RecordValue(int64(time.Duration(i) * time.Millisecond)); err != nil {
+			panic(err)
+		}
+	}
+	return &bench.Summary{SuccessTotal: successes, ErrorTotal: errors, SuccessHistogram: histogram}
+}
+
+// fraction is an SLA.ErrorRate.
+func fraction(value float64) *float64 { return &value }
+
+func TestCheckSLA(t *testing.T) {
+	tests := []struct {
+		name    string
+		sla     slaConfig
+		summary *bench.Summary
+		checks  []string
+	}{
+		{
+			name:    "latency met",
+			sla:     slaConfig{Latency: map[string]time.Duration{"Max": 200 * time.Millisecond, "P99": 150 * time.Millisecond, "P50": 60 * time.Millisecond}},
+			summary: slaSummary(100, 0),
+			checks:  []string{"P50 passed", "P99 passed", "Max passed"},
+		},
+		{
+			name:    "latency over",
+			sla:     slaConfig{Latency: map[string]time.Duration{"P99": 90 * time.Millisecond, "p50": 60 * time.Millisecond, "P99.9": time.Second}},
+			summary: slaSummary(100, 0),
+			checks:  []string{"p50 passed", "P99 failed", "P99.9 passed"},
+		},
+		{
+			name:    "no successful requests",
+			sla:     slaConfig{Latency: map[string]time.Duration{"P99": time.Second}, ErrorRate: fraction(1)},
+			summary: slaSummary(0, 10),
+			checks:  []string{"P99 failed", "ErrorRate passed"},
+		},
+		{
+			name:    "error rate under",
+			sla:     slaConfig{ErrorRate: fraction(0.05)},
+			summary: slaSummary(98, 2),
+			checks:  []string{"ErrorRate passed"},
+		},
+		{
+			name:    "error rate at the limit",
+			sla:     slaConfig{ErrorRate: fraction(0.02)},
+			summary: slaSummary(98, 2),
+			checks:  []string{"ErrorRate passed"},
+		},
+		{
+			name:    "error rate over",
+			sla:     slaConfig{ErrorRate: fraction(0.01)},
+			summary: slaSummary(98, 2),
+			checks:  []string{"ErrorRate failed"},
+		},
+		{
+			name:    "no errors allowed",
+			sla:     slaConfig{ErrorRate: fraction(0)},
+			summary: slaSummary(99, 1),
+			checks:  []string{"ErrorRate failed"},
+		},
+		{
+			name:    "no requests",
+			sla:     slaConfig{ErrorRate: fraction(0.5)},
+			summary: slaSummary(0, 0),
+			checks:  []string{"ErrorRate failed"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var checks []string
+			for _, check := range checkSLA(&test.sla, test.summary) {
+				verdict := " passed"
+				if !check.Passed {
+					verdict = " failed"
+				}
+				checks = append(checks, check.Criterion+verdict)
+			}
+			if !reflect.DeepEqual(checks, test.checks) {
+				t.Errorf("got %v, want %v", checks, test.checks)
+			}
+		})
+	}
+}
+
+func TestCheckSLAErrorRateInPercent(t *testing.T) {
+	checks := checkSLA(&slaConfig{ErrorRate: fraction(0.05)}, slaSummary(98, 2))
+	if len(checks) != 1 || checks[0].Limit != 5 || checks[0].Actual != 2 {
+		t.Errorf("got %+v, want a limit of 5%% and an error rate of 2%%", checks)
+	}
+}
+
+func TestParseSLAPercentile(t *testing.T) {
+	tests := []struct {
+		name       string
+		percentile float64
+		valid      bool
+	}{
+		{"P50", 50, true},
+		{"p99.9", 99.9, true},
+		{"Max", 100, true},
+		{"max", 100, true},
+		{"P100", 0, false},
+		{"P0", 0, false},
+		{"P", 0, false},
+		{"99", 0, false},
+		{"Pxx", 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			percentile, err := parseSLAPercentile(test.name)
+			if (err == nil) != test.valid || percentile != test.percentile {
+				t.Errorf("got %v, %v, want %v, valid %v", percentile, err, test.percentile, test.valid)
+			}
+		})
+	}
+}
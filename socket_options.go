@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"syscall"
+)
+
+// tcpNoDelay disables Nagle's algorithm on TCP connections, as Go does by
+// default. sendBuffer and receiveBuffer are the SO_SNDBUF and SO_RCVBUF of
+// new TCP connections, zero leaves the sizes to the system.
+var (
+	tcpNoDelay    = true
+	sendBuffer    int
+	receiveBuffer int
+)
+
+// setSocketOptions installs the socket settings. The buffer sizes are set by
+// the Control of the dialer, before connecting, so that the receive buffer
+// also sizes the TCP window the connection starts with.
+func setSocketOptions(noDelay bool, sendBufferSize, receiveBufferSize int) {
+	tcpNoDelay = noDelay
+	sendBuffer, receiveBuffer = sendBufferSize, receiveBufferSize
+	if defaultDialer != nil && (sendBuffer > 0 || receiveBuffer > 0) {
+		defaultDialer.Control = controlSocket
+	}
+}
+
+// controlSocket sets the buffer sizes of a TCP socket about to connect.
+func controlSocket(network, address string, c syscall.RawConn) error {
+	if !strings.HasPrefix(network, "tcp") {
+		return nil
+	}
+
+	var err error
+	controlErr := c.Control(func(fd uintptr) {
+		if sendBuffer > 0 {
+			err = setsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_SNDBUF, sendBuffer)
+		}
+		if err == nil && receiveBuffer > 0 {
+			err = setsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_RCVBUF, receiveBuffer)
+		}
+	})
+	if controlErr != nil {
+		return controlErr
+	}
+	return err
+}
+
+// setNoDelay applies tcpNoDelay to a connection once it's connected, as Go
+// enables TCP_NODELAY on every connection it opens.
+func setNoDelay(con net.Conn) {
+	if tcpCon, ok := con.(*net.TCPConn); ok && !tcpNoDelay {
+		maybePanic(tcpCon.SetNoDelay(false))
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"labench/bench"
+)
+
+// maxStatsDPacket keeps packets below the usual MTU, so they aren't fragmented.
+const maxStatsDPacket = 1432
+
+type statsdConfig struct {
+	Address string `yaml:"Address"`
+	Prefix  string `yaml:"Prefix"`
+}
+
+// statsdEmitter sends the metrics of every measured request to StatsD over UDP.
+// Metrics are queued so the collection of results is never held up, they are
+// dropped if the queue is full.
+type statsdEmitter struct {
+	conn    net.Conn
+	prefix  string
+	tags    string
+	metrics chan string
+	done    chan struct{}
+	dropped uint64
+}
+
+// startStatsDEmitter observes benchmark and starts sending its metrics to the
+// configured address, tagged with the labels in the DogStatsD format.
+func startStatsDEmitter(benchmark *bench.Benchmark, conf statsdConfig, labels map[string]string) (*statsdEmitter, error) {
+	conn, err := net.Dial("udp", conf.Address)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to StatsD: %v", err)
+	}
+
+	e := &statsdEmitter{
+		conn:    conn,
+		prefix:  conf.Prefix,
+		tags:    statsdTags(labels),
+		metrics: make(chan string, 10000),
+		done:    make(chan struct{}),
+	}
+	benchmark.AddObserver(e)
+
+	go e.send()
+
+	return e, nil
+}
+
+// Observe implements bench.Observer.
+func (e *statsdEmitter) Observe(start time.Time, latency time.Duration, result bench.Result, err error) {
+	ms := strconv.FormatFloat(float64(latency)/float64(time.Millisecond), 'f', 3, 64)
+	if err != nil {
+		e.queue(e.prefix + "failure:1|c")
+		e.queue(e.prefix + "failure.latency:" + ms + "|ms")
+		return
+	}
+
+	e.queue(e.prefix + "success:1|c")
+	e.queue(e.prefix + "latency:" + ms + "|ms")
+}
+
+// statsdTags formats labels as the tags of a metric, sorted by name.
+func statsdTags(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	tags := make([]string, 0, len(labels))
+	for name, value := range labels {
+		tags = append(tags, name+":"+value)
+	}
+	sort.Strings(tags)
+	return "|#" + strings.Join(tags, ",")
+}
+
+func (e *statsdEmitter) queue(metric string) {
+	select {
+	case e.metrics <- metric + e.tags:
+	default:
+		// only the collector goroutine queues metrics
+		e.dropped++
+	}
+}
+
+// send batches the queued metrics into packets until the queue is closed.
+func (e *statsdEmitter) send() {
+	defer close(e.done)
+
+	var packet bytes.Buffer
+	for metric := range e.metrics {
+		packet.WriteString(metric)
+
+	batch:
+		for {
+			select {
+			case metric, ok := <-e.metrics:
+				if !ok {
+					break batch
+				}
+				if packet.Len()+1+len(metric) > maxStatsDPacket {
+					e.write(packet.Bytes())
+					packet.Reset()
+				} else {
+					packet.WriteByte('\n')
+				}
+				packet.WriteString(metric)
+			default:
+				break batch
+			}
+		}
+
+		e.write(packet.Bytes())
+		packet.Reset()
+	}
+}
+
+func (e *statsdEmitter) write(packet []byte) {
+	// UDP write errors, e.g. nobody listening, must not stop the benchmark
+	_, _ = e.conn.Write(packet)
+}
+
+// stop sends the metrics still queued and closes the connection.
+func (e *statsdEmitter) stop() {
+	close(e.metrics)
+	<-e.done
+	_ = e.conn.Close()
+
+	if e.dropped > 0 {
+		slog.Warn("StatsD metrics were dropped, sending could not keep up with the request rate", "dropped", e.dropped)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync/atomic"
+	"text/template"
+)
+
+// requestSeq is shared by all clients, so every request gets a unique sequence number.
+var requestSeq uint64
+
+// templateData is what request templates are rendered with, e.g. {{.Seq}} or {{.RandInt 1 100}}.
+type templateData struct {
+	// Seq is the sequence number of the request, starting from 1.
+	Seq uint64
+	// Row is the current row of DataFile by column name, e.g. {{.Row.id}}.
+	Row map[string]string
+
+	rows *dataRows
+	rnd  *rand.Rand
+}
+
+func newTemplateData(rows *dataRows, rnd *rand.Rand) *templateData {
+	return &templateData{rows: rows, rnd: rnd}
+}
+
+// next prepares the data for rendering the next request.
+func (d *templateData) next() {
+	d.Seq = atomic.AddUint64(&requestSeq, 1)
+	if d.rows != nil {
+		d.Row = d.rows.next(d.rnd)
+	}
+}
+
+// UUID returns a random version 4 UUID.
+func (d *templateData) UUID() string {
+	var u [16]byte
+	_, _ = d.rnd.Read(u[:])
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
+// RandInt returns a random integer between min and max inclusive.
+func (d *templateData) RandInt(min, max int) (int, error) {
+	if max < min {
+		return 0, fmt.Errorf("RandInt max %d is less than min %d", max, min)
+	}
+	return min + d.rnd.Intn(max-min+1), nil
+}
+
+// textTemplate is a config string which may contain template placeholders.
+// Only strings with placeholders are rendered, others are used as is.
+type textTemplate struct {
+	text string
+	tmpl *template.Template
+}
+
+// newTextTemplate compiles text, name is used in error messages.
+func newTextTemplate(name, text string) (*textTemplate, error) {
+	if !strings.Contains(text, "{{") {
+		return &textTemplate{text: text}, nil
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s template: %v", name, err)
+	}
+	return &textTemplate{text: text, tmpl: tmpl}, nil
+}
+
+// isStatic reports whether the text has no placeholders.
+func (t *textTemplate) isStatic() bool {
+	return t.tmpl == nil
+}
+
+// render returns the text with placeholders filled from data.
+func (t *textTemplate) render(data *templateData) (string, error) {
+	if t.tmpl == nil {
+		return t.text, nil
+	}
+
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("cannot render %s template: %v", t.tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+// dataRows holds the rows of a CSV file which are cycled through by all clients.
+type dataRows struct {
+	rows    []map[string]string
+	random  bool
+	nextRow uint32
+}
+
+// loadDataRows reads a CSV file, its first line names the columns.
+func loadDataRows(file string, random bool) (*dataRows, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %v", file, err)
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("%s must have a header line and at least one row", file)
+	}
+
+	columns := records[0]
+	rows := make([]map[string]string, len(records)-1)
+	for i, record := range records[1:] {
+		row := make(map[string]string, len(columns))
+		for j, column := range columns {
+			row[column] = record[j]
+		}
+		rows[i] = row
+	}
+
+	return &dataRows{rows: rows, random: random, nextRow: ^uint32(0)}, nil
+}
+
+// next returns the next row, starting over when all rows are used.
+func (d *dataRows) next(rnd *rand.Rand) map[string]string {
+	if d.random {
+		return d.rows[rnd.Intn(len(d.rows))]
+	}
+	return d.rows[atomic.AddUint32(&d.nextRow, 1)%uint32(len(d.rows))]
+}
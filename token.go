@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// fetching a token gives up after this long
+	tokenFetchTimeout = 30 * time.Second
+	// tokens are refreshed once this share of their lifetime has passed
+	tokenRefreshAt = 0.8
+	// a failed fetch is retried after this long, the current token is kept meanwhile
+	tokenRetryInterval = 5 * time.Second
+)
+
+// tokenFetch returns a new access token along with its lifetime, zero if it
+// doesn't expire.
+type tokenFetch func() (token string, lifetime time.Duration, err error)
+
+// refreshedToken holds the Authorization header of an access token, which is
+// refreshed in the background before it expires and on demand when the server
+// rejects it.
+type refreshedToken struct {
+	fetch         tokenFetch
+	authorization atomic.Value
+	// mu serializes fetches, so that concurrent refreshes make a single one
+	mu        sync.Mutex
+	failedAt  time.Time
+	failedErr error
+}
+
+// startRefreshedToken fetches the first access token, so that a bad client
+// fails before the benchmark starts, and starts refreshing it if it expires.
+func startRefreshedToken(fetch tokenFetch) (*refreshedToken, error) {
+	t := &refreshedToken{fetch: fetch}
+	lifetime, err := t.store()
+	if err != nil {
+		return nil, err
+	}
+	if lifetime > 0 {
+		go t.refresh(lifetime)
+	}
+	return t, nil
+}
+
+// header returns the Authorization header of the current access token.
+func (t *refreshedToken) header() string {
+	return t.authorization.Load().(string)
+}
+
+// refreshRejected fetches a new access token unless the rejected header is
+// no longer the current one, as another request already refreshed it. After a
+// failure no token is fetched for tokenRetryInterval, so that the token
+// endpoint isn't flooded by the rejected requests.
+func (t *refreshedToken) refreshRejected(rejected string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.header() != rejected {
+		return nil
+	}
+	if time.Since(t.failedAt) < tokenRetryInterval {
+		return t.failedErr
+	}
+
+	_, err := t.storeLocked()
+	if err != nil {
+		slog.Warn("Token refresh after 401 failed", "error", err, "retryIn", tokenRetryInterval)
+		t.failedAt, t.failedErr = time.Now(), err
+	}
+	return err
+}
+
+func (t *refreshedToken) refresh(lifetime time.Duration) {
+	for {
+		time.Sleep(time.Duration(float64(lifetime) * tokenRefreshAt))
+
+		var err error
+		for lifetime, err = t.store(); err != nil; lifetime, err = t.store() {
+			slog.Warn("Token refresh failed, retrying", "error", err, "retryIn", tokenRetryInterval)
+			time.Sleep(tokenRetryInterval)
+		}
+		slog.Debug("Token refreshed", "expiresIn", lifetime)
+		if lifetime <= 0 {
+			return
+		}
+	}
+}
+
+func (t *refreshedToken) store() (time.Duration, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.storeLocked()
+}
+
+func (t *refreshedToken) storeLocked() (time.Duration, error) {
+	token, lifetime, err := t.fetch()
+	if err != nil {
+		return 0, err
+	}
+	t.authorization.Store("Bearer " + token)
+	return lifetime, nil
+}
+
+// commandToken returns a tokenFetch which runs a shell command printing an
+// access token, e.g. the CLI of a cloud provider. The token doesn't expire, it
+// is only refreshed when rejected.
+func commandToken(command string) tokenFetch {
+	return func() (string, time.Duration, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), tokenFetchTimeout)
+		defer cancel()
+
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+		} else {
+			cmd = exec.CommandContext(ctx, "sh", "-c", command)
+		}
+
+		output, err := cmd.Output()
+		if err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+				return "", 0, errors.New("TokenCommand failed: " + strings.TrimSpace(string(exitErr.Stderr)))
+			}
+			return "", 0, errors.New("TokenCommand failed: " + err.Error())
+		}
+
+		token := strings.TrimSpace(string(output))
+		if token == "" {
+			return "", 0, errors.New("TokenCommand printed no token")
+		}
+		return token, 0, nil
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+
+	"labench/bench"
+)
+
+// requestTrace measures the time to first byte and the phases of opening a
+// connection of a request. The transport may call the hooks from its own
+// goroutines, so times are kept in atomics, as nanoseconds since start.
+type requestTrace struct {
+	start        time.Time
+	dnsStart     int64
+	dnsDone      int64
+	connectStart int64
+	connectDone  int64
+	tlsStart     int64
+	tlsDone      int64
+	firstByte    int64
+	// gotConn is 1 once a connection was obtained, reused and wasIdle are 1 if it was
+	gotConn int32
+	reused  int32
+	wasIdle int32
+}
+
+func newRequestTrace(start time.Time) *requestTrace {
+	return &requestTrace{start: start}
+}
+
+func (t *requestTrace) mark(at *int64) {
+	atomic.StoreInt64(at, int64(time.Since(t.start)))
+}
+
+// markFirst keeps the time of the first call, e.g. when several addresses are dialed.
+func (t *requestTrace) markFirst(at *int64) {
+	atomic.CompareAndSwapInt64(at, 0, int64(time.Since(t.start)))
+}
+
+func (t *requestTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { t.markFirst(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { t.mark(&t.dnsDone) },
+		ConnectStart:         func(string, string) { t.markFirst(&t.connectStart) },
+		ConnectDone:          func(string, string, error) { t.mark(&t.connectDone) },
+		TLSHandshakeStart:    func() { t.markFirst(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.mark(&t.tlsDone) },
+		GotConn:              t.gotConnection,
+		GotFirstResponseByte: func() { t.mark(&t.firstByte) },
+	}
+}
+
+// gotConnection records whether the connection of the request was reused.
+func (t *requestTrace) gotConnection(info httptrace.GotConnInfo) {
+	if info.Reused {
+		atomic.StoreInt32(&t.reused, 1)
+	}
+	if info.WasIdle {
+		atomic.StoreInt32(&t.wasIdle, 1)
+	}
+	atomic.StoreInt32(&t.gotConn, 1)
+}
+
+// timeToFirstByte returns the time since start until the first response byte, zero if none was received.
+func (t *requestTrace) timeToFirstByte() time.Duration {
+	return time.Duration(atomic.LoadInt64(&t.firstByte))
+}
+
+// connectionTiming returns the phases of opening the connection, all zero if an open connection was reused.
+func (t *requestTrace) connectionTiming() bench.ConnectionTiming {
+	return bench.ConnectionTiming{
+		Measured:     true,
+		DNSLookup:    t.phase(&t.dnsStart, &t.dnsDone),
+		Connect:      t.phase(&t.connectStart, &t.connectDone),
+		TLSHandshake: t.phase(&t.tlsStart, &t.tlsDone),
+		GotConn:      atomic.LoadInt32(&t.gotConn) == 1,
+		Reused:       atomic.LoadInt32(&t.reused) == 1,
+		WasIdle:      atomic.LoadInt32(&t.wasIdle) == 1,
+	}
+}
+
+func (t *requestTrace) phase(start, done *int64) time.Duration {
+	s, d := atomic.LoadInt64(start), atomic.LoadInt64(done)
+	if s == 0 || d < s {
+		return 0
+	}
+	return time.Duration(d - s)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// unixSocket is the path of the unix domain socket all connections are made
+// to instead of the host of the URL, empty to connect over TCP. The URL still
+// gives the Host header and the path of requests.
+var unixSocket string
+
+// setUnixSocket validates and installs the UnixSocket setting, a unix:// URL
+// or a plain path.
+func setUnixSocket(target string) error {
+	if target == "" {
+		return nil
+	}
+	path := strings.TrimPrefix(target, "unix://")
+	if path == "" {
+		return fmt.Errorf("UnixSocket must be the path of a socket, e.g. unix:///var/run/app.sock, got %q", target)
+	}
+	unixSocket = path
+	return nil
+}
+
+// dialUnixSocket connects to the unix socket, whatever the address of the
+// request. Lingering doesn't apply to unix sockets.
+func dialUnixSocket(ctx context.Context) (net.Conn, error) {
+	con, err := defaultDialer.DialContext(ctx, "unix", unixSocket)
+	if err == nil {
+		connectionsOpened.Add(1)
+	}
+	return con, err
+}
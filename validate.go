@@ -0,0 +1,564 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"labench/bench"
+)
+
+var protocols = []string{"HTTP/1.0", "HTTP/1.1", "HTTP/2", "HTTP/3", "gRPC", "WebSocket"}
+
+// validateConfig checks the config right after it is read, so that mistakes
+// are reported all at once and before the run rather than as the first of
+// them failing midway. It returns a message for each problem found.
+func validateConfig(conf *config) []string {
+	var problems []string
+	problemf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if conf.Protocol != "" && !contains(protocols, conf.Protocol) {
+		problemf("Protocol must be one of %v, got %q", protocols, conf.Protocol)
+	}
+
+	if len(conf.Endpoints) > 0 {
+		problems = append(problems, validateEndpoints(conf)...)
+	} else if len(conf.Requests) == 0 {
+		problems = append(problems, validateRequest("Request", &conf.Request, conf.Protocol)...)
+	}
+	for i := range conf.Requests {
+		definition := &conf.Requests[i]
+		name := fmt.Sprintf("Requests[%d]", i)
+		if definition.Weight < 0 {
+			problemf("%s.Weight must not be negative, got %v", name, definition.Weight)
+		}
+		problems = append(problems, validateRequest(name, &definition.Request, conf.Protocol)...)
+	}
+
+	params := &conf.Params
+	switch {
+	case conf.CapacitySearch != nil:
+		// the search picks the rates, and runs each probe for ProbeDuration
+		search := conf.CapacitySearch
+		if len(params.LoadSteps) > 0 || params.RateScheduleFile != "" || params.RampUpDuration > 0 || params.RatePerClient != 0 {
+			problemf("CapacitySearch cannot be used with LoadSteps, RateScheduleFile, RampUpDuration or RequestRatePerClient")
+		}
+		if search.MaxLatency <= 0 {
+			problemf("CapacitySearch.MaxLatency must be positive, e.g. MaxLatency: 200ms")
+		}
+		if search.MaxRate > 0 && search.MinRate > search.MaxRate {
+			problemf("CapacitySearch.MinRate %d must not exceed CapacitySearch.MaxRate %d", search.MinRate, search.MaxRate)
+		}
+		if search.Percentile < 0 || search.Percentile >= 100 {
+			problemf("CapacitySearch.Percentile must be from 0 to below 100, got %v", search.Percentile)
+		}
+		if search.MaxErrorRate < 0 || search.MaxErrorRate > 1 {
+			problemf("CapacitySearch.MaxErrorRate is a fraction of the requests and must be from 0 to 1, e.g. 0.01 for 1%%, got %v", search.MaxErrorRate)
+		}
+		if search.ProbeDuration < 0 || search.Precision < 0 {
+			problemf("CapacitySearch.ProbeDuration and CapacitySearch.Precision must not be negative")
+		}
+	case params.RatePerClient != 0 && (len(params.LoadSteps) > 0 || params.RateScheduleFile != ""):
+		problemf("RequestRatePerClient cannot be used with LoadSteps or RateScheduleFile, they set the rate")
+	case len(params.LoadSteps) > 0 && params.RateScheduleFile != "":
+		problemf("LoadSteps and RateScheduleFile cannot be used together, remove one of them")
+	case len(params.LoadSteps) > 0:
+		for i, step := range params.LoadSteps {
+			if step.Rate == 0 || step.Duration <= 0 {
+				problemf("LoadSteps[%d] must have a positive Rate and Duration, e.g. {Rate: 100, Duration: 30s}", i)
+			}
+		}
+	case params.RateScheduleFile != "":
+		problems = append(problems, validateFile("RateScheduleFile", params.RateScheduleFile)...)
+	case params.RatePerClient != 0:
+		// the rate is Clients times RequestRatePerClient
+		if params.RequestRatePerSec != 0 {
+			problemf("RequestRatePerSec and RequestRatePerClient cannot be used together, remove one of them")
+		}
+		if params.RatePerClient < 0 || params.Clients == 0 {
+			problemf("RequestRatePerClient must be positive and needs Clients, e.g. {Clients: 100, RequestRatePerClient: 0.5}")
+		} else if float64(params.Clients)*params.RatePerClient < 0.5 {
+			problemf("Clients times RequestRatePerClient must be at least 1 req/sec, got %v", float64(params.Clients)*params.RatePerClient)
+		}
+		if params.Duration <= 0 && !params.Continuous && params.MaxRequests == 0 {
+			problemf("Duration must be positive, e.g. Duration: 30s, or set MaxRequests to stop after them or Continuous to run until interrupted")
+		}
+	default:
+		if params.RequestRatePerSec == 0 {
+			problemf("RequestRatePerSec must be positive, e.g. RequestRatePerSec: 100, or use LoadSteps or RateScheduleFile")
+		}
+		if params.Duration <= 0 && !params.Continuous && params.MaxRequests == 0 {
+			problemf("Duration must be positive, e.g. Duration: 30s, or set MaxRequests to stop after them or Continuous to run until interrupted")
+		}
+		if params.RampUpDuration > 0 && params.RampUpStartRate > params.RequestRatePerSec {
+			problemf("RampUpStartRate %d must not exceed RequestRatePerSec %d", params.RampUpStartRate, params.RequestRatePerSec)
+		}
+	}
+
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"WarmUpDuration", params.WarmUpDuration},
+		{"RampUpDuration", params.RampUpDuration},
+		{"RequestTimeout", params.RequestTimeout},
+		{"ConnectTimeout", params.ConnectTimeout},
+		{"BaseLatency", params.BaseLatency},
+		{"ErrorRateWindow", params.ErrorRateWindow},
+		{"DrainTimeout", params.DrainTimeout},
+		{"ProgressInterval", params.ProgressInterval},
+		{"DNSCacheTTL", params.DNSCacheTTL},
+		{"HistogramLogInterval", conf.Interval},
+	}
+	for _, d := range durations {
+		if d.value < 0 {
+			problemf("%s must not be negative, got %v", d.name, d.value)
+		}
+	}
+	if params.RequestTimeout > 0 && params.ConnectTimeout > params.RequestTimeout {
+		problemf("ConnectTimeout %v must not exceed RequestTimeout %v, the request would time out first", params.ConnectTimeout, params.RequestTimeout)
+	}
+
+	if params.MaxErrorRate < 0 || params.MaxErrorRate > 1 {
+		problemf("MaxErrorRate is a fraction of the requests and must be from 0 to 1, e.g. 0.05 for 5%%, got %v", params.MaxErrorRate)
+	}
+	if params.HistogramDigits < 0 || params.HistogramDigits > 5 {
+		problemf("HistogramSignificantDigits must be from 1 to 5, got %d", params.HistogramDigits)
+	}
+	if params.HistogramMinValue < 0 || params.HistogramMaxValue < 0 {
+		problemf("HistogramMinValue and HistogramMaxValue must not be negative")
+	} else if params.HistogramMinValue > 0 && params.HistogramMaxValue > 0 && params.HistogramMaxValue < 2*params.HistogramMinValue {
+		problemf("HistogramMaxValue %v must be at least twice HistogramMinValue %v", params.HistogramMaxValue, params.HistogramMinValue)
+	}
+	if err := bench.ValidatePercentiles(params.Percentiles); err != nil {
+		problemf("Percentiles: %v", err)
+	}
+
+	if params.CoordinatedOmission != "" && !contains([]string{"Uncorrected", "Corrected", "Both"}, params.CoordinatedOmission) {
+		problemf("CoordinatedOmission must be Uncorrected, Corrected or Both, got %q", params.CoordinatedOmission)
+	}
+	if params.Arrivals != "" && !contains([]string{"Uniform", "Poisson"}, params.Arrivals) {
+		problemf("Arrivals must be Uniform or Poisson, got %q", params.Arrivals)
+	}
+	think := params.ThinkTime
+	if think.Distribution != "" && !contains([]string{"Fixed", "Uniform", "Exponential"}, think.Distribution) {
+		problemf("ThinkTime.Distribution must be Fixed, Uniform or Exponential, got %q", think.Distribution)
+	}
+	if think.Mean < 0 || think.Min < 0 || think.Max < 0 {
+		problemf("ThinkTime Mean, Min and Max must not be negative")
+	} else if (think.Max > 0 || think.Distribution == "Uniform") && think.Max < think.Min {
+		problemf("ThinkTime.Max %v must be at least ThinkTime.Min %v", think.Max, think.Min)
+	}
+	if _, err := bench.ParseDistributionFormat(conf.Format); err != nil {
+		problemf("OutFormat: %v", err)
+	}
+
+	if (params.ClientCert == "") != (params.ClientKey == "") {
+		problemf("ClientCert and ClientKey must be set together")
+	}
+	if params.ClientCert != "" {
+		problems = append(problems, validateFile("ClientCert", params.ClientCert)...)
+		problems = append(problems, validateFile("ClientKey", params.ClientKey)...)
+	}
+	for _, addr := range params.LocalAddresses {
+		if net.ParseIP(addr) == nil {
+			problemf("LocalAddresses %q must be an IP address", addr)
+		}
+	}
+	if params.Proxy != "" && (conf.Protocol == "HTTP/1.0" || conf.Protocol == "HTTP/3") {
+		problemf("Proxy is not supported with %s", conf.Protocol)
+	}
+	if params.HTTP2MaxStreams > 0 && conf.Protocol != "HTTP/2" {
+		problemf("HTTP2MaxConcurrentStreams is only supported with HTTP/2")
+	}
+	if params.PipelineDepth > 0 {
+		if conf.Protocol != "" && conf.Protocol != "HTTP/1.1" {
+			problemf("PipelineDepth is only supported with HTTP/1.1, HTTP/2 and HTTP/3 multiplex requests instead")
+		}
+		if params.Proxy != "" {
+			problemf("PipelineDepth cannot be used with Proxy")
+		}
+	}
+	if len(params.LocalAddresses) > 0 && conf.Protocol == "HTTP/3" {
+		problemf("LocalAddresses is not supported with HTTP/3")
+	}
+	if params.DialNetwork != "" && !contains([]string{"tcp", "tcp4", "tcp6"}, params.DialNetwork) {
+		problemf("DialNetwork must be tcp, tcp4 or tcp6, got %q", params.DialNetwork)
+	} else if params.DialNetwork != "" && params.DialNetwork != "tcp" && conf.Protocol == "HTTP/3" {
+		problemf("DialNetwork is not supported with HTTP/3")
+	}
+	if params.MaxIdleConnsPerHost < 0 || params.MaxConnsPerHost < 0 || params.IdleConnTimeout < 0 {
+		problemf("MaxIdleConnsPerHost, MaxConnsPerHost and IdleConnTimeout must not be negative")
+	}
+	if params.MaxIdleConnsPerHost > 0 || params.MaxConnsPerHost > 0 || params.IdleConnTimeout > 0 {
+		if conf.Protocol != "" && conf.Protocol != "HTTP/1.1" {
+			problemf("MaxIdleConnsPerHost, MaxConnsPerHost and IdleConnTimeout are only supported with HTTP/1.1, other protocols multiplex or don't reuse connections")
+		}
+		if (params.MaxIdleConnsPerHost > 0 || params.IdleConnTimeout > 0) && !params.ReuseConnections {
+			problemf("MaxIdleConnsPerHost and IdleConnTimeout need ReuseConnections, connections are closed after each request without it")
+		}
+		if params.PipelineDepth > 0 {
+			problemf("MaxIdleConnsPerHost, MaxConnsPerHost and IdleConnTimeout cannot be used with PipelineDepth, which opens its own connections")
+		}
+	}
+	if params.SendBuffer < 0 || params.ReceiveBuffer < 0 {
+		problemf("SocketSendBuffer and SocketReceiveBuffer must not be negative")
+	}
+	if (params.TCPNoDelay != nil || params.SendBuffer > 0 || params.ReceiveBuffer > 0) && conf.Protocol == "HTTP/3" {
+		problemf("TCPNoDelay, SocketSendBuffer and SocketReceiveBuffer are not supported with HTTP/3, which runs over UDP")
+	}
+	if params.UnixSocket != "" {
+		if conf.Protocol != "" && conf.Protocol != "HTTP/1.1" && conf.Protocol != "HTTP/1.0" && conf.Protocol != "HTTP/2" {
+			problemf("UnixSocket is only supported with HTTP/1.1, HTTP/1.0 and HTTP/2")
+		}
+		if strings.TrimPrefix(params.UnixSocket, "unix://") == "" {
+			problemf("UnixSocket must be the path of a socket, e.g. unix:///var/run/app.sock, got %q", params.UnixSocket)
+		}
+		if params.Proxy != "" || len(params.LocalAddresses) > 0 || (params.DialNetwork != "" && params.DialNetwork != "tcp") {
+			problemf("UnixSocket cannot be used with Proxy, LocalAddresses or DialNetwork, which only apply to TCP connections")
+		}
+	}
+	if params.MaxRedirects < 0 {
+		problemf("MaxRedirects must not be negative, got %d", params.MaxRedirects)
+	}
+	if conf.SLA != nil {
+		for name, limit := range conf.SLA.Latency {
+			if _, err := parseSLAPercentile(name); err != nil {
+				problemf("%v", err)
+			} else if limit <= 0 {
+				problemf("SLA.%s must be a positive latency, e.g. %s: 200ms", name, name)
+			}
+		}
+		if rate := conf.SLA.ErrorRate; rate != nil && (*rate < 0 || *rate > 1) {
+			problemf("SLA.ErrorRate is a fraction of all requests and must be from 0 to 1, e.g. 0.01 for 1%%, got %v", *rate)
+		}
+		if conf.CapacitySearch != nil {
+			problemf("SLA cannot be used with CapacitySearch, whose MaxLatency and MaxErrorRate are the SLA of the probes")
+		}
+	}
+	if conf.FailureLog.MaxBodyBytes < 0 || conf.FailureLog.MaxFailures < 0 {
+		problemf("FailureLog.MaxBodyBytes and FailureLog.MaxFailures must not be negative")
+	}
+	if conf.FailureLog.File == "" && (conf.FailureLog.MaxBodyBytes != 0 || conf.FailureLog.MaxFailures != 0 || len(conf.FailureLog.Headers) > 0) {
+		problemf("FailureLog.File is required to log failed requests")
+	}
+	if params.Continuous {
+		if params.Duration > 0 {
+			problemf("Continuous runs until interrupted and cannot be used with Duration %v, remove one of them", params.Duration)
+		}
+		if conf.CapacitySearch != nil || len(params.LoadSteps) > 0 || params.RateScheduleFile != "" {
+			problemf("Continuous cannot be used with CapacitySearch, LoadSteps or RateScheduleFile, they end on their own")
+		}
+	}
+	if chart := conf.Chart; chart.MaxPercentile < 0 || chart.MaxPercentile >= 100 || chart.MinLatency < 0 || chart.MaxLatency < 0 {
+		problemf("Chart.MaxPercentile must be from 0 to below 100 and Chart.MinLatency and Chart.MaxLatency must not be negative")
+	} else if chart.MaxLatency > 0 && chart.MinLatency >= chart.MaxLatency {
+		problemf("Chart.MinLatency %v must be below Chart.MaxLatency %v", chart.MinLatency, chart.MaxLatency)
+	}
+	if params.StopOnFirstError && conf.CapacitySearch != nil {
+		problemf("StopOnFirstError cannot be used with CapacitySearch, probes failing within MaxErrorRate are part of the search")
+	}
+	if hook := conf.Webhook; hook.URL != "" {
+		if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problemf("Webhook.URL must be an http or https URL, got %q", hook.URL)
+		}
+		if hook.Timeout < 0 {
+			problemf("Webhook.Timeout must not be negative, got %v", hook.Timeout)
+		}
+	} else if hook.Slack || hook.Timeout != 0 {
+		problemf("Webhook.URL is required to notify a webhook")
+	}
+	metricsLabels := make(map[string]string, len(conf.Labels))
+	for name, value := range conf.Labels {
+		if name == "" || strings.ContainsAny(name, ":|,#") {
+			problemf("Labels names must not be empty or contain :, |, , or #, got %q", name)
+		} else if name == "result" || name == "category" || name == "le" {
+			problemf("Labels.%s is a label of the metrics of MetricsPort, use another name", name)
+		} else if params.MetricsPort != 0 {
+			metricsName := prometheusLabelName(name)
+			if metricsName[0] >= '0' && metricsName[0] <= '9' || strings.HasPrefix(metricsName, "__") {
+				problemf("Labels.%s cannot be a label of MetricsPort, whose names must not start with a digit or __", name)
+			} else if other, ok := metricsLabels[metricsName]; ok {
+				problemf("Labels.%s and Labels.%s are both the label %s of MetricsPort, rename one of them", min(name, other), max(name, other), metricsName)
+			}
+			metricsLabels[metricsName] = name
+		}
+		if conf.StatsD.Address != "" && strings.ContainsAny(value, "|,\n") {
+			problemf("Labels.%s cannot be a StatsD tag, it must not contain |, , or line breaks", name)
+		}
+	}
+	labels := conf.Labels
+	if len(conf.Endpoints) > 0 {
+		labels = map[string]string{"endpoint": conf.Endpoints[0].Name}
+		for name, value := range conf.Labels {
+			labels[name] = value
+		}
+	}
+	data := newFileNameData(time.Now(), params.RequestRatePerSec, labels)
+	files := outputFiles(conf)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := expandFileName(*files[name], data); err != nil {
+			problemf("%s is not a valid file name template, e.g. out/{{.Timestamp}}-{{.Rate}}.hgrm: %v", name, err)
+		}
+	}
+	if params.MetricsPort < 0 || params.MetricsPort > 65535 {
+		problemf("MetricsPort must be from 1 to 65535, got %d", params.MetricsPort)
+	}
+
+	return problems
+}
+
+// endpointName is what the names of Endpoints may hold, as they are part of
+// file names and of the labels of the metrics.
+var endpointName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// validateEndpoints checks the Endpoints, and the Request sent to them.
+func validateEndpoints(conf *config) []string {
+	var problems []string
+	problemf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if len(conf.Requests) > 0 || conf.CapacitySearch != nil || conf.Params.Continuous {
+		problemf("Endpoints cannot be used with Requests, CapacitySearch or Continuous")
+	}
+	if conf.Protocol == "gRPC" {
+		problemf("Endpoints cannot be used with gRPC, its targets are not URLs")
+	}
+	if conf.Request.URL != "" || len(conf.Request.URLs) > 0 || len(conf.Request.Hosts) > 0 {
+		problemf("Request.URL, Request.URLs and Request.Hosts cannot be used with Endpoints, the URL of each endpoint is used")
+	}
+	if _, ok := conf.Labels["endpoint"]; ok {
+		problemf("Labels.endpoint cannot be used with Endpoints, it is the name of the endpoint of each run")
+	}
+
+	names := make(map[string]bool, len(conf.Endpoints))
+	for i, e := range conf.Endpoints {
+		if !endpointName.MatchString(e.Name) {
+			problemf("Endpoints[%d].Name is required and may only hold letters, digits, ., _ and -, got %q", i, e.Name)
+		} else if names[e.Name] {
+			problemf("Endpoints[%d].Name %q is used by another endpoint, the names tell their output files apart", i, e.Name)
+		}
+		names[e.Name] = true
+		if e.URL == "" {
+			problemf("Endpoints[%d].URL is required", i)
+		}
+	}
+
+	// the request is the same for all endpoints but the URL
+	if first := conf.Endpoints[0].URL; first != "" {
+		problems = append(problems, validateRequest("Request", conf.Request.withURL(first), conf.Protocol)...)
+	}
+	return problems
+}
+
+// validateRequest checks a request definition, name is its place in the config.
+func validateRequest(name string, request *WebRequesterFactory, protocol string) []string {
+	var problems []string
+	problemf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if request.URL == "" && len(request.URLs) == 0 {
+		problemf("%s.URL is required, e.g. URL: https://my.server/", name)
+	}
+	if protocol == "gRPC" {
+		if request.GRPCMethod == "" || request.ProtoDescriptorSet == "" {
+			problemf("%s.GRPCMethod and %s.ProtoDescriptorSet are required with Protocol gRPC", name, name)
+		}
+	}
+
+	status := request.ExpectedHTTPStatusCode
+	if status != 0 && (status < 100 || status > 599) {
+		problemf("%s.ExpectedHTTPStatusCode must be an HTTP status code, got %d", name, status)
+	}
+	if request.MaxRetries < 0 {
+		problemf("%s.MaxRetries must not be negative, got %d", name, request.MaxRetries)
+	}
+	if request.RequestTimeout < 0 {
+		problemf("%s.RequestTimeout must not be negative, got %v", name, request.RequestTimeout)
+	}
+	if request.RandomBodySize < 0 {
+		problemf("%s.RandomBodySize must not be negative, got %d", name, request.RandomBodySize)
+	}
+	if request.ResponseBodyRegex != "" {
+		if _, err := regexp.Compile(request.ResponseBodyRegex); err != nil {
+			problemf("%s.ResponseBodyRegex: %v", name, err)
+		}
+	}
+	if request.DataOrder != "" && request.DataOrder != "Sequential" && request.DataOrder != "Random" {
+		problemf("%s.DataOrder must be Sequential or Random, got %q", name, request.DataOrder)
+	}
+
+	if request.OAuth2 != nil {
+		if request.OAuth2.TokenURL == "" || request.OAuth2.ClientID == "" {
+			problemf("%s.OAuth2.TokenURL and %s.OAuth2.ClientID are required", name, name)
+		}
+		if request.TokenCommand != "" {
+			problemf("%s.OAuth2 and %s.TokenCommand cannot be used together, remove one of them", name, name)
+		}
+	}
+	if (request.OAuth2 != nil || request.TokenCommand != "") && (protocol == "gRPC" || protocol == "WebSocket") {
+		problemf("%s.OAuth2 and %s.TokenCommand are only supported with HTTP protocols", name, name)
+	}
+	if strings.EqualFold(request.HTTPMethod, http.MethodHead) {
+		if request.Body != "" || request.BodyFile != "" || request.RandomBodySize > 0 || request.Multipart != nil {
+			problemf("%s.HTTPMethod HEAD sends no body, remove Body, BodyFile, RandomBodySize and Multipart", name)
+		}
+		if request.ResponseBodyRegex != "" || request.ResponseJSONPath != "" {
+			problemf("%s.HTTPMethod HEAD gets no response body to check, remove ResponseBodyRegex and ResponseJSONPath", name)
+		}
+	}
+	if request.Multipart != nil {
+		if protocol == "gRPC" || protocol == "WebSocket" {
+			problemf("%s.Multipart is only supported with HTTP protocols", name)
+		}
+		if request.Body != "" || request.BodyFile != "" || request.RandomBodySize > 0 {
+			problemf("%s.Multipart is the body, it cannot be used with Body, BodyFile or RandomBodySize", name)
+		}
+		for i, file := range request.Multipart.Files {
+			if file.Field == "" || file.Path == "" {
+				problemf("%s.Multipart.Files[%d] must have a Field and a Path", name, i)
+			} else {
+				problems = append(problems, validateFile(fmt.Sprintf("%s.Multipart.Files[%d]", name, i), file.Path)...)
+			}
+		}
+	}
+	if request.GraphQL != nil {
+		if protocol == "gRPC" || protocol == "WebSocket" {
+			problemf("%s.GraphQL is only supported with HTTP protocols", name)
+		}
+		if request.Body != "" || request.BodyFile != "" || request.RandomBodySize > 0 || request.Multipart != nil {
+			problemf("%s.GraphQL is the body, it cannot be used with Body, BodyFile, RandomBodySize or Multipart", name)
+		}
+		if request.HTTPMethod != "" && request.HTTPMethod != http.MethodPost {
+			problemf("%s.GraphQL is sent with POST, got HTTPMethod %s", name, request.HTTPMethod)
+		}
+		if (request.GraphQL.Query == "") == (request.GraphQL.QueryFile == "") {
+			problemf("%s.GraphQL needs either a Query or a QueryFile", name)
+		} else if request.GraphQL.QueryFile != "" {
+			problems = append(problems, validateFile(name+".GraphQL.QueryFile", request.GraphQL.QueryFile)...)
+		}
+	}
+	if request.CompressRequest {
+		if protocol == "gRPC" || protocol == "WebSocket" {
+			problemf("%s.CompressRequest is only supported with HTTP protocols", name)
+		}
+		if request.Multipart != nil || request.RandomBodySize > 0 {
+			problemf("%s.CompressRequest compresses Body, BodyFile or GraphQL, it cannot be used with Multipart or RandomBodySize", name)
+		}
+		for header := range request.Headers {
+			if http.CanonicalHeaderKey(header) == "Content-Encoding" {
+				problemf("%s.CompressRequest and the Content-Encoding of %s.Headers cannot be used together, remove one of them", name, name)
+			}
+		}
+		// the body is compressed once when the requests are prepared, so it cannot change per request
+		body := request.Body
+		if request.BodyFile != "" && request.BodyFile != stdinBodyFile {
+			if content, err := ioutil.ReadFile(request.BodyFile); err == nil {
+				body = string(content)
+			}
+		}
+		if request.GraphQL != nil {
+			if graphQLBody, err := newGraphQLBody(request.GraphQL); err == nil {
+				body = graphQLBody
+			}
+		}
+		if strings.Contains(body, "{{") {
+			problemf("%s.CompressRequest needs a body without placeholders, as it is compressed once at startup", name)
+		}
+	}
+	if request.UserAgent != nil {
+		if protocol == "gRPC" {
+			problemf("%s.UserAgent is not supported with gRPC", name)
+		}
+		for header := range request.Headers {
+			if http.CanonicalHeaderKey(header) == "User-Agent" {
+				problemf("%s.UserAgent and the User-Agent of %s.Headers cannot be used together, remove one of them", name, name)
+			}
+		}
+	}
+	if request.RequestIDHeader != "" {
+		if protocol == "gRPC" || protocol == "WebSocket" {
+			problemf("%s.RequestIDHeader is only supported with HTTP protocols", name)
+		}
+		for header := range request.Headers {
+			if http.CanonicalHeaderKey(header) == http.CanonicalHeaderKey(request.RequestIDHeader) {
+				problemf("%s.RequestIDHeader and the %s of %s.Headers cannot be used together, remove one of them", name, header, name)
+			}
+		}
+	}
+	if request.RespectRetryAfter && (protocol == "gRPC" || protocol == "WebSocket") {
+		problemf("%s.RespectRetryAfter is only supported with HTTP protocols", name)
+	}
+	for _, status := range request.AcceptedStatusCodes {
+		if status < 100 || status > 599 {
+			problemf("%s.AcceptedStatusCodes must be HTTP status codes, got %d", name, status)
+		}
+	}
+	if (request.ConditionalRequests || len(request.AcceptedStatusCodes) > 0) && (protocol == "gRPC" || protocol == "WebSocket") {
+		problemf("%s.ConditionalRequests and %s.AcceptedStatusCodes are only supported with HTTP protocols", name, name)
+	}
+	if breaker := request.CircuitBreaker; breaker != nil {
+		if breaker.ConsecutiveFailures < 0 || breaker.CoolDown < 0 {
+			problemf("%s.CircuitBreaker.ConsecutiveFailures and %s.CircuitBreaker.CoolDown must not be negative", name, name)
+		}
+		if protocol == "gRPC" || protocol == "WebSocket" {
+			problemf("%s.CircuitBreaker is only supported with HTTP protocols", name)
+		}
+	}
+	if request.CookieJar && (protocol == "gRPC" || protocol == "WebSocket") {
+		problemf("%s.CookieJar is only supported with HTTP protocols", name)
+	}
+	if request.ReauthOn401 && request.OAuth2 == nil && request.TokenCommand == "" {
+		problemf("%s.ReauthOn401 needs OAuth2 or TokenCommand to get a new token from", name)
+	}
+
+	files := []struct{ option, file string }{
+		{"BodyFile", request.BodyFile},
+		{"BearerTokenFile", request.BearerTokenFile},
+		{"DataFile", request.DataFile},
+		{"ProtoDescriptorSet", request.ProtoDescriptorSet},
+	}
+	for _, f := range files {
+		// stdin is only read when the requests are prepared
+		if f.file != "" && f.file != stdinBodyFile {
+			problems = append(problems, validateFile(name+"."+f.option, f.file)...)
+		}
+	}
+
+	return problems
+}
+
+// validateFile checks that the file of an option can be read.
+func validateFile(option, file string) []string {
+	f, err := os.Open(file)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %v", option, err)}
+	}
+	f.Close()
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,18 @@
+package main
+
+import "runtime/debug"
+
+// version is set when building a release, with -ldflags "-X main.version=1.2.3".
+var version string
+
+// labenchVersion returns the version of the release, or the one the go
+// command stamped the build with, or dev.
+func labenchVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
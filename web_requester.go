@@ -1,19 +1,30 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/tls"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log/slog"
+	"math/rand"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
 	"golang.org/x/net/http2"
 
 	"time"
@@ -25,78 +36,346 @@ var (
 	httpClient    *http.Client
 	defaultDialer *net.Dialer
 	noLinger      bool
+
+	// connectionsOpened counts the connections opened to the system under test
+	connectionsOpened atomic.Uint64
 )
 
 func noLingerDialer(ctx context.Context, network, addr string) (net.Conn, error) {
-	con, err := defaultDialer.DialContext(ctx, network, addr)
+	if unixSocket != "" {
+		return dialUnixSocket(ctx)
+	}
+
+	addr, err := resolveAddr(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	con, err := connectionDialer().DialContext(ctx, connectionNetwork(network), addr)
+	if err == nil {
+		connectionsOpened.Add(1)
+		setNoDelay(con)
+	}
 	if err == nil && con != nil && noLinger {
 		maybePanic(con.(*net.TCPConn).SetLinger(0))
 	}
 	return con, err
 }
 
-func initHTTPClient(reuseConnections bool, requestTimeout time.Duration, dontLinger bool, insecure bool) {
+// newTLSConfig returns the TLS settings shared by all protocols.
+func newTLSConfig(params *benchParams) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: params.Insecure,
+		// the host of the URL is used when empty
+		ServerName: params.ServerName,
+	}
+
+	if params.ClientCert != "" || params.ClientKey != "" {
+		if params.ClientCert == "" || params.ClientKey == "" {
+			return nil, errors.New("both ClientCert and ClientKey must be specified for client authentication")
+		}
+		cert, err := tls.LoadX509KeyPair(params.ClientCert, params.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate %s with key %s: %v", params.ClientCert, params.ClientKey, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	var err error
+	if tlsConfig.MinVersion, err = parseTLSVersion("TLSMinVersion", params.TLSMinVersion); err != nil {
+		return nil, err
+	}
+	if tlsConfig.MaxVersion, err = parseTLSVersion("TLSMaxVersion", params.TLSMaxVersion); err != nil {
+		return nil, err
+	}
+	if tlsConfig.MinVersion != 0 && tlsConfig.MaxVersion != 0 && tlsConfig.MinVersion > tlsConfig.MaxVersion {
+		return nil, fmt.Errorf("TLSMinVersion %s is higher than TLSMaxVersion %s", params.TLSMinVersion, params.TLSMaxVersion)
+	}
+
+	for _, name := range params.TLSCipherSuites {
+		id, err := parseCipherSuite(name)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+	}
+
+	return tlsConfig, nil
+}
+
+// parseCipherSuite returns the ID of a cipher suite by its standard name, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256.
+func parseCipherSuite(name string) (uint16, error) {
+	for _, suites := range [][]*tls.CipherSuite{tls.CipherSuites(), tls.InsecureCipherSuites()} {
+		for _, suite := range suites {
+			if suite.Name != name {
+				continue
+			}
+			for _, version := range suite.SupportedVersions {
+				if version == tls.VersionTLS13 {
+					return 0, fmt.Errorf("TLSCipherSuites %s is a TLS 1.3 suite, TLS 1.3 suites cannot be selected", name)
+				}
+			}
+			return suite.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("TLSCipherSuites %s is not a known cipher suite", name)
+}
+
+// tlsVersions are the accepted values of TLSMinVersion and TLSMaxVersion.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion returns the version named by value, e.g. 1.2 or TLS1.2, zero if it's empty.
+func parseTLSVersion(setting, value string) (uint16, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	version, ok := tlsVersions[strings.TrimPrefix(strings.ToUpper(value), "TLS")]
+	if !ok {
+		return 0, fmt.Errorf("%s %q is not a TLS version, use 1.0, 1.1, 1.2 or 1.3", setting, value)
+	}
+	return version, nil
+}
+
+func initHTTPClient(reuseConnections bool, requestTimeout, connectTimeout time.Duration, dontLinger bool, tlsConfig *tls.Config, proxyURL *url.URL) {
 	defaultDialer = &net.Dialer{
-		Timeout: requestTimeout,
+		Timeout: connectTimeout,
 		// Disable TCP keepalives as we are sending data very actively anyway.
 		// Should not be confused with HTTP keep alive.
 		KeepAlive: 0,
 	}
 
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{"http/1.1"}
+
+	var proxy func(*http.Request) (*url.URL, error)
+	if proxyURL != nil {
+		proxy = http.ProxyURL(proxyURL)
+	}
+
 	httpClient = &http.Client{
 		Transport: &http.Transport{
-			Proxy:                 http.ProxyFromEnvironment,
+			Proxy:                 proxy,
 			DialContext:           noLingerDialer,
 			DisableKeepAlives:     !reuseConnections,
 			MaxIdleConns:          0,
 			MaxIdleConnsPerHost:   0,
 			IdleConnTimeout:       90 * time.Second,
 			ResponseHeaderTimeout: requestTimeout,
-			TLSHandshakeTimeout:   requestTimeout,
+			TLSHandshakeTimeout:   connectTimeout,
 			ExpectContinueTimeout: 1 * time.Second,
-			TLSClientConfig: &tls.Config{
-				NextProtos:         []string{"http/1.1"},
-				InsecureSkipVerify: insecure,
-			},
+			TLSClientConfig:       tlsConfig,
+			DisableCompression:    true,
 		},
 		Timeout: requestTimeout}
 
 	noLinger = dontLinger
 }
 
-func initHTTP2Client(requestTimeout time.Duration, dontLinger bool, insecure bool) {
+// setRedirectPolicy makes the HTTP client follow up to maxRedirects
+// redirects, or none so that the redirect itself is the response.
+func setRedirectPolicy(followRedirects bool, maxRedirects int) {
+	httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if !followRedirects {
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= maxRedirects {
+			return newRequestError(validationErrors, "stopped after %d redirects", maxRedirects)
+		}
+		return nil
+	}
+}
+
+// setConnectionPool sets the limits of the HTTP/1.1 connection pool, zero
+// keeps a default. maxIdlePerHost defaults to clients, so that every
+// Benchmark connection can keep its connection open between requests instead
+// of all but the 2 of net/http being closed, idleTimeout to 90s and
+// maxPerHost to no limit. With maxPerHost below clients, requests wait for a
+// connection to be free and that wait is part of their latency.
+func setConnectionPool(maxIdlePerHost, maxPerHost int, idleTimeout time.Duration, clients int) {
+	transport, ok := httpClient.Transport.(*http.Transport)
+	if !ok {
+		return
+	}
+	if maxIdlePerHost == 0 {
+		maxIdlePerHost = clients
+	}
+	transport.MaxIdleConnsPerHost = maxIdlePerHost
+	transport.MaxConnsPerHost = maxPerHost
+	if idleTimeout > 0 {
+		transport.IdleConnTimeout = idleTimeout
+	}
+}
+
+// closeIdleConnections closes the connections the clients keep open once a
+// run is over, so that the next run opens its own like the first one did.
+func closeIdleConnections() {
+	if httpClient != nil {
+		httpClient.CloseIdleConnections()
+	}
+	http2ClientsMu.Lock()
+	for _, client := range http2Clients {
+		client.CloseIdleConnections()
+	}
+	http2ClientsMu.Unlock()
+	pipelinesMu.Lock()
+	for _, client := range pipelines {
+		client.CloseIdleConnections()
+	}
+	pipelinesMu.Unlock()
+}
+
+// initHTTP2Client sets up a client multiplexing all requests to a host over a
+// single connection, or over a connection per maxStreams Benchmark
+// connections if it's not zero, see http2StreamsClient.
+func initHTTP2Client(requestTimeout, connectTimeout time.Duration, dontLinger bool, tlsConfig *tls.Config, proxyURL *url.URL, maxStreams uint64) {
 	defaultDialer = &net.Dialer{
-		Timeout: requestTimeout,
+		Timeout: connectTimeout,
 		// Disable TCP keepalives as we are sending data very actively anyway.
 		// Should not be confused with HTTP keep alive.
 		KeepAlive: 0,
 	}
 
-	httpClient = &http.Client{
-		Transport: &http2.Transport{
+	dialProxy := proxyDialContext(proxyURL, tlsConfig)
+
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{"h2"}
+	tlsConfig.GetConfigForClient = func(chi *tls.ClientHelloInfo) (*tls.Config, error) {
+		if dontLinger {
+			if tcpConn, ok := chi.Conn.(*net.TCPConn); ok {
+				maybePanic(tcpConn.SetLinger(0))
+			}
+		}
+		return nil, nil
+	}
+
+	newTransport := func() http.RoundTripper {
+		return &http2.Transport{
 			AllowHTTP: true,
 			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
-				con, err := tls.DialWithDialer(defaultDialer, network, addr, cfg)
-				return con, err
-			},
-			TLSClientConfig: &tls.Config{
-				NextProtos: []string{"h2"},
-				GetConfigForClient: func(chi *tls.ClientHelloInfo) (*tls.Config, error) {
-					if dontLinger {
-						if tcpConn, ok := chi.Conn.(*net.TCPConn); ok {
-							maybePanic(tcpConn.SetLinger(0))
-						}
+				if unixSocket != "" {
+					con, err := dialUnixSocket(context.Background())
+					if err != nil {
+						return nil, err
+					}
+					tlsCon := tls.Client(con, cfg)
+					if err = tlsCon.Handshake(); err != nil {
+						_ = con.Close()
+						return nil, err
 					}
-					return nil, nil
-				},
-				InsecureSkipVerify: insecure,
+					return tlsCon, nil
+				}
+
+				if proxyURL == nil {
+					resolved, err := resolveAddr(context.Background(), addr)
+					if err != nil {
+						return nil, err
+					}
+					// the transport sets cfg.ServerName to the original host
+					con, err := tls.DialWithDialer(connectionDialer(), connectionNetwork(network), resolved, cfg)
+					if err == nil {
+						connectionsOpened.Add(1)
+						setNoDelay(con.NetConn())
+					}
+					return con, err
+				}
+
+				ctx := context.Background()
+				if connectTimeout > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, connectTimeout)
+					defer cancel()
+				}
+
+				con, err := dialProxy(ctx, network, addr)
+				if err != nil {
+					return nil, err
+				}
+				tlsCon := tls.Client(con, cfg)
+				if err = tlsCon.HandshakeContext(ctx); err != nil {
+					_ = con.Close()
+					return nil, err
+				}
+				return tlsCon, nil
 			},
+			TLSClientConfig:    tlsConfig,
+			DisableCompression: true,
+		}
+	}
+
+	httpClient = &http.Client{
+		Transport: newTransport(),
+		Timeout:   requestTimeout}
+
+	http2MaxStreams = maxStreams
+	newHTTP2Transport = newTransport
+	noLinger = dontLinger
+}
+
+// initHTTP3Client sets up a client speaking HTTP/3 over QUIC.
+// All requests to a host are multiplexed as streams over a single QUIC
+// connection, so ReuseConnections does not apply, same as for HTTP/2.
+// DontLinger has no effect either as QUIC runs on top of UDP.
+func initHTTP3Client(requestTimeout, connectTimeout time.Duration, dontLinger bool, tlsConfig *tls.Config) {
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{http3.NextProtoH3}
+
+	httpClient = &http.Client{
+		Transport: &http3.Transport{
+			Dial: func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+				resolved, err := resolveAddr(ctx, addr)
+				if err != nil {
+					return nil, classifyError(err)
+				}
+				con, err := quic.DialAddrEarly(ctx, resolved, tlsCfg, cfg)
+				if err != nil {
+					// report as a connection error of the request instead of failing the run
+					return nil, &requestError{connectionErrors, fmt.Errorf("QUIC handshake failed: %v", err)}
+				}
+				connectionsOpened.Add(1)
+				return con, nil
+			},
+			QUICConfig: &quic.Config{
+				HandshakeIdleTimeout: connectTimeout,
+			},
+			TLSClientConfig:    tlsConfig,
+			DisableCompression: true,
 		},
 		Timeout: requestTimeout}
 
 	noLinger = dontLinger
 }
 
+// stdinBodyFile is the BodyFile reading the body from stdin.
+const stdinBodyFile = "-"
+
+var (
+	stdinBodyOnce sync.Once
+	stdinBody     []byte
+	stdinBodyErr  error
+)
+
+// readStdinBody reads stdin the first time it's called, so that request
+// definitions with a BodyFile of - all get the same body.
+func readStdinBody() ([]byte, error) {
+	stdinBodyOnce.Do(func() {
+		if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			stdinBodyErr = errors.New("BodyFile - reads the body from stdin, which is not redirected, pipe it in, e.g. cat body.json | labench")
+			return
+		}
+		stdinBody, stdinBodyErr = ioutil.ReadAll(os.Stdin)
+		if stdinBodyErr == nil && len(stdinBody) == 0 {
+			stdinBodyErr = errors.New("BodyFile - reads the body from stdin, but stdin is empty")
+		}
+	})
+	return stdinBody, stdinBodyErr
+}
+
 // WebRequesterFactory implements RequesterFactory by creating a Requester
 // which makes GET requests to the provided URL.
 type WebRequesterFactory struct {
@@ -106,74 +385,577 @@ type WebRequesterFactory struct {
 	Headers                map[string]string `yaml:"Headers"`
 	Body                   string            `yaml:"Body"`
 	BodyFile               string            `yaml:"BodyFile"`
+	RandomBodySize         int64             `yaml:"RandomBodySize"`
+	RandomBodyReuse        bool              `yaml:"RandomBodyReuse"`
+	CompressRequest        bool              `yaml:"CompressRequest"`
 	ExpectedHTTPStatusCode int               `yaml:"ExpectedHTTPStatusCode"`
+	AcceptedStatusCodes    []int             `yaml:"AcceptedStatusCodes"`
+	ConditionalRequests    bool              `yaml:"ConditionalRequests"`
 	HTTPMethod             string            `yaml:"HTTPMethod"`
+	ResponseBodyRegex      string            `yaml:"ResponseBodyRegex"`
+	ResponseJSONPath       string            `yaml:"ResponseJSONPath"`
+	ExpectedJSONValue      string            `yaml:"ExpectedJSONValue"`
+	SkipResponseBody       bool              `yaml:"SkipResponseBody"`
+	RequestTimeout         time.Duration     `yaml:"RequestTimeout"`
+	MaxRetries             int               `yaml:"MaxRetries"`
+	RetryOnStatus          []int             `yaml:"RetryOnStatus"`
+	RespectRetryAfter      bool              `yaml:"RespectRetryAfter"`
+	RequestIDHeader        string            `yaml:"RequestIDHeader"`
+	GRPCMethod             string            `yaml:"GRPCMethod"`
+	ProtoDescriptorSet     string            `yaml:"ProtoDescriptorSet"`
+	DataFile               string            `yaml:"DataFile"`
+	DataOrder              string            `yaml:"DataOrder"`
+	BearerToken            string            `yaml:"BearerToken"`
+	BearerTokenFile        string            `yaml:"BearerTokenFile"`
+	Username               string            `yaml:"Username"`
+	Password               string            `yaml:"Password"`
+	OAuth2                 *oauth2Config     `yaml:"OAuth2"`
+	TokenCommand           string            `yaml:"TokenCommand"`
+	ReauthOn401            bool              `yaml:"ReauthOn401"`
+	CookieJar              bool              `yaml:"CookieJar"`
+	CircuitBreaker         *breakerConfig    `yaml:"CircuitBreaker"`
+	Multipart              *multipartConfig  `yaml:"Multipart"`
+	GraphQL                *graphQLConfig    `yaml:"GraphQL"`
+	UserAgent              *string           `yaml:"UserAgent"`
 
 	expandedHeaders map[string][]string
+	headerTemplates map[string][]*textTemplate
+	dataRows        *dataRows
+	urlTemplate     *textTemplate
+	urlsTemplates   []*textTemplate
+	bodyTemplate    *textTemplate
+	randomBody      []byte
+	compressedBody  []byte
+	multipartBody   *multipartBody
+	bodyRegex       *regexp.Regexp
+	jsonAssertion   *jsonAssertion
+	grpcMethod      *grpcMethod
+	token           *refreshedToken
+	breakers        []*circuitBreaker
+	prepareOnce     sync.Once
+}
+
+// ConnectionsOpened returns how many connections were opened to the system
+// under test, by the requesters of all factories.
+func (w *WebRequesterFactory) ConnectionsOpened() uint64 {
+	return connectionsOpened.Load()
 }
 
 // GetRequester returns a new Requester, called for each Benchmark connection.
-func (w *WebRequesterFactory) GetRequester(uint64) bench.Requester {
-	// if len(w.expandedHeaders) != len(w.Headers) {
-	if w.expandedHeaders == nil {
-		expandedHeaders := make(map[string][]string)
-		for key, val := range w.Headers {
-			expandedHeaders[key] = []string{os.ExpandEnv(val)}
+func (w *WebRequesterFactory) GetRequester(number uint64) bench.Requester {
+	// requesters are created concurrently, so shared state is prepared only once
+	w.prepareOnce.Do(w.prepare)
+
+	if grpcConn != nil {
+		return newGRPCRequester(w.grpcMethod, w.expandedHeaders, w.RequestTimeout)
+	}
+
+	if wsDialer != nil {
+		return newWebSocketRequester(w.URL, w.expandedHeaders, w.Body, w.RequestTimeout)
+	}
+
+	templated := !w.urlTemplate.isStatic() || !w.bodyTemplate.isStatic() || len(w.headerTemplates) > 0
+	for _, t := range w.urlsTemplates {
+		templated = templated || !t.isStatic()
+	}
+
+	rnd := newClientRand(number, requestRandom)
+
+	client := httpClient
+	if pipelineDepth > 0 {
+		client = pipelinedClient(number)
+	}
+	if http2MaxStreams > 0 {
+		client = http2StreamsClient(number)
+	}
+	if w.CookieJar {
+		client = clientWithCookieJar(number, client)
+	}
+
+	accepted := w.AcceptedStatusCodes
+	var validators map[string]cacheValidators
+	if w.ConditionalRequests {
+		accepted = append([]int{http.StatusNotModified}, accepted...)
+		validators = make(map[string]cacheValidators)
+	}
+
+	return &webRequester{
+		client:             client,
+		url:                w.urlTemplate,
+		urls:               w.urlsTemplates,
+		hosts:              w.Hosts,
+		headers:            w.expandedHeaders,
+		headerTemplates:    w.headerTemplates,
+		body:               w.bodyTemplate,
+		expectedReturnCode: w.ExpectedHTTPStatusCode,
+		acceptedCodes:      accepted,
+		validators:         validators,
+		httpMethod:         w.HTTPMethod,
+		templated:          templated,
+		randomBodySize:     w.RandomBodySize,
+		randomBody:         w.randomBody,
+		compressedBody:     w.compressedBody,
+		multipart:          w.multipartBody,
+		bodyRegex:          w.bodyRegex,
+		jsonAssertion:      w.jsonAssertion,
+		graphQLErrors:      w.GraphQL != nil && w.GraphQL.FailOnErrors,
+		skipResponseBody:   w.SkipResponseBody,
+		timeout:            w.RequestTimeout,
+		maxRetries:         w.MaxRetries,
+		retryOnStatus:      w.RetryOnStatus,
+		respectRetryAfter:  w.RespectRetryAfter,
+		requestIDHeader:    http.CanonicalHeaderKey(w.RequestIDHeader),
+		token:              w.token,
+		reauthOn401:        w.ReauthOn401 && w.token != nil,
+		breakers:           w.breakers,
+		rnd:                rnd,
+		data:               newTemplateData(w.dataRows, rnd),
+	}
+}
+
+// ensurePrepared prepares the shared state ahead of the run, so that errors
+// are reported before it starts rather than by the first requester.
+func (w *WebRequesterFactory) ensurePrepared() {
+	w.prepareOnce.Do(w.prepare)
+}
+
+// prepare expands headers and loads the files referenced by the config.
+func (w *WebRequesterFactory) prepare() {
+	// header names are case insensitive, canonical form makes them easy to look up
+	expandedHeaders := make(map[string][]string)
+	for key, val := range w.Headers {
+		key = http.CanonicalHeaderKey(key)
+		expandedHeaders[key] = append(expandedHeaders[key], val)
+	}
+
+	// a User-Agent of Headers wins, an empty one is not sent at all
+	if _, ok := expandedHeaders["User-Agent"]; !ok && grpcConn == nil {
+		userAgent := "labench/" + labenchVersion()
+		if w.UserAgent != nil {
+			userAgent = *w.UserAgent
+		}
+		expandedHeaders["User-Agent"] = []string{userAgent}
+	}
+
+	// an Accept-Encoding of Headers wins, the responses are still decompressed
+	if _, ok := expandedHeaders["Accept-Encoding"]; !ok && decompressResponses && grpcConn == nil {
+		expandedHeaders["Accept-Encoding"] = []string{acceptEncoding}
+	}
+
+	// if BearerTokenFile is specified BearerToken is ignored
+	token := w.BearerToken
+	if w.BearerTokenFile != "" {
+		content, err := ioutil.ReadFile(w.BearerTokenFile)
+		maybePanic(err)
+		token = strings.TrimSpace(string(content))
+	}
+
+	if token != "" {
+		if _, ok := expandedHeaders["Authorization"]; ok {
+			slog.Warn("BearerToken overrides Authorization header")
+		}
+		expandedHeaders["Authorization"] = []string{"Bearer " + token}
+	}
+
+	if w.Username != "" || w.Password != "" {
+		if _, ok := expandedHeaders["Authorization"]; ok {
+			slog.Warn("Username and Password are ignored as Authorization header is set")
+		} else {
+			credentials := w.Username + ":" + w.Password
+			expandedHeaders["Authorization"] = []string{"Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))}
 		}
-		w.expandedHeaders = expandedHeaders
 	}
 
+	// the header of OAuth2 or TokenCommand is set per request as the token is refreshed
+	var fetch tokenFetch
+	if w.OAuth2 != nil {
+		fetch = newOAuth2Client(*w.OAuth2).fetch
+	} else if w.TokenCommand != "" {
+		fetch = commandToken(w.TokenCommand)
+	}
+	if fetch != nil {
+		if _, ok := expandedHeaders["Authorization"]; ok {
+			slog.Warn("OAuth2 or TokenCommand overrides Authorization header")
+			delete(expandedHeaders, "Authorization")
+		}
+		token, err := startRefreshedToken(fetch)
+		maybePanic(err)
+		w.token = token
+	}
+
+	if w.Multipart != nil {
+		body, err := newMultipartBody(w.Multipart)
+		maybePanic(err)
+		w.multipartBody = body
+		// the boundary is only known here
+		expandedHeaders["Content-Type"] = []string{body.contentType}
+	}
+
+	if w.GraphQL != nil {
+		body, err := newGraphQLBody(w.GraphQL)
+		maybePanic(err)
+		w.Body = body
+		// a Content-Type of Headers wins
+		if _, ok := expandedHeaders["Content-Type"]; !ok {
+			expandedHeaders["Content-Type"] = []string{"application/json"}
+		}
+	}
+
+	w.expandedHeaders = expandedHeaders
+
 	// if BodyFile is specified Body is ignored
-	if w.BodyFile != "" {
+	if w.BodyFile == stdinBodyFile {
+		content, err := readStdinBody()
+		maybePanic(err)
+		w.Body = string(content)
+	} else if w.BodyFile != "" {
 		content, err := ioutil.ReadFile(w.BodyFile)
 		maybePanic(err)
 		w.Body = string(content)
 	}
 
-	return &webRequester{w.URL, w.URLs, w.Hosts, w.expandedHeaders, w.Body, w.ExpectedHTTPStatusCode, w.HTTPMethod}
+	if grpcConn != nil {
+		method, err := loadGRPCMethod(w.ProtoDescriptorSet, w.GRPCMethod, w.Body)
+		maybePanic(err)
+		w.grpcMethod = method
+	}
+
+	var err error
+	w.urlTemplate, err = newTextTemplate("URL", w.URL)
+	maybePanic(err)
+	w.urlsTemplates = make([]*textTemplate, len(w.URLs))
+	for i, u := range w.URLs {
+		w.urlsTemplates[i], err = newTextTemplate("URLs", u)
+		maybePanic(err)
+	}
+	w.bodyTemplate, err = newTextTemplate("Body", w.Body)
+	maybePanic(err)
+
+	// compressed once, so that compressing doesn't add to the latency of requests
+	if w.CompressRequest {
+		// checked by validateRequest, apart from a body read from stdin
+		assert(w.bodyTemplate.isStatic(), "CompressRequest needs a Body without placeholders, as it is compressed once at startup")
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		_, err = writer.Write([]byte(w.Body))
+		maybePanic(err)
+		maybePanic(writer.Close())
+		w.compressedBody = compressed.Bytes()
+		w.expandedHeaders["Content-Encoding"] = []string{"gzip"}
+	}
+
+	// only headers with placeholders are rendered per request
+	w.headerTemplates = make(map[string][]*textTemplate)
+	for key, values := range w.expandedHeaders {
+		templates := make([]*textTemplate, len(values))
+		templated := false
+		for i, val := range values {
+			templates[i], err = newTextTemplate(key+" header", val)
+			maybePanic(err)
+			templated = templated || !templates[i].isStatic()
+		}
+		if templated {
+			w.headerTemplates[key] = templates
+		}
+	}
+
+	if w.ResponseBodyRegex != "" {
+		w.bodyRegex, err = regexp.Compile(w.ResponseBodyRegex)
+		maybePanic(err)
+	}
+
+	if w.ResponseJSONPath != "" {
+		w.jsonAssertion, err = newJSONAssertion(w.ResponseJSONPath, w.ExpectedJSONValue)
+		maybePanic(err)
+	}
+
+	// a breaker per target, shared by all clients
+	if w.CircuitBreaker != nil {
+		targets := w.URLs
+		if len(targets) == 0 {
+			targets = w.Hosts
+		}
+		if len(targets) == 0 {
+			targets = []string{w.URL}
+		}
+		w.breakers = newCircuitBreakers(*w.CircuitBreaker, targets)
+	}
+
+	// a single buffer shared by all clients, so even large bodies take little memory
+	if w.RandomBodySize > 0 && w.RandomBodyReuse {
+		w.randomBody = make([]byte, w.RandomBodySize)
+		_, _ = rand.New(rand.NewSource(randomSeed)).Read(w.randomBody)
+	}
+
+	if w.DataFile != "" {
+		assert(w.DataOrder == "" || w.DataOrder == "Sequential" || w.DataOrder == "Random",
+			fmt.Sprintf("DataOrder must be Sequential or Random, got %q", w.DataOrder))
+		w.dataRows, err = loadDataRows(w.DataFile, w.DataOrder == "Random")
+		maybePanic(err)
+	}
 }
 
 // webRequester implements Requester by making a GET request to the provided
 // URL.
 type webRequester struct {
-	url                string
-	urls               []string
+	client             *http.Client
+	url                *textTemplate
+	urls               []*textTemplate
 	hosts              []string
 	headers            map[string][]string
-	body               string
+	headerTemplates    map[string][]*textTemplate
+	body               *textTemplate
 	expectedReturnCode int
+	acceptedCodes      []int
+	validators         map[string]cacheValidators
 	httpMethod         string
+	randomBodySize     int64
+	randomBody         []byte
+	compressedBody     []byte
+	multipart          *multipartBody
+	bodyRegex          *regexp.Regexp
+	jsonAssertion      *jsonAssertion
+	graphQLErrors      bool
+	skipResponseBody   bool
+	timeout            time.Duration
+	maxRetries         int
+	retryOnStatus      []int
+	respectRetryAfter  bool
+	requestIDHeader    string
+	token              *refreshedToken
+	reauthOn401        bool
+	breakers           []*circuitBreaker
+	rnd                *rand.Rand
+	templated          bool
+	data               *templateData
 }
 
-var nextHostOrURL int32 = -1
+// nextHostOrURL is shared by all clients, so requests are evenly spread across targets.
+// It is unsigned to wrap around safely on very long runs.
+var nextHostOrURL = ^uint32(0)
+
+// nextTarget returns the index of the next of n targets in round-robin order.
+func nextTarget(n int) int {
+	return int(atomic.AddUint32(&nextHostOrURL, 1) % uint32(n))
+}
 
 // Setup prepares the Requester for benchmarking.
 func (w *webRequester) Setup() error { return nil }
 
 // Request performs a synchronous request to the system under test.
-func (w *webRequester) Request() error {
-	var reqURL string
-	if w.urls != nil {
-		h := atomic.AddInt32(&nextHostOrURL, 1)
-		reqURL = w.urls[h%int32(len(w.urls))]
-	} else if w.hosts != nil {
-		parsedURL, err := url.Parse(w.url)
-		if err != nil {
-			return err
+func (w *webRequester) Request() (bench.Result, error) {
+	return w.RequestContext(context.Background())
+}
+
+// RequestContext implements bench.ContextRequester, the request is aborted
+// once ctx is done. Failed attempts are retried up to maxRetries times if they
+// may be transient.
+func (w *webRequester) RequestContext(ctx context.Context) (bench.Result, error) {
+	if w.templated {
+		w.data.next()
+	}
+
+	start := time.Now()
+	result, err := w.sendAuthorized(ctx, start)
+	for retries := 1; retries <= w.maxRetries && ctx.Err() == nil && w.shouldRetry(result, err); retries++ {
+		result, err = w.sendAuthorized(ctx, start)
+		result.Retries = retries
+	}
+	return result, err
+}
+
+// sendAuthorized sends the request, and again once with a new token if the
+// token was rejected with 401 and ReauthOn401 is set. Concurrent rejections
+// of the same token refresh it once.
+func (w *webRequester) sendAuthorized(ctx context.Context, start time.Time) (bench.Result, error) {
+	if !w.reauthOn401 {
+		return w.send(ctx, start)
+	}
+
+	sent := w.token.header()
+	result, err := w.send(ctx, start)
+	if result.StatusCode != http.StatusUnauthorized {
+		return result, err
+	}
+	if w.token.refreshRejected(sent) != nil {
+		return result, err
+	}
+	return w.send(ctx, start)
+}
+
+// shouldRetry reports whether a failed attempt is worth retrying: either the
+// connection failed or the status is listed in RetryOnStatus.
+func (w *webRequester) shouldRetry(result bench.Result, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// with RespectRetryAfter a 429 isn't retried, even without a Retry-After,
+	// the connection waits for the server instead
+	if result.RateLimited {
+		return false
+	}
+
+	var categorized *requestError
+	if errors.As(err, &categorized) && categorized.category == connectionErrors {
+		return true
+	}
+
+	if result.StatusCode != 0 {
+		for _, status := range w.retryOnStatus {
+			if result.StatusCode == status {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseRetryAfter returns the wait of a Retry-After header, either a number of
+// seconds or an HTTP date, zero if it's missing or invalid.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// nextURL returns the URL of the next request, spread across URLs or Hosts,
+// and the circuit breaker of its target if there is one. Targets with an open
+// circuit are skipped.
+func (w *webRequester) nextURL() (string, *circuitBreaker, error) {
+	targets := len(w.urls)
+	if targets == 0 {
+		targets = len(w.hosts)
+	}
+	i := 0
+	if targets > 0 {
+		i = nextTarget(targets)
+	}
+	var breaker *circuitBreaker
+	if w.breakers != nil {
+		var ok bool
+		if i, ok = pickTarget(w.breakers, i); !ok {
+			return "", nil, newRequestError(circuitOpenErrors, "Circuit breaker open for all targets, the request was not sent")
+		}
+		breaker = w.breakers[i]
+	}
+
+	if len(w.urls) > 0 {
+		reqURL, err := w.urls[i].render(w.data)
+		return reqURL, breaker, err
+	}
+
+	reqURL, err := w.url.render(w.data)
+	if err != nil || len(w.hosts) == 0 {
+		return reqURL, breaker, err
+	}
+	parsedURL, err := url.Parse(reqURL)
+	if err != nil {
+		return "", nil, err
+	}
+	parsedURL.Host = w.hosts[i]
+	return parsedURL.String(), breaker, nil
+}
+
+// send makes one attempt of the request to the next URL, and counts its outcome
+// towards the circuit breaker of the target.
+func (w *webRequester) send(ctx context.Context, start time.Time) (bench.Result, error) {
+	reqURL, breaker, err := w.nextURL()
+	if err != nil {
+		return bench.Result{}, err
+	}
+
+	result, err := w.sendTo(ctx, start, reqURL)
+	if breaker != nil {
+		breaker.record(err != nil)
+	}
+	if err != nil {
+		result.Method, result.URL = w.httpMethod, reqURL
+		if result.Method == "" {
+			result.Method = http.MethodGet
 		}
-		h := atomic.AddInt32(&nextHostOrURL, 1)
-		parsedURL.Host = w.hosts[h%int32(len(w.hosts))]
-		reqURL = parsedURL.String()
+	}
+	return result, err
+}
+
+// sendTo makes one attempt of the request, rendered with the current template data.
+// The time to first byte is measured since start, so it includes earlier attempts,
+// the connection timing is of this attempt only.
+func (w *webRequester) sendTo(ctx context.Context, start time.Time, reqURL string) (bench.Result, error) {
+	if w.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.timeout)
+		defer cancel()
+	}
+
+	var body io.Reader
+	if w.randomBody != nil {
+		body = bytes.NewReader(w.randomBody)
+	} else if w.compressedBody != nil {
+		body = bytes.NewReader(w.compressedBody)
+	} else if w.multipart != nil {
+		body = w.multipart.reader()
+	} else if w.randomBodySize > 0 {
+		// random bytes are generated while the body is sent, nothing is buffered
+		body = io.LimitReader(w.rnd, w.randomBodySize)
 	} else {
-		reqURL = w.url
+		renderedBody, err := w.body.render(w.data)
+		if err != nil {
+			return bench.Result{}, err
+		}
+		body = strings.NewReader(renderedBody)
 	}
 
-	req, err := http.NewRequest(w.httpMethod, reqURL, strings.NewReader(w.body))
+	req, err := http.NewRequestWithContext(ctx, w.httpMethod, reqURL, body)
 	if err != nil {
-		return err
+		return bench.Result{}, err
 	}
 
-	req.Header = w.headers
+	if w.randomBodySize > 0 {
+		req.ContentLength = w.randomBodySize
+	} else if w.multipart != nil {
+		req.ContentLength = w.multipart.length
+	}
+
+	headers := w.headers
+	var requestID string
+	if len(w.headerTemplates) > 0 || w.token != nil || w.requestIDHeader != "" || w.validators != nil {
+		headers = make(map[string][]string, len(w.headers)+2)
+		for key, values := range w.headers {
+			headers[key] = values
+		}
+		if w.token != nil {
+			headers["Authorization"] = []string{w.token.header()}
+		}
+		if w.requestIDHeader != "" {
+			requestID = nextRequestID()
+			headers[w.requestIDHeader] = []string{requestID}
+		}
+		if w.validators != nil {
+			w.conditionalHeaders(reqURL, headers)
+		}
+		for key, templates := range w.headerTemplates {
+			values := make([]string, len(templates))
+			for i, t := range templates {
+				if values[i], err = t.render(w.data); err != nil {
+					return bench.Result{}, err
+				}
+			}
+			headers[key] = values
+		}
+	}
+
+	req.Header = headers
 
 	// from https://golang.org/src/net/http/request.go?#L124
 	// For client requests, the URL's Host specifies the server to
@@ -181,20 +963,18 @@ func (w *webRequester) Request() error {
 	// specifies the Host header value to send in the HTTP
 	// request.
 
-	//case insensitive
-	if host, ok := w.headers["host"]; ok {
+	// header names are in canonical form
+	if host, ok := headers["Host"]; ok {
 		if len(host) != 1 {
-			return errors.New("multiple host headers are not allowed")
-		}
-		req.Host = host[0]
-	} else if host, ok = w.headers["Host"]; ok {
-		if len(host) != 1 {
-			return errors.New("multiple host headers are not allowed")
+			return bench.Result{}, errors.New("multiple host headers are not allowed")
 		}
 		req.Host = host[0]
 	}
 
-	resp, err := httpClient.Do(req)
+	trace := newRequestTrace(start)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
+
+	resp, err := w.client.Do(req)
 
 	/* to look at the response body
 	buf := new(bytes.Buffer)
@@ -203,26 +983,127 @@ func (w *webRequester) Request() error {
 	_ = s
 	*/
 
+	var respBody []byte
+	var received, decompressed int64
+	var readErr error
+	// the start of the body is kept for the failure log
+	prefix := newBodyPrefix()
 	// #nosec
+	// a response to HEAD has no body even if its headers describe one, decoding
+	// it would fail, so only the status is checked
+	if resp != nil && resp.Body != nil && req.Method != http.MethodHead {
+		body, wire, compressed := decodedBody(resp)
+		if w.bodyRegex != nil || w.jsonAssertion != nil || w.graphQLErrors {
+			respBody, readErr = ioutil.ReadAll(body)
+			decompressed = int64(len(respBody))
+			if prefix != nil {
+				_, _ = prefix.Write(respBody)
+			}
+		} else if !w.skipResponseBody {
+			if prefix != nil {
+				body = io.TeeReader(body, prefix)
+			}
+			decompressed, _ = io.Copy(ioutil.Discard, body)
+		}
+		received = wire.n
+		if !compressed {
+			decompressed = 0
+		}
+	}
 	if resp != nil && resp.Body != nil {
-		_, _ = io.Copy(ioutil.Discard, resp.Body)
 		_ = resp.Body.Close()
 	}
 
 	if err != nil {
-		return err
+		return bench.Result{RequestID: requestID}, withDetails(classifyError(err), req, nil, nil)
 	}
 
 	if resp == nil {
-		return errors.New("Nil response")
+		return bench.Result{RequestID: requestID}, errors.New("Nil response")
+	}
+
+	result := bench.Result{
+		RequestID:         requestID,
+		StatusCode:        resp.StatusCode,
+		BytesSent:         req.ContentLength,
+		BytesReceived:     received,
+		BytesDecompressed: decompressed,
+		TimeToFirstByte:   trace.timeToFirstByte(),
+		Connection:        trace.connectionTiming(),
+	}
+
+	if w.validators != nil {
+		w.rememberValidators(reqURL, resp)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests && w.respectRetryAfter {
+		result.RateLimited = true
+		result.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
 	}
 
-	if resp.StatusCode != w.expectedReturnCode {
-		return fmt.Errorf("Expected %v got %v", w.expectedReturnCode, resp.StatusCode)
+	if err = w.checkResponse(resp.StatusCode, respBody, readErr); err != nil {
+		return result, withDetails(err, req, resp, prefix)
+	}
+	return result, nil
+}
+
+// checkResponse validates the status of a response and its body, if it was
+// read to be checked.
+func (w *webRequester) checkResponse(statusCode int, respBody []byte, readErr error) error {
+	if !w.acceptedStatus(statusCode) {
+		return newRequestError(statusMismatchErrors, "Expected %v got %v", w.expectedReturnCode, statusCode)
+	}
+
+	if readErr != nil {
+		return classifyError(readErr)
+	}
+
+	// a 304 has no body, the body the client has cached was checked before
+	if statusCode == http.StatusNotModified {
+		return nil
+	}
+
+	if w.bodyRegex != nil && !w.bodyRegex.Match(respBody) {
+		return newRequestError(validationErrors, "Response body does not match ResponseBodyRegex")
+	}
+
+	if w.jsonAssertion != nil {
+		if err := w.jsonAssertion.check(respBody); err != nil {
+			return err
+		}
 	}
 
+	if w.graphQLErrors {
+		return checkGraphQLErrors(respBody)
+	}
 	return nil
 }
 
+// WarmUpConnection opens a connection to the target of the next request by
+// sending a HEAD request, which leaves it open in the pool of the client. The
+// status of the response doesn't matter.
+func (w *webRequester) WarmUpConnection() error {
+	reqURL, _, err := w.nextURL()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodHead, reqURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = w.headers
+	if host, ok := w.headers["Host"]; ok && len(host) == 1 {
+		req.Host = host[0]
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return classifyError(err)
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
 // Teardown is called upon benchmark completion.
 func (w *webRequester) Teardown() error { return nil }
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"labench/bench"
+)
+
+// webhookConfig posts the results of the run to URL once it's over, as the
+// JSON of SummaryFile or as a Slack message if Slack is set. Timeout defaults
+// to 10s.
+type webhookConfig struct {
+	URL     string        `yaml:"URL"`
+	Slack   bool          `yaml:"Slack"`
+	Timeout time.Duration `yaml:"Timeout"`
+}
+
+// webhookPayload is the Report of the run, with whether the SLA passed if it
+// was checked.
+type webhookPayload struct {
+	*bench.Report
+	SLAPassed *bool `json:",omitempty"`
+}
+
+// notifyWebhook posts the summary of the run to the webhook. It only logs
+// failures, a run isn't failed for not being able to notify.
+func notifyWebhook(conf webhookConfig, summary *bench.Summary, slaChecked, slaPassed bool) {
+	var body interface{}
+	if conf.Slack {
+		body = map[string]string{"text": slackMessage(summary, slaChecked, slaPassed)}
+	} else {
+		payload := webhookPayload{Report: summary.Report()}
+		if slaChecked {
+			payload.SLAPassed = &slaPassed
+		}
+		body = payload
+	}
+
+	content, err := json.Marshal(body)
+	if err != nil {
+		slog.Error("Cannot notify webhook", "url", conf.URL, "err", err)
+		return
+	}
+
+	timeout := conf.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Post(conf.URL, "application/json", bytes.NewReader(content))
+	if err != nil {
+		slog.Error("Cannot notify webhook", "url", conf.URL, "err", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		slog.Error("Webhook rejected the notification", "url", conf.URL, "status", resp.StatusCode)
+		return
+	}
+	slog.Info("Notified webhook", "url", conf.URL)
+}
+
+// slackMessage formats the summary of the run as the text of a Slack message.
+func slackMessage(summary *bench.Summary, slaChecked, slaPassed bool) string {
+	report := summary.Report()
+
+	var text strings.Builder
+	status := "finished"
+	if report.AbortReason != "" {
+		status = "aborted: " + report.AbortReason
+	}
+	fmt.Fprintf(&text, "*LaBench run %s* after %v\n", status, summary.TimeElapsed.Round(time.Second))
+	fmt.Fprintf(&text, "Requests: %d, success rate %.2f%%, throughput %.2f req/sec (target %.2f)\n",
+		report.RequestTotal, report.SuccessRate, report.Throughput, report.TargetRate)
+
+	latency := make([]string, 0, len(summary.Percentiles)+1)
+	for _, percentile := range summary.Percentiles {
+		name := bench.PercentileName(percentile)
+		latency = append(latency, fmt.Sprintf("%s %.2f", name, report.Latency[name]))
+	}
+	latency = append(latency, fmt.Sprintf("max %.2f", report.Latency["max"]))
+	fmt.Fprintf(&text, "Latency (ms): %s\n", strings.Join(latency, ", "))
+
+	if slaChecked {
+		if slaPassed {
+			text.WriteString("SLA: :white_check_mark: PASS\n")
+		} else {
+			var failed []string
+			for _, check := range summary.SLA {
+				if !check.Passed {
+					failed = append(failed, check.Criterion)
+				}
+			}
+			fmt.Fprintf(&text, "SLA: :x: FAIL (%s)\n", strings.Join(failed, ", "))
+		}
+	}
+	return text.String()
+}
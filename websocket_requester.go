@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+
+	"labench/bench"
+)
+
+var (
+	wsDialer  *websocket.Dialer
+	wsTimeout time.Duration
+)
+
+// initWebSocketDialer sets up the dialer used to open one persistent WebSocket connection per client.
+func initWebSocketDialer(requestTimeout, connectTimeout time.Duration, dontLinger bool, tlsConfig *tls.Config, proxyURL *url.URL) {
+	defaultDialer = &net.Dialer{
+		Timeout: connectTimeout,
+		// Disable TCP keepalives as we are sending data very actively anyway.
+		// Should not be confused with WebSocket pings.
+		KeepAlive: 0,
+	}
+
+	wsDialer = &websocket.Dialer{
+		NetDialContext:   proxyDialContext(proxyURL, tlsConfig),
+		HandshakeTimeout: connectTimeout,
+		TLSClientConfig:  tlsConfig.Clone(),
+	}
+
+	wsTimeout = requestTimeout
+	noLinger = dontLinger
+}
+
+// webSocketRequester implements Requester by sending a message over a
+// persistent WebSocket connection and waiting for its echo.
+type webSocketRequester struct {
+	url         string
+	headers     http.Header
+	message     []byte
+	messageType int
+	timeout     time.Duration
+	conn        *websocket.Conn
+}
+
+// newWebSocketRequester returns a requester sending body to url, with the
+// global RequestTimeout unless timeout overrides it.
+func newWebSocketRequester(url string, headers map[string][]string, body string, timeout time.Duration) bench.Requester {
+	messageType := websocket.TextMessage
+	if !utf8.ValidString(body) {
+		messageType = websocket.BinaryMessage
+	}
+
+	if timeout == 0 {
+		timeout = wsTimeout
+	}
+	return &webSocketRequester{url: url, headers: headers, message: []byte(body), messageType: messageType, timeout: timeout}
+}
+
+func (w *webSocketRequester) connect() error {
+	conn, resp, err := wsDialer.Dial(w.url, w.headers)
+	if resp != nil && resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// Setup prepares the Requester for benchmarking.
+// A failed connection is not fatal, Request reconnects and reports the error.
+func (w *webSocketRequester) Setup() error {
+	_ = w.connect()
+	return nil
+}
+
+// Request performs a synchronous request to the system under test.
+func (w *webSocketRequester) Request() (bench.Result, error) {
+	if w.conn == nil {
+		if err := w.connect(); err != nil {
+			return bench.Result{}, classifyError(err)
+		}
+	}
+
+	if w.timeout > 0 {
+		deadline := time.Now().Add(w.timeout)
+		_ = w.conn.SetWriteDeadline(deadline)
+		_ = w.conn.SetReadDeadline(deadline)
+	}
+
+	if err := w.conn.WriteMessage(w.messageType, w.message); err != nil {
+		w.drop()
+		return bench.Result{}, classifyError(err)
+	}
+
+	_, reply, err := w.conn.ReadMessage()
+	if err != nil {
+		// the connection can't be read after an error, a new one is opened on the next request
+		w.drop()
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return bench.Result{}, newRequestError(timeoutErrors, "No echo reply received")
+		}
+		return bench.Result{}, classifyError(err)
+	}
+
+	if !bytes.Equal(reply, w.message) {
+		return bench.Result{BytesSent: int64(len(w.message)), BytesReceived: int64(len(reply))}, newRequestError(validationErrors, "Echo reply does not match the message sent")
+	}
+
+	return bench.Result{BytesSent: int64(len(w.message)), BytesReceived: int64(len(reply))}, nil
+}
+
+func (w *webSocketRequester) drop() {
+	_ = w.conn.Close()
+	w.conn = nil
+}
+
+// Teardown is called upon benchmark completion.
+// It performs the closing handshake so the server sees a clean shutdown.
+func (w *webSocketRequester) Teardown() error {
+	if w.conn == nil {
+		return nil
+	}
+
+	deadline := time.Now().Add(time.Second)
+	err := w.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), deadline)
+	if err == nil {
+		// wait for the server to answer the close frame, pending messages are discarded
+		_ = w.conn.SetReadDeadline(deadline)
+		for {
+			if _, _, readErr := w.conn.ReadMessage(); readErr != nil {
+				break
+			}
+		}
+	}
+
+	closeErr := w.conn.Close()
+	w.conn = nil
+	if err != nil {
+		return err
+	}
+	return closeErr
+}